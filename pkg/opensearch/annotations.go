@@ -0,0 +1,192 @@
+package opensearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// defaultAnnotationsSize matches the size the frontend used to request for annotations
+	defaultAnnotationsSize      = 10000
+	defaultAnnotationsTagsField = "tags"
+)
+
+// annotationSettings holds the document fields used to build annotation events.
+// An empty TimeField means the datasource's configured time field is used.
+type annotationSettings struct {
+	TimeField    string
+	TimeEndField string
+	TagsField    string
+	TextField    string
+}
+
+// parseAnnotationSettings reads the "annotation" object of the query model. The
+// fields are nested on purpose: a top-level `timeField` must not be reintroduced
+// (see parse).
+func parseAnnotationSettings(model *simplejson.Json) *annotationSettings {
+	annotation := model.Get("annotation")
+	return &annotationSettings{
+		TimeField:    annotation.Get("timeField").MustString(),
+		TimeEndField: annotation.Get("timeEndField").MustString(),
+		TagsField:    annotation.Get("tagsField").MustString(defaultAnnotationsTagsField),
+		TextField:    annotation.Get("textField").MustString(),
+	}
+}
+
+// timeField returns the annotation's time field, falling back to defaultTimeField
+func (s *annotationSettings) timeField(defaultTimeField string) string {
+	if s.TimeField == "" {
+		return defaultTimeField
+	}
+	return s.TimeField
+}
+
+// newAnnotationsFrame turns documents into a frame with the time, timeEnd, text and
+// tags fields Grafana maps to annotation events. Documents without a parseable time
+// are skipped.
+func newAnnotationsFrame(docs []map[string]interface{}, settings *annotationSettings, defaultTimeField string) *data.Frame {
+	timeField := settings.timeField(defaultTimeField)
+
+	times := make([]time.Time, 0, len(docs))
+	timeEnds := make([]*time.Time, 0, len(docs))
+	texts := make([]string, 0, len(docs))
+	tags := make([]string, 0, len(docs))
+
+	for _, doc := range docs {
+		t, ok := annotationTime(annotationFieldValue(doc, timeField))
+		if !ok {
+			continue
+		}
+		times = append(times, t)
+
+		var timeEnd *time.Time
+		if settings.TimeEndField != "" {
+			if t, ok := annotationTime(annotationFieldValue(doc, settings.TimeEndField)); ok {
+				timeEnd = &t
+			}
+		}
+		timeEnds = append(timeEnds, timeEnd)
+		texts = append(texts, annotationText(annotationFieldValue(doc, settings.TextField)))
+		tags = append(tags, annotationTags(annotationFieldValue(doc, settings.TagsField)))
+	}
+
+	fields := []*data.Field{data.NewField("time", nil, times)}
+	if settings.TimeEndField != "" {
+		fields = append(fields, data.NewField("timeEnd", nil, timeEnds))
+	}
+	fields = append(fields,
+		data.NewField("text", nil, texts),
+		data.NewField("tags", nil, tags),
+	)
+
+	frame := data.NewFrame("annotations", fields...)
+	frame.Meta = &data.FrameMeta{DataTopic: data.DataTopicAnnotations}
+	return frame
+}
+
+// annotationFieldValue looks up name in doc, either as a flat key or as a path
+// through nested objects (e.g. "event.tags")
+func annotationFieldValue(doc map[string]interface{}, name string) interface{} {
+	if name == "" {
+		return nil
+	}
+	if v, ok := doc[name]; ok {
+		return v
+	}
+
+	var current interface{} = doc
+	for _, part := range strings.Split(name, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[part]
+	}
+	return current
+}
+
+// annotationTimeFormats are the formats string times are parsed with, in order.
+// Times without a zone, such as those of PPL responses, are in UTC.
+var annotationTimeFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	pplTSFormat,
+	pplDateFormat,
+}
+
+// annotationTime converts the value of a time field to a time.Time. Values can
+// come from _source (formatted strings or epoch milliseconds), from "fields"
+// (arrays of formatted strings) or from PPL responses (already parsed times).
+func annotationTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case *time.Time:
+		if v == nil {
+			return time.Time{}, false
+		}
+		return *v, true
+	case float64:
+		return time.UnixMilli(int64(v)).UTC(), true
+	case int64:
+		return time.UnixMilli(v).UTC(), true
+	case int:
+		return time.UnixMilli(int64(v)).UTC(), true
+	case string:
+		for _, format := range annotationTimeFormats {
+			if t, err := time.Parse(format, v); err == nil {
+				return t, true
+			}
+		}
+		if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.UnixMilli(ms).UTC(), true
+		}
+	case []interface{}:
+		if len(v) > 0 {
+			return annotationTime(v[0])
+		}
+	}
+	return time.Time{}, false
+}
+
+func annotationText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// annotationTags returns the tags as a comma separated string, which is how
+// Grafana splits the tags field of annotation frames
+func annotationTags(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		tags := make([]string, 0, len(v))
+		for _, tag := range v {
+			if tag != nil {
+				tags = append(tags, annotationText(tag))
+			}
+		}
+		return strings.Join(tags, ",")
+	default:
+		return annotationText(v)
+	}
+}
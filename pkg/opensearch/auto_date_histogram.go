@@ -0,0 +1,121 @@
+package opensearch
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+)
+
+const (
+	autoDateHistType = "auto_date_histogram"
+	// defaultAutoDateHistogramBuckets is the number of buckets of an auto date
+	// histogram of a query without max data points, the resolution auto date
+	// histogram intervals are calculated for
+	defaultAutoDateHistogramBuckets = 1500
+)
+
+// autoDateHistogramBuckets returns the number of buckets an auto date histogram
+// targets: its "buckets" setting, or else the max data points of the query
+func autoDateHistogramBuckets(bucketAgg *BucketAgg, maxDataPoints int64) int {
+	if buckets, err := castToInt(bucketAgg.Settings.Get("buckets")); err == nil && buckets > 0 {
+		return buckets
+	}
+	if maxDataPoints > 0 {
+		return int(maxDataPoints)
+	}
+	return defaultAutoDateHistogramBuckets
+}
+
+func addAutoDateHistogramAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg, maxDataPoints int64, timeField, timeZone string) client.AggBuilder {
+	// If no field is specified, use the time field
+	field := bucketAgg.Field
+	if field == "" {
+		field = timeField
+	}
+	aggBuilder.AutoDateHistogram(bucketAgg.ID, field, func(a *client.AutoDateHistogramAgg, b client.AggBuilder) {
+		a.Buckets = autoDateHistogramBuckets(bucketAgg, maxDataPoints)
+		a.MinimumInterval = bucketAgg.Settings.Get("minimumInterval").MustString()
+		a.Format = bucketAgg.Settings.Get("format").MustString(client.DateFormatEpochMS)
+		a.TimeZone = histogramTimeZone(bucketAgg.Settings.Get("timeZone").MustString(), timeZone)
+
+		if missing, err := bucketAgg.Settings.Get("missing").String(); err == nil {
+			a.Missing = &missing
+		}
+
+		aggBuilder = b
+	})
+
+	return aggBuilder
+}
+
+// processAutoDateHistogram processes the buckets of an auto date histogram into time
+// series, like those of a date histogram, which tell the interval OpenSearch chose
+func (rp *responseParser) processAutoDateHistogram(esAgg *simplejson.Json, target *Query, frames *data.Frames, props map[string]string) error {
+	first := len(*frames)
+	if err := rp.processMetrics(esAgg, target, frames, props); err != nil {
+		return err
+	}
+
+	interval := esAgg.Get("interval").MustString()
+	if interval == "" {
+		return nil
+	}
+	step, fixed := parseAutoDateHistogramInterval(interval)
+	for _, frame := range (*frames)[first:] {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		custom, ok := frame.Meta.Custom.(map[string]interface{})
+		if !ok {
+			custom = make(map[string]interface{})
+			frame.Meta.Custom = custom
+		}
+		custom["interval"] = interval
+		// months and years vary in length, so panels are only told fixed steps
+		if fixed && len(frame.Fields) > 0 {
+			if frame.Fields[0].Config == nil {
+				frame.Fields[0].Config = &data.FieldConfig{}
+			}
+			frame.Fields[0].Config.Interval = float64(step.Milliseconds())
+		}
+	}
+	return nil
+}
+
+var autoDateHistogramIntervalRegex = regexp.MustCompile(`^(\d+)(ms|s|m|h|d|w|M|y)$`)
+
+// parseAutoDateHistogramInterval parses the interval of the response of an auto date
+// histogram, such as "30m" or "7d". It returns false for calendar intervals, months
+// and years, and intervals it doesn't know.
+func parseAutoDateHistogramInterval(interval string) (time.Duration, bool) {
+	matches := autoDateHistogramIntervalRegex.FindStringSubmatch(interval)
+	if matches == nil {
+		return 0, false
+	}
+	quantity, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	var unit time.Duration
+	switch matches[2] {
+	case "ms":
+		unit = time.Millisecond
+	case "s":
+		unit = time.Second
+	case "m":
+		unit = time.Minute
+	case "h":
+		unit = time.Hour
+	case "d":
+		unit = 24 * time.Hour
+	case "w":
+		unit = 7 * 24 * time.Hour
+	default:
+		return 0, false
+	}
+	return time.Duration(quantity) * unit, true
+}
@@ -5,11 +5,13 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -70,10 +72,17 @@ type Client interface {
 	GetMinInterval(queryInterval time.Duration) (time.Duration, error)
 	GetIndex() string
 	GetNumberOfShards(index string) (int, error)
+	GetFieldTypes(ctx context.Context, index string) (map[string][]string, error)
+	SearchIndex(index string, timeRange backend.TimeRange) string
 	ExecuteMultisearch(ctx context.Context, r *MultiSearchRequest) (*MultiSearchResponse, error)
 	MultiSearch() *MultiSearchRequestBuilder
+	OpenPointInTime(ctx context.Context, r *SearchRequest, keepAlive string) (string, error)
+	ClosePointInTime(ctx context.Context, id string) error
+	ExecuteAsyncSearch(ctx context.Context, r *SearchRequest) (*SearchResponse, error)
 	ExecutePPLQuery(ctx context.Context, r *PPLRequest) (*PPLResponse, error)
 	PPL() *PPLRequestBuilder
+	ExecuteSQLQuery(ctx context.Context, r *SQLRequest) (*SQLResponse, error)
+	SQL() *SQLRequestBuilder
 	EnableDebug()
 }
 
@@ -94,8 +103,7 @@ func ExtractVersion(v *simplejson.Json) (*semver.Version, error) {
 }
 
 // NewClient creates a new OpenSearch client
-func NewClient(ctx context.Context, ds *backend.DataSourceInstanceSettings, httpClient *http.Client,
-	timeRange *backend.TimeRange) (Client, error) {
+func NewClient(ctx context.Context, ds *backend.DataSourceInstanceSettings, httpClient *http.Client) (Client, error) {
 	jsonDataStr := ds.JSONData
 	jsonData, err := simplejson.NewJson([]byte(jsonDataStr))
 	if err != nil {
@@ -130,11 +138,9 @@ func NewClient(ctx context.Context, ds *backend.DataSourceInstanceSettings, http
 		return nil, err
 	}
 
-	indices := ip.GetIndices(timeRange)
-
 	index := ip.GetPPLIndex()
 
-	clientLog.Info("Creating new client", "version", version.String(), "timeField", timeField, "indices", strings.Join(indices, ", "), "PPL index", index)
+	clientLog.Info("Creating new client", "version", version.String(), "timeField", timeField, "database", db, "PPL index", index)
 
 	return &baseClientImpl{
 		ctx:        ctx,
@@ -147,9 +153,8 @@ func NewClient(ctx context.Context, ds *backend.DataSourceInstanceSettings, http
 			LogMessageField: logMessageField,
 			LogLevelField:   logLevelField,
 		},
-		indices:   indices,
-		index:     index,
-		timeRange: timeRange,
+		indexPattern: ip,
+		index:        index,
 	}, nil
 }
 
@@ -160,9 +165,8 @@ type baseClientImpl struct {
 	flavor           Flavor
 	version          *semver.Version
 	configuredFields ConfiguredFields
-	indices          []string
+	indexPattern     indexPattern
 	index            string
-	timeRange        *backend.TimeRange
 	debugEnabled     bool
 }
 
@@ -257,6 +261,64 @@ func parseNumberOfShards(body []byte) (int, error) {
 	return max, nil
 }
 
+// GetFieldTypes returns the mapping types of every field of the indices matched by
+// index, which is an index, a pattern or a comma separated list of them, such as
+// the one returned by SearchIndex. A field mapped differently in some of the
+// indices has several types.
+func (c *baseClientImpl) GetFieldTypes(ctx context.Context, index string) (map[string][]string, error) {
+	if index == "" {
+		return nil, fmt.Errorf("cannot look up field types for an empty index")
+	}
+
+	uriPath := path.Join(index, "_field_caps")
+	res, err := c.executeRequest(ctx, http.MethodGet, uriPath, "fields=*&ignore_unavailable=true&allow_no_indices=true", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp := res.httpResponse
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			clientLog.Error("failed to close http response body", "error", err)
+		}
+	}()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("unexpected status code %d looking up field types for %q", resp.StatusCode, index)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseFieldTypes(body)
+}
+
+// parseFieldTypes extracts the sorted types of every field from a _field_caps
+// response, which is keyed by field name and then by type:
+//
+//	{"fields":{"status":{"keyword":{"type":"keyword"}},"bytes":{"long":{"type":"long"},"float":{"type":"float"}}}}
+func parseFieldTypes(body []byte) (map[string][]string, error) {
+	var caps struct {
+		Fields map[string]map[string]json.RawMessage `json:"fields"`
+	}
+	if err := json.Unmarshal(body, &caps); err != nil {
+		return nil, fmt.Errorf("failed to parse field capabilities: %w", err)
+	}
+	if caps.Fields == nil {
+		return nil, fmt.Errorf("no fields found in field capabilities response")
+	}
+
+	types := make(map[string][]string, len(caps.Fields))
+	for field, byType := range caps.Fields {
+		fieldTypes := make([]string, 0, len(byType))
+		for t := range byType {
+			fieldTypes = append(fieldTypes, t)
+		}
+		sort.Strings(fieldTypes)
+		types[field] = fieldTypes
+	}
+	return types, nil
+}
+
 func (c *baseClientImpl) getSettings() *simplejson.Json {
 	settings, _ := simplejson.NewJson(c.ds.JSONData)
 	return settings
@@ -268,42 +330,51 @@ type multiRequest struct {
 	interval tsdb.Interval
 }
 
-func (c *baseClientImpl) executeBatchRequest(ctx context.Context, uriPath, uriQuery string, requests []*multiRequest) (*response, error) {
-	bytes, err := c.encodeBatchRequests(requests)
+func (c *baseClientImpl) executeBatchRequest(ctx context.Context, uriPath, uriQuery string, requests []*multiRequest) (*response, []string, error) {
+	payload, encoded, err := c.encodeBatchRequests(requests)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return c.executeRequest(ctx, http.MethodPost, uriPath, uriQuery, bytes)
+	res, err := c.executeRequest(ctx, http.MethodPost, uriPath, uriQuery, payload)
+	return res, encoded, err
 }
 
-func (c *baseClientImpl) encodeBatchRequests(requests []*multiRequest) ([]byte, error) {
+// encodeBatchRequests returns the payload of the requests, and the header and body
+// lines of every request in it
+func (c *baseClientImpl) encodeBatchRequests(requests []*multiRequest) ([]byte, []string, error) {
 	clientLog.Debug("Encoding batch requests to json", "batch requests", len(requests))
 	start := time.Now()
 
 	payload := bytes.Buffer{}
+	encoded := make([]string, 0, len(requests))
 	for _, r := range requests {
 		reqHeader, err := json.Marshal(r.header)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		payload.WriteString(string(reqHeader) + "\n")
 
 		reqBody, err := json.Marshal(r.body)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
-		body := string(reqBody)
-		body = strings.ReplaceAll(body, "$__interval_ms", strconv.FormatInt(r.interval.Milliseconds(), 10))
-		body = strings.ReplaceAll(body, "$__interval", r.interval.Text)
+		body := replaceIntervalVariables(string(reqBody), r.interval)
 
-		payload.WriteString(body + "\n")
+		lines := string(reqHeader) + "\n" + body
+		payload.WriteString(lines + "\n")
+		encoded = append(encoded, lines)
 	}
 
 	elapsed := time.Since(start)
 	clientLog.Debug("Encoded batch requests to json", "took", elapsed)
 
-	return payload.Bytes(), nil
+	return payload.Bytes(), encoded, nil
+}
+
+func replaceIntervalVariables(body string, interval tsdb.Interval) string {
+	body = strings.ReplaceAll(body, fixedIntervalVariable, strconv.FormatInt(interval.Milliseconds(), 10)+"ms")
+	body = strings.ReplaceAll(body, "$__interval_ms", strconv.FormatInt(interval.Milliseconds(), 10))
+	return strings.ReplaceAll(body, "$__interval", interval.Text)
 }
 
 func (c *baseClientImpl) executeRequest(ctx context.Context, method, uriPath, uriQuery string, body []byte) (*response, error) {
@@ -315,8 +386,8 @@ func (c *baseClientImpl) executeRequest(ctx context.Context, method, uriPath, ur
 	u.RawQuery = uriQuery
 
 	var req *http.Request
-	if method == http.MethodPost {
-		req, err = http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewBuffer(body))
+	if method == http.MethodPost || method == http.MethodDelete {
+		req, err = http.NewRequestWithContext(ctx, method, u.String(), bytes.NewBuffer(body))
 	} else {
 		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
 	}
@@ -387,7 +458,7 @@ func (c *baseClientImpl) ExecuteMultisearch(ctx context.Context, r *MultiSearchR
 
 	multiRequests := c.createMultiSearchRequests(r.Requests)
 	queryParams := c.getMultiSearchQueryParameters()
-	clientRes, err := c.executeBatchRequest(ctx, "_msearch", queryParams, multiRequests)
+	clientRes, encoded, err := c.executeBatchRequest(ctx, "_msearch", queryParams, multiRequests)
 	if err != nil {
 		return nil, err
 	}
@@ -407,21 +478,15 @@ func (c *baseClientImpl) ExecuteMultisearch(ctx context.Context, r *MultiSearchR
 	start := time.Now()
 	clientLog.Debug("Decoding multisearch json response")
 
-	var bodyBytes []byte
+	// In debug mode the body is kept to be shown as it was read, instead of reading
+	// all of it before decoding and buffering it twice
+	body := io.Reader(res.Body)
+	var bodyBytes bytes.Buffer
 	if c.debugEnabled {
-		tmpBytes, err := io.ReadAll(res.Body)
-		if err != nil {
-			clientLog.Error("failed to read http response bytes", "error", err)
-		} else {
-			bodyBytes = make([]byte, len(tmpBytes))
-			copy(bodyBytes, tmpBytes)
-			res.Body = io.NopCloser(bytes.NewBuffer(tmpBytes))
-		}
+		body = io.TeeReader(res.Body, &bodyBytes)
 	}
 
-	var msr MultiSearchResponse
-	dec := json.NewDecoder(res.Body)
-	err = dec.Decode(&msr)
+	msr, err := decodeMultiSearchResponse(body)
 	if err != nil {
 		return nil, fmt.Errorf("error while Decoding to MultiSearchResponse: %w", err)
 	}
@@ -430,9 +495,14 @@ func (c *baseClientImpl) ExecuteMultisearch(ctx context.Context, r *MultiSearchR
 	clientLog.Debug("Decoded multisearch json response", "took", elapsed)
 
 	msr.Status = res.StatusCode
+	for i, lines := range encoded {
+		if i < len(msr.Responses) && msr.Responses[i] != nil {
+			msr.Responses[i].ExecutedRequest = lines
+		}
+	}
 
 	if c.debugEnabled {
-		bodyJSON, err := simplejson.NewFromReader(bytes.NewBuffer(bodyBytes))
+		bodyJSON, err := simplejson.NewFromReader(&bodyBytes)
 		var data *simplejson.Json
 		if err != nil {
 			clientLog.Error("failed to decode http response into json", "error", err)
@@ -449,26 +519,28 @@ func (c *baseClientImpl) ExecuteMultisearch(ctx context.Context, r *MultiSearchR
 		}
 	}
 
-	return &msr, nil
+	return msr, nil
 }
 
 func (c *baseClientImpl) createMultiSearchRequests(searchRequests []*SearchRequest) []*multiRequest {
 	multiRequests := []*multiRequest{}
 
 	for _, searchReq := range searchRequests {
-		indexStr := strings.Join(c.indices, ",")
-		if searchReq.IndexOverride != "" {
-			indexStr = searchReq.IndexOverride
-		}
 		mr := multiRequest{
 			header: map[string]interface{}{
 				"search_type":        "query_then_fetch",
 				"ignore_unavailable": true,
-				"index":              indexStr,
+				"index":              c.searchIndex(searchReq),
 			},
 			body:     searchReq,
 			interval: searchReq.Interval,
 		}
+		// a point in time already determines the indices searched, and both
+		// OpenSearch and Elasticsearch reject searches that set them again
+		if searchReq.PointInTime != nil {
+			delete(mr.header, "index")
+			delete(mr.header, "ignore_unavailable")
+		}
 
 		if c.flavor == Elasticsearch {
 			if c.version.Major() < 5 {
@@ -492,6 +564,251 @@ func (c *baseClientImpl) createMultiSearchRequests(searchRequests []*SearchReque
 	return multiRequests
 }
 
+// searchIndex returns the indices a search request targets. Indices are
+// generated per search so each query uses its own time range.
+func (c *baseClientImpl) searchIndex(searchReq *SearchRequest) string {
+	return c.SearchIndex(searchReq.IndexOverride, searchReq.TimeRange)
+}
+
+// SearchIndex returns the indices searched for the index of a query, or for the
+// index pattern of the datasource in timeRange when the query has none, as a comma
+// separated list
+func (c *baseClientImpl) SearchIndex(index string, timeRange backend.TimeRange) string {
+	if index != "" {
+		return index
+	}
+	return strings.Join(c.indexPattern.GetIndices(&timeRange), ",")
+}
+
+// ErrPointInTimeNotSupported is returned by OpenPointInTime when the cluster
+// can't create points in time. Callers can still page with search_after alone.
+var ErrPointInTimeNotSupported = errors.New("point in time is not supported")
+
+// supportsPointInTime reports whether points in time can be created, which
+// requires OpenSearch 2.4 or Elasticsearch 7.10. Serverless collections don't
+// support them.
+func (c *baseClientImpl) supportsPointInTime() bool {
+	if c.getSettings().Get("serverless").MustBool(false) {
+		return false
+	}
+	minVersion := semver.MustParse("2.4.0")
+	if c.flavor == Elasticsearch {
+		minVersion = semver.MustParse("7.10.0")
+	}
+	return !c.version.LessThan(minVersion)
+}
+
+// OpenPointInTime creates a point in time on the indices targeted by r and
+// returns its id
+func (c *baseClientImpl) OpenPointInTime(ctx context.Context, r *SearchRequest, keepAlive string) (string, error) {
+	if !c.supportsPointInTime() {
+		return "", ErrPointInTimeNotSupported
+	}
+
+	uriPath := path.Join(c.searchIndex(r), "_search", "point_in_time")
+	uriQuery := url.Values{"keep_alive": []string{keepAlive}}
+	if c.flavor == Elasticsearch {
+		uriPath = path.Join(c.searchIndex(r), "_pit")
+		uriQuery.Set("ignore_unavailable", "true")
+	}
+
+	res, err := c.executeRequest(ctx, http.MethodPost, uriPath, uriQuery.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp := res.httpResponse
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			clientLog.Error("failed to close http response body", "error", err)
+		}
+	}()
+	if resp.StatusCode >= 400 {
+		return "", backend.NewErrorWithSource(fmt.Errorf("unexpected status code %d creating point in time", resp.StatusCode), backend.ErrorSourceFromHTTPStatus(resp.StatusCode))
+	}
+
+	// OpenSearch returns the id as "pit_id", Elasticsearch as "id"
+	var pit struct {
+		PitID string `json:"pit_id"`
+		ID    string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&pit); err != nil {
+		return "", fmt.Errorf("failed to decode point in time response: %w", err)
+	}
+	if pit.PitID != "" {
+		return pit.PitID, nil
+	}
+	if pit.ID != "" {
+		return pit.ID, nil
+	}
+	return "", errors.New("point in time response did not contain an id")
+}
+
+// ClosePointInTime deletes a point in time created by OpenPointInTime
+func (c *baseClientImpl) ClosePointInTime(ctx context.Context, id string) error {
+	uriPath := path.Join("_search", "point_in_time")
+	var body interface{} = map[string]interface{}{"pit_id": []string{id}}
+	if c.flavor == Elasticsearch {
+		uriPath = "_pit"
+		body = map[string]interface{}{"id": id}
+	}
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.executeRequest(ctx, http.MethodDelete, uriPath, "", reqBody)
+	if err != nil {
+		return err
+	}
+	resp := res.httpResponse
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			clientLog.Error("failed to close http response body", "error", err)
+		}
+	}()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status code %d deleting point in time", resp.StatusCode)
+	}
+	return nil
+}
+
+// ErrAsyncSearchNotSupported is returned by ExecuteAsyncSearch when the cluster
+// has no asynchronous search API. Callers can still use a multisearch.
+var ErrAsyncSearchNotSupported = errors.New("asynchronous search is not supported")
+
+const (
+	// asyncSearchWaitTimeout is how long the submit request waits for the search
+	// to complete, short enough for proxies with idle timeouts
+	asyncSearchWaitTimeout = "1s"
+	// asyncSearchKeepAlive only needs to cover the time between two polls, it is
+	// extended by every poll
+	asyncSearchKeepAlive = "5m"
+)
+
+// asyncSearchPollInterval is the time between two polls of a running asynchronous search
+var asyncSearchPollInterval = time.Second
+
+// asyncSearchResponse is the response of the OpenSearch asynchronous search API
+type asyncSearchResponse struct {
+	ID       string                 `json:"id"`
+	State    string                 `json:"state"`
+	Response *SearchResponse        `json:"response"`
+	Error    map[string]interface{} `json:"error"`
+}
+
+// running reports whether the search is still executing, its response is only
+// partial then
+func (r *asyncSearchResponse) running() bool {
+	return r.State == "INIT" || r.State == "RUNNING"
+}
+
+// supportsAsyncSearch reports whether the asynchronous search plugin API can be
+// used. Elasticsearch and serverless collections don't provide it.
+func (c *baseClientImpl) supportsAsyncSearch() bool {
+	return c.flavor == OpenSearch && !c.getSettings().Get("serverless").MustBool(false)
+}
+
+// ExecuteAsyncSearch submits r with the asynchronous search API and polls it until
+// it completes or ctx is done, so no single HTTP request stays open for the whole
+// search. The search is deleted afterwards.
+func (c *baseClientImpl) ExecuteAsyncSearch(ctx context.Context, r *SearchRequest) (*SearchResponse, error) {
+	if !c.supportsAsyncSearch() {
+		return nil, ErrAsyncSearchNotSupported
+	}
+	clientLog.Debug("Executing asynchronous search")
+
+	body, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	body = []byte(replaceIntervalVariables(string(body), r.Interval))
+
+	uriQuery := url.Values{
+		"ignore_unavailable":          []string{"true"},
+		"wait_for_completion_timeout": []string{asyncSearchWaitTimeout},
+		"keep_on_completion":          []string{"true"},
+		"keep_alive":                  []string{asyncSearchKeepAlive},
+	}
+	res, err := c.executeAsyncSearchRequest(ctx, http.MethodPost, path.Join(c.searchIndex(r), "_plugins", "_asynchronous_search"), uriQuery.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	id := res.ID
+	if id != "" {
+		defer func() {
+			if err := c.deleteAsyncSearch(context.WithoutCancel(ctx), id); err != nil {
+				clientLog.Warn("Failed to delete asynchronous search", "id", id, "error", err)
+			}
+		}()
+	}
+
+	pollQuery := url.Values{"keep_alive": []string{asyncSearchKeepAlive}}.Encode()
+	for res.running() && res.Error == nil {
+		select {
+		case <-ctx.Done():
+		case <-time.After(asyncSearchPollInterval):
+			res, err = c.executeAsyncSearchRequest(ctx, http.MethodGet, path.Join("_plugins", "_asynchronous_search", id), pollQuery, nil)
+		}
+		if ctx.Err() != nil {
+			return nil, backend.DownstreamError(fmt.Errorf("asynchronous search %s did not complete: %w", id, ctx.Err()))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// let the response parser report the error of the search, as for a multisearch
+	if res.Error != nil {
+		return &SearchResponse{Error: res.Error, ExecutedRequest: string(body)}, nil
+	}
+	if res.Response == nil {
+		return nil, fmt.Errorf("asynchronous search %s ended in state %s without a response", id, res.State)
+	}
+	res.Response.ExecutedRequest = string(body)
+	return res.Response, nil
+}
+
+func (c *baseClientImpl) executeAsyncSearchRequest(ctx context.Context, method, uriPath, uriQuery string, body []byte) (*asyncSearchResponse, error) {
+	res, err := c.executeRequest(ctx, method, uriPath, uriQuery, body)
+	if err != nil {
+		return nil, err
+	}
+	resp := res.httpResponse
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			clientLog.Error("failed to close http response body", "error", err)
+		}
+	}()
+	clientLog.Debug("Received asynchronous search response", "code", resp.StatusCode, "status", resp.Status)
+	if resp.StatusCode >= 400 {
+		return nil, backend.NewErrorWithSource(fmt.Errorf("unexpected status code %d executing asynchronous search", resp.StatusCode), backend.ErrorSourceFromHTTPStatus(resp.StatusCode))
+	}
+
+	var asr asyncSearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&asr); err != nil {
+		return nil, fmt.Errorf("failed to decode asynchronous search response: %w", err)
+	}
+	return &asr, nil
+}
+
+func (c *baseClientImpl) deleteAsyncSearch(ctx context.Context, id string) error {
+	res, err := c.executeRequest(ctx, http.MethodDelete, path.Join("_plugins", "_asynchronous_search", id), "", nil)
+	if err != nil {
+		return err
+	}
+	resp := res.httpResponse
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			clientLog.Error("failed to close http response body", "error", err)
+		}
+	}()
+	// the search is gone already when it expired
+	if resp.StatusCode >= 400 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("unexpected status code %d deleting asynchronous search", resp.StatusCode)
+	}
+	return nil
+}
+
 func (c *baseClientImpl) getMultiSearchQueryParameters() string {
 	if c.version.Major() >= 7 || c.flavor == OpenSearch {
 		maxConcurrentShardRequests := c.getSettings().Get("maxConcurrentShardRequests").MustInt(5)
@@ -627,7 +944,27 @@ func (c *baseClientImpl) ExecutePPLQuery(ctx context.Context, r *PPLRequest) (*P
 	if c.GetFlavor() == Elasticsearch {
 		pplUrl = "_opendistro/_ppl"
 	}
-	clientRes, err := c.executePPLRequest(ctx, pplUrl, req)
+	return c.executeJDBCRequest(ctx, pplUrl, req)
+}
+
+func (c *baseClientImpl) ExecuteSQLQuery(ctx context.Context, r *SQLRequest) (*SQLResponse, error) {
+	clientLog.Debug("Executing SQL")
+
+	req := &pplRequest{
+		body: r,
+	}
+
+	sqlUrl := "_plugins/_sql"
+	if c.GetFlavor() == Elasticsearch {
+		sqlUrl = "_opendistro/_sql"
+	}
+	return c.executeJDBCRequest(ctx, sqlUrl, req)
+}
+
+// executeJDBCRequest executes a PPL or SQL request and decodes the response,
+// which both plugins return in the JDBC format
+func (c *baseClientImpl) executeJDBCRequest(ctx context.Context, uriPath string, req *pplRequest) (*PPLResponse, error) {
+	clientRes, err := c.executePPLRequest(ctx, uriPath, req)
 	if err != nil {
 		return nil, err
 	}
@@ -638,10 +975,10 @@ func (c *baseClientImpl) ExecutePPLQuery(ctx context.Context, r *PPLRequest) (*P
 		}
 	}()
 
-	clientLog.Debug("Received PPL response", "code", resp.StatusCode, "status", resp.Status, "content-length", resp.ContentLength)
+	clientLog.Debug("Received JDBC response", "code", resp.StatusCode, "status", resp.Status, "content-length", resp.ContentLength)
 
 	start := time.Now()
-	clientLog.Debug("Decoding PPL json response")
+	clientLog.Debug("Decoding JDBC json response")
 
 	var bodyBytes []byte
 	if c.debugEnabled {
@@ -663,7 +1000,7 @@ func (c *baseClientImpl) ExecutePPLQuery(ctx context.Context, r *PPLRequest) (*P
 	}
 
 	elapsed := time.Since(start)
-	clientLog.Debug("Decoded PPL json response", "took", elapsed)
+	clientLog.Debug("Decoded JDBC json response", "took", elapsed)
 
 	pr.Status = resp.StatusCode
 
@@ -696,3 +1033,7 @@ func createPPLRequest(request *PPLRequest) *pplRequest {
 func (c *baseClientImpl) PPL() *PPLRequestBuilder {
 	return NewPPLRequestBuilder(c.GetIndex())
 }
+
+func (c *baseClientImpl) SQL() *SQLRequestBuilder {
+	return NewSQLRequestBuilder(c.GetIndex())
+}
@@ -35,7 +35,7 @@ func TestClient(t *testing.T) {
 				ds := &backend.DataSourceInstanceSettings{
 					JSONData: utils.NewRawJsonFromAny(make(map[string]interface{})),
 				}
-				_, err := NewClient(context.Background(), ds, &http.Client{}, nil)
+				_, err := NewClient(context.Background(), ds, &http.Client{})
 				assert.Error(t, err)
 			})
 
@@ -46,7 +46,7 @@ func TestClient(t *testing.T) {
 					}),
 				}
 
-				_, err := NewClient(context.Background(), ds, &http.Client{}, nil)
+				_, err := NewClient(context.Background(), ds, &http.Client{})
 				assert.Error(t, err)
 			})
 
@@ -58,7 +58,7 @@ func TestClient(t *testing.T) {
 					}),
 				}
 
-				_, err := NewClient(context.Background(), ds, &http.Client{}, nil)
+				_, err := NewClient(context.Background(), ds, &http.Client{})
 				assert.Error(t, err)
 			})
 		})
@@ -114,8 +114,13 @@ func TestClient(t *testing.T) {
 						assert.Equal(t, "15000*@hostname", jBody.GetPath("aggs", "2", "aggs", "1", "avg", "script").MustString())
 					})
 
-					t.Run("and replace $__interval_ms variable", func(t *testing.T) {
-						assert.Equal(t, "15s", jBody.GetPath("aggs", "2", "date_histogram", "interval").MustString())
+					t.Run("and replace $__fixed_interval variable", func(t *testing.T) {
+						assert.Equal(t, "15000ms", jBody.GetPath("aggs", "2", "date_histogram", "fixed_interval").MustString())
+					})
+
+					t.Run("and return the lines of the search with its response", func(t *testing.T) {
+						require.Len(t, res.Responses, 1)
+						assert.Equal(t, string(headerBytes)+string(bodyBytes), res.Responses[0].ExecutedRequest+"\n")
 					})
 				})
 
@@ -250,11 +255,68 @@ func TestClient(t *testing.T) {
 			})
 		})
 	})
+
+	t.Run("Test SQL opensearch client", func(t *testing.T) {
+		for _, tc := range []struct {
+			flavor  string
+			version string
+			path    string
+		}{
+			{flavor: "opensearch", version: "1.0.0", path: "/_plugins/_sql"},
+			{flavor: "elasticsearch", version: "7.0.0", path: "/_opendistro/_sql"},
+		} {
+			httpClientScenario(t, "Given a fake http client and a "+tc.flavor+" client with SQL response", &backend.DataSourceInstanceSettings{
+				JSONData: utils.NewRawJsonFromAny(map[string]interface{}{
+					"flavor":    tc.flavor,
+					"version":   tc.version,
+					"timeField": "@timestamp",
+					"interval":  "Daily",
+					"database":  "[metrics-]YYYY.MM.DD",
+				}),
+			}, func(sc *scenarioContext) {
+				sc.responseBody = `{
+					"schema": [{"name": "count(*)", "type": "integer"}, {"name": "timestamp", "type": "timestamp"}],
+					"datarows":  [
+						[1, "2020-12-01 00:39:02.912"],
+						[2, "2020-12-01 03:26:21.326"]
+					],
+					"total": 2,
+					"size": 2,
+					"status": 200
+				}`
+
+				sql, err := sc.client.SQL().AddSQLQueryString("@timestamp", "$timeTo", "$timeFrom", "").Build()
+				assert.NoError(t, err)
+				res, err := sc.client.ExecuteSQLQuery(context.Background(), sql)
+				assert.NoError(t, err)
+
+				t.Run("Should send correct request and payload", func(t *testing.T) {
+					assert.NotNil(t, sc.request)
+					assert.Equal(t, http.MethodPost, sc.request.Method)
+					assert.Equal(t, tc.path, sc.request.URL.Path)
+					assert.Equal(t, "application/json", sc.request.Header.Get("Content-Type"))
+
+					jBody, err := simplejson.NewJson(sc.requestBody.Bytes())
+					assert.NoError(t, err)
+					assert.Equal(t, "SELECT * FROM `metrics-*` WHERE `@timestamp` >= timestamp('$timeFrom') and `@timestamp` <= timestamp('$timeTo')", jBody.Get("query").MustString())
+				})
+				t.Run("Should parse response", func(t *testing.T) {
+					assert.Len(t, res.Schema, 2)
+					assert.Len(t, res.Datarows, 2)
+					assert.Equal(t, 200, res.Status)
+				})
+			})
+		}
+	})
 }
 
 func createMultisearchForTest(c Client) (*MultiSearchRequest, error) {
+	from := time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC)
+	to := time.Date(2018, 5, 15, 17, 55, 0, 0, time.UTC)
+	timeRange := backend.TimeRange{From: from, To: to}
+
 	msb := c.MultiSearch()
-	s := msb.Search(tsdb.Interval{Value: 15 * time.Second, Text: "15s"})
+	s := msb.Search(tsdb.Interval{Value: 15 * time.Second, Text: "15s"}, timeRange)
 	s.Agg().DateHistogram("2", "@timestamp", func(a *DateHistogramAgg, ab AggBuilder) {
 		a.Interval = "$__interval"
 
@@ -303,11 +365,7 @@ func httpClientScenario(t *testing.T, desc string, ds *backend.DataSourceInstanc
 		}))
 		ds.URL = ts.URL
 
-		from := time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC)
-		to := time.Date(2018, 5, 15, 17, 55, 0, 0, time.UTC)
-		timeRange := &backend.TimeRange{From: from, To: to}
-
-		c, err := NewClient(context.Background(), ds, &http.Client{}, timeRange)
+		c, err := NewClient(context.Background(), ds, &http.Client{})
 		assert.NoError(t, err)
 		assert.NotNil(t, c)
 		sc.client = c
@@ -547,3 +605,207 @@ func Test_newDatasourceHttpClient_sets_aoss_as_service_name_for_serverless(t *te
 	_, err = client.Get(server.URL)
 	assert.NoError(t, err)
 }
+
+func Test_point_in_time(t *testing.T) {
+	jsonData := func(flavor, version string) jsonEncoding.RawMessage {
+		return utils.NewRawJsonFromAny(map[string]interface{}{
+			"flavor":    flavor,
+			"version":   version,
+			"timeField": "@timestamp",
+			"interval":  "Daily",
+			"database":  "[metrics-]YYYY.MM.DD",
+		})
+	}
+	timeRange := backend.TimeRange{
+		From: time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC),
+		To:   time.Date(2018, 5, 15, 17, 55, 0, 0, time.UTC),
+	}
+
+	httpClientScenario(t, "OpenSearch opens a point in time on the search indices", &backend.DataSourceInstanceSettings{
+		JSONData: jsonData("opensearch", "2.11.0"),
+	}, func(sc *scenarioContext) {
+		sc.responseBody = `{"pit_id": "os-pit", "creation_time": 1}`
+		id, err := sc.client.OpenPointInTime(context.Background(), &SearchRequest{TimeRange: timeRange}, "1m")
+		require.NoError(t, err)
+		assert.Equal(t, "os-pit", id)
+		assert.Equal(t, http.MethodPost, sc.request.Method)
+		assert.Equal(t, "/metrics-2018.05.15/_search/point_in_time", sc.request.URL.Path)
+		assert.Equal(t, "1m", sc.request.URL.Query().Get("keep_alive"))
+
+		sc.responseBody = `{"pits": [{"pit_id": "os-pit", "successful": true}]}`
+		require.NoError(t, sc.client.ClosePointInTime(context.Background(), "os-pit"))
+		assert.Equal(t, http.MethodDelete, sc.request.Method)
+		assert.Equal(t, "/_search/point_in_time", sc.request.URL.Path)
+		assert.JSONEq(t, `{"pit_id": ["os-pit"]}`, sc.requestBody.String())
+	})
+
+	httpClientScenario(t, "Elasticsearch opens a point in time with the _pit API", &backend.DataSourceInstanceSettings{
+		JSONData: jsonData("elasticsearch", "7.10.0"),
+	}, func(sc *scenarioContext) {
+		sc.responseBody = `{"id": "es-pit"}`
+		id, err := sc.client.OpenPointInTime(context.Background(), &SearchRequest{TimeRange: timeRange, IndexOverride: "logs-*"}, "1m")
+		require.NoError(t, err)
+		assert.Equal(t, "es-pit", id)
+		assert.Equal(t, "/logs-*/_pit", sc.request.URL.Path)
+
+		sc.responseBody = `{"succeeded": true}`
+		require.NoError(t, sc.client.ClosePointInTime(context.Background(), "es-pit"))
+		assert.Equal(t, "/_pit", sc.request.URL.Path)
+		assert.JSONEq(t, `{"id": "es-pit"}`, sc.requestBody.String())
+	})
+
+	httpClientScenario(t, "Older versions do not support points in time", &backend.DataSourceInstanceSettings{
+		JSONData: jsonData("opensearch", "2.3.0"),
+	}, func(sc *scenarioContext) {
+		_, err := sc.client.OpenPointInTime(context.Background(), &SearchRequest{TimeRange: timeRange}, "1m")
+		assert.ErrorIs(t, err, ErrPointInTimeNotSupported)
+		assert.Nil(t, sc.request)
+	})
+
+	httpClientScenario(t, "Searches within a point in time do not set the indices", &backend.DataSourceInstanceSettings{
+		JSONData: jsonData("opensearch", "2.11.0"),
+	}, func(sc *scenarioContext) {
+		sc.responseBody = `{"responses": [{"hits": {"hits": []}, "pit_id": "os-pit-2"}]}`
+		req := &SearchRequest{
+			TimeRange:   timeRange,
+			Size:        2,
+			PointInTime: &PointInTime{ID: "os-pit", KeepAlive: "1m"},
+			SearchAfter: []interface{}{1526406600000, 3},
+		}
+		res, err := sc.client.ExecuteMultisearch(context.Background(), &MultiSearchRequest{Requests: []*SearchRequest{req}})
+		require.NoError(t, err)
+		assert.Equal(t, "os-pit-2", res.Responses[0].PitID)
+
+		headerBytes, err := sc.requestBody.ReadBytes('\n')
+		require.NoError(t, err)
+		header, err := simplejson.NewJson(headerBytes)
+		require.NoError(t, err)
+		_, hasIndex := header.CheckGet("index")
+		assert.False(t, hasIndex)
+		_, hasIgnoreUnavailable := header.CheckGet("ignore_unavailable")
+		assert.False(t, hasIgnoreUnavailable)
+
+		body, err := simplejson.NewJson(sc.requestBody.Bytes())
+		require.NoError(t, err)
+		assert.Equal(t, "os-pit", body.GetPath("pit", "id").MustString())
+		assert.Equal(t, "1m", body.GetPath("pit", "keep_alive").MustString())
+		assert.Equal(t, []interface{}{jsonEncoding.Number("1526406600000"), jsonEncoding.Number("3")}, body.Get("search_after").MustArray())
+	})
+}
+
+func Test_async_search(t *testing.T) {
+	asyncSearchPollInterval = time.Millisecond
+	t.Cleanup(func() { asyncSearchPollInterval = time.Second })
+	timeRange := backend.TimeRange{
+		From: time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC),
+		To:   time.Date(2018, 5, 15, 17, 55, 0, 0, time.UTC),
+	}
+
+	// asyncSearchScenario serves the given responses one after another and
+	// records the requests
+	asyncSearchScenario := func(t *testing.T, flavor string, responses ...string) (Client, *[]*http.Request, *[]string) {
+		t.Helper()
+		var requests []*http.Request
+		var bodies []string
+		ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			buf, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			requests = append(requests, r)
+			bodies = append(bodies, string(buf))
+			if r.Method == http.MethodDelete {
+				_, err = rw.Write([]byte(`{"acknowledged": true}`))
+				require.NoError(t, err)
+				return
+			}
+			// the last response is repeated
+			response := responses[0]
+			if len(responses) > 1 {
+				responses = responses[1:]
+			}
+			_, err = rw.Write([]byte(response))
+			require.NoError(t, err)
+		}))
+		t.Cleanup(ts.Close)
+
+		c, err := NewClient(context.Background(), &backend.DataSourceInstanceSettings{
+			URL: ts.URL,
+			JSONData: utils.NewRawJsonFromAny(map[string]interface{}{
+				"flavor":    flavor,
+				"version":   "2.11.0",
+				"timeField": "@timestamp",
+				"interval":  "Daily",
+				"database":  "[metrics-]YYYY.MM.DD",
+			}),
+		}, &http.Client{})
+		require.NoError(t, err)
+		return c, &requests, &bodies
+	}
+
+	t.Run("polls a running search until it completes and deletes it", func(t *testing.T) {
+		c, requests, bodies := asyncSearchScenario(t, "opensearch",
+			`{"id": "search-1", "state": "RUNNING"}`,
+			`{"id": "search-1", "state": "RUNNING"}`,
+			`{"id": "search-1", "state": "SUCCEEDED", "response": {"hits": {"hits": [{"_id": "1"}], "total": {"value": 1, "relation": "eq"}}}}`,
+		)
+
+		res, err := c.ExecuteAsyncSearch(context.Background(), &SearchRequest{
+			TimeRange: timeRange,
+			Interval:  tsdb.Interval{Text: "15s", Value: 15 * time.Second},
+			Size:      10,
+			Aggs:      AggArray{{Key: "2", Aggregation: &AggContainer{Type: "date_histogram", Aggregation: map[string]interface{}{"fixed_interval": "$__interval"}}}},
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Hits.Hits, 1)
+
+		require.Len(t, *requests, 4)
+		submit := (*requests)[0]
+		assert.Equal(t, http.MethodPost, submit.Method)
+		assert.Equal(t, "/metrics-2018.05.15/_plugins/_asynchronous_search", submit.URL.Path)
+		assert.Equal(t, "true", submit.URL.Query().Get("keep_on_completion"))
+		assert.Equal(t, asyncSearchWaitTimeout, submit.URL.Query().Get("wait_for_completion_timeout"))
+		assert.Contains(t, (*bodies)[0], `"fixed_interval":"15s"`)
+		assert.Equal(t, (*bodies)[0], res.ExecutedRequest)
+		for _, poll := range (*requests)[1:3] {
+			assert.Equal(t, http.MethodGet, poll.Method)
+			assert.Equal(t, "/_plugins/_asynchronous_search/search-1", poll.URL.Path)
+		}
+		assert.Equal(t, http.MethodDelete, (*requests)[3].Method)
+		assert.Equal(t, "/_plugins/_asynchronous_search/search-1", (*requests)[3].URL.Path)
+	})
+
+	t.Run("returns the error of a failed search as the search response error", func(t *testing.T) {
+		c, requests, _ := asyncSearchScenario(t, "opensearch",
+			`{"id": "search-2", "state": "FAILED", "error": {"type": "search_phase_execution_exception", "reason": "all shards failed"}}`,
+		)
+
+		res, err := c.ExecuteAsyncSearch(context.Background(), &SearchRequest{TimeRange: timeRange})
+		require.NoError(t, err)
+		assert.Equal(t, "all shards failed", res.Error["reason"])
+		assert.NotEmpty(t, res.ExecutedRequest)
+		require.Len(t, *requests, 2)
+		assert.Equal(t, http.MethodDelete, (*requests)[1].Method)
+	})
+
+	t.Run("stops polling and deletes the search when the context is done", func(t *testing.T) {
+		c, requests, _ := asyncSearchScenario(t, "opensearch",
+			`{"id": "search-3", "state": "RUNNING"}`,
+		)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := c.ExecuteAsyncSearch(ctx, &SearchRequest{TimeRange: timeRange})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.True(t, backend.IsDownstreamError(err))
+		last := (*requests)[len(*requests)-1]
+		assert.Equal(t, http.MethodDelete, last.Method)
+		assert.Equal(t, "/_plugins/_asynchronous_search/search-3", last.URL.Path)
+	})
+
+	t.Run("is not supported by Elasticsearch", func(t *testing.T) {
+		c, requests, _ := asyncSearchScenario(t, "elasticsearch")
+
+		_, err := c.ExecuteAsyncSearch(context.Background(), &SearchRequest{TimeRange: timeRange})
+		assert.ErrorIs(t, err, ErrAsyncSearchNotSupported)
+		assert.Empty(t, *requests)
+	})
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/opensearch-datasource/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFieldTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected map[string][]string
+		wantErr  bool
+	}{
+		{
+			name: "one type per field",
+			body: `{"indices":["logs-1"],"fields":{"status":{"keyword":{"type":"keyword","searchable":true}},"@timestamp":{"date":{"type":"date"}}}}`,
+			expected: map[string][]string{
+				"status":     {"keyword"},
+				"@timestamp": {"date"},
+			},
+		},
+		{
+			name: "field mapped differently across indices has sorted types",
+			body: `{"fields":{"bytes":{"long":{"type":"long"},"float":{"type":"float"},"keyword":{"type":"keyword"}}}}`,
+			expected: map[string][]string{
+				"bytes": {"float", "keyword", "long"},
+			},
+		},
+		{
+			name:     "no fields",
+			body:     `{"indices":[],"fields":{}}`,
+			expected: map[string][]string{},
+		},
+		{
+			name:    "invalid json is an error",
+			body:    `not json`,
+			wantErr: true,
+		},
+		{
+			// The shape a mocked _msearch round tripper returns; must not parse as
+			// field types so callers fall back to typing columns by their values.
+			name:    "unrelated payload is an error",
+			body:    `{"responses":[]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			types, err := parseFieldTypes([]byte(tt.body))
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, types)
+		})
+	}
+}
+
+func TestGetFieldTypes(t *testing.T) {
+	var requests []*http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		rw.Header().Add("Content-Type", "application/json")
+		_, _ = rw.Write([]byte(`{"fields":{"level":{"keyword":{"type":"keyword"}}}}`))
+	}))
+	defer ts.Close()
+
+	ds := &backend.DataSourceInstanceSettings{
+		URL: ts.URL,
+		JSONData: utils.NewRawJsonFromAny(map[string]interface{}{
+			"version":   "2.3.0",
+			"flavor":    "opensearch",
+			"timeField": "@timestamp",
+			"database":  "[logs-]YYYY.MM.DD",
+			"interval":  "Daily",
+		}),
+	}
+
+	c, err := NewClient(context.Background(), ds, &http.Client{})
+	require.NoError(t, err)
+
+	timeRange := backend.TimeRange{
+		From: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		To:   time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC),
+	}
+
+	t.Run("looks up the given index", func(t *testing.T) {
+		requests = nil
+		types, err := c.GetFieldTypes(context.Background(), "bug-repro")
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]string{"level": {"keyword"}}, types)
+
+		require.Len(t, requests, 1)
+		assert.Equal(t, http.MethodGet, requests[0].Method)
+		assert.Equal(t, "/bug-repro/_field_caps", requests[0].URL.Path)
+		assert.Equal(t, "*", requests[0].URL.Query().Get("fields"))
+		assert.Equal(t, "true", requests[0].URL.Query().Get("ignore_unavailable"))
+	})
+
+	t.Run("looks up the indices searched in the time range", func(t *testing.T) {
+		requests = nil
+		assert.Equal(t, "bug-repro", c.SearchIndex("bug-repro", timeRange))
+		index := c.SearchIndex("", timeRange)
+		assert.Equal(t, "logs-2024.01.01,logs-2024.01.02", index)
+
+		_, err := c.GetFieldTypes(context.Background(), index)
+		require.NoError(t, err)
+
+		require.Len(t, requests, 1)
+		assert.Equal(t, "/logs-2024.01.01,logs-2024.01.02/_field_caps", requests[0].URL.Path)
+	})
+
+	t.Run("fails without an index", func(t *testing.T) {
+		requests = nil
+		_, err := c.GetFieldTypes(context.Background(), "")
+		require.Error(t, err)
+		assert.Empty(t, requests)
+	})
+
+	t.Run("is cancelled with its context", func(t *testing.T) {
+		requests = nil
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := c.GetFieldTypes(ctx, "bug-repro")
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
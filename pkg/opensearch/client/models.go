@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	simplejson "github.com/bitly/go-simplejson"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
 
 	"github.com/grafana/opensearch-datasource/pkg/tsdb"
 )
@@ -41,12 +42,33 @@ type SearchDebugInfo struct {
 // SearchRequest represents a search request
 type SearchRequest struct {
 	Interval      tsdb.Interval
+	TimeRange     backend.TimeRange
 	Size          int
 	Sort          []map[string]map[string]string
 	Query         *Query
 	Aggs          AggArray
 	CustomProps   map[string]interface{}
 	IndexOverride string
+	// PointInTime and SearchAfter are set when paging through documents
+	PointInTime *PointInTime
+	SearchAfter []interface{}
+	// Highlight is set when the terms matching the query should be highlighted
+	Highlight *Highlight
+}
+
+// Highlight requests the values of fields which match the query, with the matching
+// terms between tags
+type Highlight struct {
+	Fields       map[string]interface{} `json:"fields"`
+	PreTags      []string               `json:"pre_tags"`
+	PostTags     []string               `json:"post_tags"`
+	FragmentSize int                    `json:"fragment_size"`
+}
+
+// PointInTime references the point in time a search request is executed against
+type PointInTime struct {
+	ID        string `json:"id"`
+	KeepAlive string `json:"keep_alive,omitempty"`
 }
 
 // MarshalJSON returns the JSON encoding of the request.
@@ -68,6 +90,18 @@ func (r *SearchRequest) MarshalJSON() ([]byte, error) {
 		root["aggs"] = r.Aggs
 	}
 
+	if r.PointInTime != nil {
+		root["pit"] = r.PointInTime
+	}
+
+	if len(r.SearchAfter) > 0 {
+		root["search_after"] = r.SearchAfter
+	}
+
+	if r.Highlight != nil {
+		root["highlight"] = r.Highlight
+	}
+
 	return json.Marshal(root)
 }
 
@@ -116,6 +150,26 @@ type SearchResponse struct {
 	Error        map[string]interface{} `json:"error"`
 	Aggregations map[string]interface{} `json:"aggregations"`
 	Hits         *SearchResponseHits    `json:"hits"`
+	// PitID is the, possibly updated, point in time id of a search using one
+	PitID string `json:"pit_id"`
+	// Took is the time the search took in milliseconds
+	Took int `json:"took"`
+	// Shards, TimedOut and TerminatedEarly tell whether the results are partial
+	Shards          *SearchResponseShards `json:"_shards"`
+	TimedOut        bool                  `json:"timed_out"`
+	TerminatedEarly bool                  `json:"terminated_early"`
+	// ExecutedRequest is the search as it was sent: its header and body lines in a
+	// multisearch, or its body in an asynchronous search
+	ExecutedRequest string `json:"-"`
+}
+
+// SearchResponseShards represents the shards a search was executed on
+type SearchResponseShards struct {
+	Total      int                      `json:"total"`
+	Successful int                      `json:"successful"`
+	Skipped    int                      `json:"skipped"`
+	Failed     int                      `json:"failed"`
+	Failures   []map[string]interface{} `json:"failures"`
 }
 
 // MultiSearchRequest represents a multi search request
@@ -241,6 +295,27 @@ type RangeFilter struct {
 	Format string
 }
 
+// RangeBoundFilter represents a range search filter with a single bound, whose
+// Operator is one of gt, gte, lt or lte
+type RangeBoundFilter struct {
+	Filter
+	Key      string
+	Operator string
+	Value    int64
+	Format   string
+}
+
+// MarshalJSON returns the JSON encoding of the range bound filter.
+func (f *RangeBoundFilter) MarshalJSON() ([]byte, error) {
+	bound := map[string]interface{}{f.Operator: f.Value}
+	if f.Format != "" {
+		bound["format"] = f.Format
+	}
+	return json.Marshal(map[string]map[string]map[string]interface{}{
+		"range": {f.Key: bound},
+	})
+}
+
 // DateFormatEpochMS represents a date format of epoch milliseconds (epoch_millis)
 const DateFormatEpochMS = "epoch_millis"
 
@@ -337,13 +412,29 @@ type HistogramAgg struct {
 
 // DateHistogramAgg represents a date histogram aggregation
 type DateHistogramAgg struct {
-	Field          string          `json:"field"`
-	Interval       string          `json:"interval,omitempty"`
-	MinDocCount    int             `json:"min_doc_count"`
-	Missing        *string         `json:"missing,omitempty"`
-	ExtendedBounds *ExtendedBounds `json:"extended_bounds"`
-	Format         string          `json:"format"`
-	Offset         string          `json:"offset,omitempty"`
+	Field string `json:"field"`
+	// Interval is the legacy interval, which the builder moves to CalendarInterval
+	// or FixedInterval when the datasource supports them
+	Interval         string          `json:"interval,omitempty"`
+	CalendarInterval string          `json:"calendar_interval,omitempty"`
+	FixedInterval    string          `json:"fixed_interval,omitempty"`
+	TimeZone         string          `json:"time_zone,omitempty"`
+	MinDocCount      int             `json:"min_doc_count"`
+	Missing          *string         `json:"missing,omitempty"`
+	ExtendedBounds   *ExtendedBounds `json:"extended_bounds"`
+	Format           string          `json:"format"`
+	Offset           string          `json:"offset,omitempty"`
+}
+
+// AutoDateHistogramAgg represents an auto date histogram aggregation, which picks
+// the interval that gets closest to its number of buckets
+type AutoDateHistogramAgg struct {
+	Field           string  `json:"field"`
+	Buckets         int     `json:"buckets"`
+	MinimumInterval string  `json:"minimum_interval,omitempty"`
+	TimeZone        string  `json:"time_zone,omitempty"`
+	Missing         *string `json:"missing,omitempty"`
+	Format          string  `json:"format"`
 }
 
 // FiltersAggregation represents a filters aggregation
@@ -380,6 +471,21 @@ type TermsAggregation struct {
 	ExecutionHint *string                `json:"execution_hint,omitempty"`
 }
 
+// MultiTermsAggregation represents a multi terms aggregation, whose buckets are
+// keyed by the values of all its fields
+type MultiTermsAggregation struct {
+	Terms       []*MultiTermsSource    `json:"terms"`
+	Size        int                    `json:"size"`
+	Order       map[string]interface{} `json:"order,omitempty"`
+	MinDocCount *int                   `json:"min_doc_count,omitempty"`
+}
+
+// MultiTermsSource is a field of a multi terms aggregation
+type MultiTermsSource struct {
+	Field   string  `json:"field"`
+	Missing *string `json:"missing,omitempty"`
+}
+
 // ExtendedBounds represents extended bounds
 type ExtendedBounds struct {
 	Min int64 `json:"min"`
@@ -392,6 +498,108 @@ type GeoHashGridAggregation struct {
 	Precision string `json:"precision"`
 }
 
+// GeoTileGridAggregation represents a geotile grid aggregation, whose buckets are
+// map tiles keyed by "zoom/x/y"
+type GeoTileGridAggregation struct {
+	Field     string `json:"field"`
+	Precision int    `json:"precision"`
+	Size      *int   `json:"size,omitempty"`
+}
+
+// RangeAggregation represents a range, date_range or ip_range aggregation
+type RangeAggregation struct {
+	Field    string            `json:"field"`
+	Ranges   []*AggregateRange `json:"ranges"`
+	Format   string            `json:"format,omitempty"`
+	TimeZone string            `json:"time_zone,omitempty"`
+}
+
+// AggregateRange is a range of a range aggregation. Its bucket is keyed by Key, or by
+// its bounds without one.
+type AggregateRange struct {
+	Key  string      `json:"key,omitempty"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+	// Mask is a CIDR mask, for ip_range aggregations only
+	Mask string `json:"mask,omitempty"`
+}
+
+// CompositeAggregation represents a composite aggregation, whose buckets are paged
+// through by setting After to the after_key of the previous page
+type CompositeAggregation struct {
+	Size    int                    `json:"size"`
+	Sources []*CompositeSource     `json:"sources"`
+	After   map[string]interface{} `json:"after,omitempty"`
+}
+
+// CompositeSource is a terms, histogram or date_histogram value source of a
+// composite aggregation
+type CompositeSource struct {
+	Name string
+	Type string
+	// Field is the field the values of the source are taken from
+	Field string
+	// Interval is the interval of histogram and date_histogram sources. The builder
+	// moves the one of date_histogram sources to CalendarInterval or FixedInterval
+	// when the datasource supports them.
+	Interval         interface{}
+	CalendarInterval string
+	FixedInterval    string
+	TimeZone         string
+	MissingBucket    bool
+}
+
+// MarshalJSON returns the JSON encoding of the composite source
+func (s *CompositeSource) MarshalJSON() ([]byte, error) {
+	source := map[string]interface{}{
+		"field": s.Field,
+	}
+	if s.Interval != nil && s.Interval != "" {
+		source["interval"] = s.Interval
+	}
+	if s.CalendarInterval != "" {
+		source["calendar_interval"] = s.CalendarInterval
+	}
+	if s.FixedInterval != "" {
+		source["fixed_interval"] = s.FixedInterval
+	}
+	if s.TimeZone != "" {
+		source["time_zone"] = s.TimeZone
+	}
+	if s.MissingBucket {
+		source["missing_bucket"] = true
+	}
+	return json.Marshal(map[string]interface{}{
+		s.Name: map[string]interface{}{s.Type: source},
+	})
+}
+
+// NestedAggregation represents a nested aggregation, which aggregates the nested
+// documents at path
+type NestedAggregation struct {
+	Path string `json:"path"`
+}
+
+// ReverseNestedAggregation represents a reverse nested aggregation, which aggregates
+// the parent documents of nested documents. An empty path joins back to the root
+// documents.
+type ReverseNestedAggregation struct {
+	Path string `json:"path,omitempty"`
+}
+
+// TopHitsAggregation represents a top_hits aggregation, which returns the top
+// documents of a bucket
+type TopHitsAggregation struct {
+	Size   int                      `json:"size"`
+	Sort   []map[string]interface{} `json:"sort,omitempty"`
+	Source *TopHitsSource           `json:"_source,omitempty"`
+}
+
+// TopHitsSource selects the fields of the source the top hits are returned with
+type TopHitsSource struct {
+	Includes []string `json:"includes"`
+}
+
 // MetricAggregation represents a metric aggregation
 type MetricAggregation struct {
 	Field    string
@@ -412,6 +620,19 @@ func (a *MetricAggregation) MarshalJSON() ([]byte, error) {
 	return json.Marshal(root)
 }
 
+// WeightedAvgAggregation represents a weighted average aggregation, which averages
+// the values of a field weighted by the values of another
+type WeightedAvgAggregation struct {
+	Value  *WeightedAvgSource `json:"value"`
+	Weight *WeightedAvgSource `json:"weight"`
+}
+
+// WeightedAvgSource is the value or the weight field of a weighted average
+type WeightedAvgSource struct {
+	Field   string      `json:"field"`
+	Missing interface{} `json:"missing,omitempty"`
+}
+
 // PipelineAggregation represents a metric aggregation
 type PipelineAggregation struct {
 	BucketPath interface{}
@@ -420,8 +641,10 @@ type PipelineAggregation struct {
 
 // MarshalJSON returns the JSON encoding of the pipeline aggregation
 func (a *PipelineAggregation) MarshalJSON() ([]byte, error) {
-	root := map[string]interface{}{
-		"buckets_path": a.BucketPath,
+	root := map[string]interface{}{}
+	// bucket_sort has no buckets_path
+	if a.BucketPath != nil {
+		root["buckets_path"] = a.BucketPath
 	}
 
 	for k, v := range a.Settings {
@@ -472,9 +695,28 @@ type PPLResponse struct {
 	Error     map[string]interface{} `json:"error"`
 	Schema    []FieldSchema          `json:"schema"`
 	Datarows  []Datarow              `json:"datarows"`
+	Total     int                    `json:"total"` // rows of the result, of which Size are returned
+	Size      int                    `json:"size"`
 	DebugInfo *PPLDebugInfo          `json:"-"`
 }
 
+// SQLRequest represents the SQL query object.
+type SQLRequest struct {
+	Query string
+}
+
+// MarshalJSON returns the JSON encoding of the SQL query.
+func (req *SQLRequest) MarshalJSON() ([]byte, error) {
+	root := map[string]interface{}{
+		"query": req.Query,
+	}
+	return json.Marshal(root)
+}
+
+// SQLResponse represents a SQL response. The SQL plugin's JDBC format uses the
+// same schema and datarows layout as PPL responses.
+type SQLResponse = PPLResponse
+
 // FieldSchema represents the schema for a single field from the PPL response result set
 type FieldSchema struct {
 	Name string `json:"name"`
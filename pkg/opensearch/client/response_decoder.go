@@ -0,0 +1,205 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// decodeMultiSearchResponse decodes a _msearch response as it is read from r.
+// Decoding the whole response at once buffers all of its bytes until the last hit
+// has been read, which for logs queries of thousands of documents costs far more
+// memory than the decoded hits themselves. Walking the tokens of the response
+// instead decodes every hit on its own, so only the bytes of one hit are buffered
+// at a time.
+func decodeMultiSearchResponse(r io.Reader) (*MultiSearchResponse, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+
+	var msr MultiSearchResponse
+	for dec.More() {
+		key, err := decodeKey(dec)
+		if err != nil {
+			return nil, err
+		}
+		if key != "responses" {
+			if err := skipValue(dec); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		isNull, err := expectDelimOrNull(dec, '[')
+		if err != nil {
+			return nil, err
+		}
+		if isNull {
+			continue
+		}
+		msr.Responses = make([]*SearchResponse, 0)
+		for dec.More() {
+			res, err := decodeSearchResponse(dec)
+			if err != nil {
+				return nil, err
+			}
+			msr.Responses = append(msr.Responses, res)
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, err
+	}
+	return &msr, nil
+}
+
+// decodeSearchResponse decodes one of the responses of a _msearch response in a
+// single pass, every field straight into the SearchResponse. Hits are still decoded
+// into a map each, and aggregations into nested maps, as the response parser builds
+// frames from them: the columns of the frames of documents are only known once every
+// hit is read. The saving is in not buffering the bytes of the response, not in the
+// decoded values.
+func decodeSearchResponse(dec *json.Decoder) (*SearchResponse, error) {
+	if isNull, err := expectDelimOrNull(dec, '{'); err != nil || isNull {
+		return nil, err
+	}
+
+	var res SearchResponse
+	for dec.More() {
+		key, err := decodeKey(dec)
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "hits":
+			res.Hits, err = decodeSearchResponseHits(dec)
+		case "aggregations":
+			err = dec.Decode(&res.Aggregations)
+		case "error":
+			err = dec.Decode(&res.Error)
+		case "pit_id":
+			err = dec.Decode(&res.PitID)
+		case "took":
+			err = dec.Decode(&res.Took)
+		case "_shards":
+			err = dec.Decode(&res.Shards)
+		case "timed_out":
+			err = dec.Decode(&res.TimedOut)
+		case "terminated_early":
+			err = dec.Decode(&res.TerminatedEarly)
+		default:
+			err = skipValue(dec)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func decodeSearchResponseHits(dec *json.Decoder) (*SearchResponseHits, error) {
+	if isNull, err := expectDelimOrNull(dec, '{'); err != nil || isNull {
+		return nil, err
+	}
+
+	var hits SearchResponseHits
+	for dec.More() {
+		key, err := decodeKey(dec)
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "hits":
+			isNull, err := expectDelimOrNull(dec, '[')
+			if err != nil {
+				return nil, err
+			}
+			if isNull {
+				continue
+			}
+			hits.Hits = make([]map[string]interface{}, 0)
+			for dec.More() {
+				var hit map[string]interface{}
+				if err := dec.Decode(&hit); err != nil {
+					return nil, err
+				}
+				hits.Hits = append(hits.Hits, hit)
+			}
+			if err := expectDelim(dec, ']'); err != nil {
+				return nil, err
+			}
+		case "total":
+			if err := dec.Decode(&hits.Total); err != nil {
+				return nil, err
+			}
+		default:
+			if err := skipValue(dec); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, err
+	}
+	return &hits, nil
+}
+
+func decodeKey(dec *json.Decoder) (string, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return "", err
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("expected an object key, got %v", tok)
+	}
+	return key, nil
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	_, err := expectDelimOrNull(dec, delim)
+	return err
+}
+
+// expectDelimOrNull reads the delimiter which starts or ends a value, or reports
+// whether the value is null instead when it starts one
+func expectDelimOrNull(dec *json.Decoder, delim json.Delim) (bool, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return false, err
+	}
+	if tok == nil && (delim == '{' || delim == '[') {
+		return true, nil
+	}
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return false, fmt.Errorf("expected %v, got %v", delim, tok)
+	}
+	return false, nil
+}
+
+// skipValue reads the next value without decoding it
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
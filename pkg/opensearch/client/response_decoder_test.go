@@ -0,0 +1,151 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeMultiSearchResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{
+			name: "hits and aggregations",
+			body: `{"took":3,"responses":[{"took":3,"timed_out":false,"_shards":{"total":1},"hits":{"total":{"value":2,"relation":"eq"},"max_score":null,"hits":[
+				{"_index":"logs","_id":"1","_source":{"message":"a","nested":{"list":[1,{"x":null}]}},"sort":[1,2]},
+				{"_index":"logs","_id":"2","_source":{"message":"b"},"fields":{"@timestamp":["2024-01-01T00:00:00Z"]}}
+			]},"aggregations":{"2":{"buckets":[{"key":1,"doc_count":2}]}},"status":200}]}`,
+		},
+		{
+			name: "total as a number and a point in time id",
+			body: `{"responses":[{"hits":{"total":93,"hits":[]},"pit_id":"abc"}]}`,
+		},
+		{
+			name: "error response",
+			body: `{"responses":[{"error":{"type":"search_phase_execution_exception","root_cause":[{"reason":"bad"}]},"status":400}]}`,
+		},
+		{
+			name: "null values",
+			body: `{"responses":[null,{"hits":null},{"hits":{"hits":null,"total":null}}]}`,
+		},
+		{
+			name: "several responses",
+			body: `{"responses":[{"hits":{"hits":[{"_id":"1"}]}},{"aggregations":{"1":{"value":3.5}}}]}`,
+		},
+		{
+			name: "no responses",
+			body: `{"responses":[]}`,
+		},
+		{
+			name: "partial results",
+			body: `{"responses":[{"took":12,"timed_out":true,"terminated_early":true,"_shards":{"total":5,"successful":3,"skipped":1,"failed":1,"failures":[{"reason":{"type":"x"}}]},"hits":{"hits":[]}}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var expected MultiSearchResponse
+			require.NoError(t, json.Unmarshal([]byte(tt.body), &expected))
+
+			msr, err := decodeMultiSearchResponse(strings.NewReader(tt.body))
+			require.NoError(t, err)
+			assert.Equal(t, expected.Responses, msr.Responses)
+		})
+	}
+
+	t.Run("every field of a search response is decoded", func(t *testing.T) {
+		res := SearchResponse{
+			Error:           map[string]interface{}{"reason": "bad"},
+			Aggregations:    map[string]interface{}{"1": map[string]interface{}{"value": 3.5}},
+			Hits:            &SearchResponseHits{Total: &SearchResponseHitsTotal{Value: 2, Relation: "eq"}},
+			PitID:           "abc",
+			Took:            12,
+			Shards:          &SearchResponseShards{Total: 5, Successful: 3, Skipped: 1, Failed: 1},
+			TimedOut:        true,
+			TerminatedEarly: true,
+		}
+		body, err := json.Marshal(MultiSearchResponse{Responses: []*SearchResponse{&res}})
+		require.NoError(t, err)
+
+		msr, err := decodeMultiSearchResponse(strings.NewReader(string(body)))
+		require.NoError(t, err)
+		require.Len(t, msr.Responses, 1)
+		assert.Equal(t, &res, msr.Responses[0])
+	})
+
+	t.Run("malformed response is an error", func(t *testing.T) {
+		for _, body := range []string{
+			`not json`,
+			`[]`,
+			`{"responses":{}}`,
+			`{"responses":[{"hits":{"hits":[{"_id":"1"}`,
+		} {
+			_, err := decodeMultiSearchResponse(strings.NewReader(body))
+			assert.Error(t, err, body)
+		}
+	})
+}
+
+// logsResponse returns a _msearch response of a logs query with the given number of
+// documents
+func logsResponse(b *testing.B, documents int) []byte {
+	b.Helper()
+	hits := make([]interface{}, documents)
+	for i := range hits {
+		hits[i] = map[string]interface{}{
+			"_index": "logs-2022.11.14",
+			"_id":    fmt.Sprintf("hit-%d", i),
+			"_source": map[string]interface{}{
+				"@timestamp": "2022-11-14T10:40:37.218Z",
+				"message":    fmt.Sprintf("GET /api/search?q=%d HTTP/1.1 200", i),
+				"level":      "info",
+				"host":       map[string]interface{}{"name": "web-1", "ip": "10.0.0.1"},
+				"bytes":      1024 + i,
+			},
+			"sort": []interface{}{1668422437218, i},
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"responses": []interface{}{map[string]interface{}{
+			"took": 10,
+			"hits": map[string]interface{}{"total": map[string]interface{}{"value": documents, "relation": "eq"}, "hits": hits},
+		}},
+	})
+	require.NoError(b, err)
+	return body
+}
+
+// BenchmarkDecodeMultiSearchResponse compares decoding a large _msearch response all
+// at once, as ExecuteMultisearch used to, with decodeMultiSearchResponse. Both read
+// the same body into the same MultiSearchResponse.
+func BenchmarkDecodeMultiSearchResponse(b *testing.B) {
+	body := logsResponse(b, 10000)
+
+	b.Run("whole body", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+		for i := 0; i < b.N; i++ {
+			var msr MultiSearchResponse
+			if err := json.NewDecoder(bytes.NewReader(body)).Decode(&msr); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("token stream", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+		for i := 0; i < b.N; i++ {
+			if _, err := decodeMultiSearchResponse(bytes.NewReader(body)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
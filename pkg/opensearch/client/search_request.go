@@ -1,9 +1,13 @@
 package client
 
 import (
+	"encoding/json"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/Masterminds/semver"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/opensearch-datasource/pkg/tsdb"
 )
 
@@ -15,12 +19,14 @@ type SearchRequestBuilder struct {
 	flavor        Flavor
 	version       *semver.Version
 	interval      tsdb.Interval
+	timeRange     backend.TimeRange
 	size          int
 	sort          []map[string]map[string]string
 	queryBuilder  *QueryBuilder
 	aggBuilders   []AggBuilder
 	customProps   map[string]interface{}
 	indexOverride string
+	highlight     *Highlight
 }
 
 // NewSearchRequestBuilder create a new search request builder
@@ -40,10 +46,12 @@ func NewSearchRequestBuilder(flavor Flavor, version *semver.Version, interval ts
 func (b *SearchRequestBuilder) Build() (*SearchRequest, error) {
 	sr := SearchRequest{
 		Interval:      b.interval,
+		TimeRange:     b.timeRange,
 		Size:          b.size,
 		Sort:          b.sort,
 		CustomProps:   b.customProps,
 		IndexOverride: b.indexOverride,
+		Highlight:     b.highlight,
 	}
 
 	if b.queryBuilder != nil {
@@ -75,6 +83,29 @@ func (b *SearchRequestBuilder) Size(size int) *SearchRequestBuilder {
 	return b
 }
 
+// highlightFragmentSize is large enough for the whole value of a field to be one
+// fragment, so that every matching term of it is highlighted
+const highlightFragmentSize = 2147483647
+
+// Highlight requests the terms matching the query to be highlighted between preTag
+// and postTag in fields, or in all fields when none are given
+func (b *SearchRequestBuilder) Highlight(preTag, postTag string, fields ...string) *SearchRequestBuilder {
+	if len(fields) == 0 {
+		fields = []string{"*"}
+	}
+	highlightFields := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		highlightFields[field] = map[string]interface{}{}
+	}
+	b.highlight = &Highlight{
+		Fields:       highlightFields,
+		PreTags:      []string{preTag},
+		PostTags:     []string{postTag},
+		FragmentSize: highlightFragmentSize,
+	}
+	return b
+}
+
 // SetIndex sets an index override for this search request
 func (b *SearchRequestBuilder) SetIndex(index string) *SearchRequestBuilder {
 	b.indexOverride = index
@@ -278,9 +309,11 @@ func (b *aggBuilderImpl) ServiceMap() AggBuilder {
 	return b
 }
 
-// Search initiates and returns a new search request builder
-func (m *MultiSearchRequestBuilder) Search(interval tsdb.Interval) *SearchRequestBuilder {
+// Search initiates and returns a new search request builder. The time range is
+// used to generate the indices the search is sent to.
+func (m *MultiSearchRequestBuilder) Search(interval tsdb.Interval, timeRange backend.TimeRange) *SearchRequestBuilder {
 	b := NewSearchRequestBuilder(m.flavor, m.version, interval)
+	b.timeRange = timeRange
 	m.requestBuilders = append(m.requestBuilders, b)
 	return b
 }
@@ -400,6 +433,17 @@ func (b *FilterQueryBuilder) AddDateRangeFilter(timeField, format string, lte, g
 	return b
 }
 
+// AddRangeBoundFilter adds a new range filter with a single bound, such as gt
+func (b *FilterQueryBuilder) AddRangeBoundFilter(key, operator, format string, value int64) *FilterQueryBuilder {
+	b.filters = append(b.filters, &RangeBoundFilter{
+		Key:      key,
+		Operator: operator,
+		Value:    value,
+		Format:   format,
+	})
+	return b
+}
+
 func (b *FilterQueryBuilder) AddTermsFilter(key string, values []string) *FilterQueryBuilder {
 	b.filters = append(b.filters, &TermsFilter{
 		Key:    key,
@@ -435,13 +479,23 @@ type FilterList struct {
 type AggBuilder interface {
 	Histogram(key, field string, fn func(a *HistogramAgg, b AggBuilder)) AggBuilder
 	DateHistogram(key, field string, fn func(a *DateHistogramAgg, b AggBuilder)) AggBuilder
+	AutoDateHistogram(key, field string, fn func(a *AutoDateHistogramAgg, b AggBuilder)) AggBuilder
 	Terms(key, field string, fn func(a *TermsAggregation, b AggBuilder)) AggBuilder
+	MultiTerms(key string, fields []string, fn func(a *MultiTermsAggregation, b AggBuilder)) AggBuilder
 	Filters(key string, fn func(a *FiltersAggregation, b AggBuilder)) AggBuilder
 	TraceList(TracesSize int) AggBuilder
 	ServiceMap() AggBuilder
 	Stats() AggBuilder
 	GeoHashGrid(key, field string, fn func(a *GeoHashGridAggregation, b AggBuilder)) AggBuilder
+	GeoTileGrid(key, field string, fn func(a *GeoTileGridAggregation, b AggBuilder)) AggBuilder
+	Range(key, field string, fn func(a *RangeAggregation, b AggBuilder)) AggBuilder
+	DateRange(key, field string, fn func(a *RangeAggregation, b AggBuilder)) AggBuilder
+	IPRange(key, field string, fn func(a *RangeAggregation, b AggBuilder)) AggBuilder
+	Composite(key string, fn func(a *CompositeAggregation, b AggBuilder)) AggBuilder
+	Nested(key, path string, fn func(a *NestedAggregation, b AggBuilder)) AggBuilder
+	ReverseNested(key, path string, fn func(a *ReverseNestedAggregation, b AggBuilder)) AggBuilder
 	Metric(key, metricType, field string, fn func(a *MetricAggregation)) AggBuilder
+	TopHits(key string, fn func(a *TopHitsAggregation)) AggBuilder
 	Pipeline(key, pipelineType string, bucketPath interface{}, fn func(a *PipelineAggregation)) AggBuilder
 	Build() (AggArray, error)
 	AddAggDef(*aggDefinition)
@@ -524,11 +578,83 @@ func (b *aggBuilderImpl) DateHistogram(key, field string, fn func(a *DateHistogr
 		fn(innerAgg, builder)
 	}
 
+	if supportsCalendarInterval(b.flavor, b.version) {
+		innerAgg.CalendarInterval, innerAgg.FixedInterval, innerAgg.Interval = splitDateHistogramInterval(innerAgg.Interval)
+	}
+
 	b.aggDefs = append(b.aggDefs, aggDef)
 
 	return b
 }
 
+func (b *aggBuilderImpl) AutoDateHistogram(key, field string, fn func(a *AutoDateHistogramAgg, b AggBuilder)) AggBuilder {
+	innerAgg := &AutoDateHistogramAgg{
+		Field: field,
+	}
+	aggDef := newAggDefinition(key, &AggContainer{
+		Type:        "auto_date_histogram",
+		Aggregation: innerAgg,
+	})
+
+	if fn != nil {
+		builder := newAggBuilder(b.version, b.flavor)
+		aggDef.builders = append(aggDef.builders, builder)
+		fn(innerAgg, builder)
+	}
+
+	b.aggDefs = append(b.aggDefs, aggDef)
+
+	return b
+}
+
+// calendarUnits are the units which date histograms support as calendar intervals, but
+// only with a quantity of one. Units shorter than a day are sent as fixed intervals.
+var calendarUnits = map[string]bool{"d": true, "w": true, "M": true, "q": true, "y": true}
+
+// fixedUnits are the units which date histograms support as fixed intervals
+var fixedUnits = map[string]bool{"ms": true, "s": true, "m": true, "h": true, "d": true}
+
+// fixedIntervalVariable is replaced with the interval in milliseconds, which date
+// histograms always accept as a fixed interval
+const fixedIntervalVariable = "$__fixed_interval"
+
+var intervalPattern = regexp.MustCompile(`^(\d+)(ms|s|m|h|d|w|M|q|y)$`)
+
+// supportsCalendarInterval reports whether date histograms accept calendar_interval and
+// fixed_interval. Elasticsearch only added them in 7.2, and deprecated interval then.
+func supportsCalendarInterval(flavor Flavor, version *semver.Version) bool {
+	if flavor == OpenSearch {
+		return true
+	}
+	return version != nil && !version.LessThan(semver.MustParse("7.2.0"))
+}
+
+// splitDateHistogramInterval moves a legacy date histogram interval to a calendar or
+// a fixed interval. Intervals which can't be expressed as either, such as 2M, are
+// returned as legacy intervals, which are deprecated but still supported.
+func splitDateHistogramInterval(interval string) (calendarInterval, fixedInterval, legacyInterval string) {
+	// $__interval may be formatted with units fixed intervals don't support
+	if interval == "$__interval" {
+		return "", fixedIntervalVariable, ""
+	}
+	matches := intervalPattern.FindStringSubmatch(interval)
+	if matches == nil {
+		return "", "", interval
+	}
+	quantity, unit := matches[1], matches[2]
+	switch {
+	case quantity == "1" && calendarUnits[unit]:
+		return interval, "", ""
+	case fixedUnits[unit]:
+		return "", interval, ""
+	case unit == "w":
+		weeks, _ := strconv.Atoi(quantity)
+		return "", strconv.Itoa(weeks*7) + "d", ""
+	default:
+		return "", "", interval
+	}
+}
+
 const termsOrderTerm = "_term"
 
 func (b *aggBuilderImpl) Terms(key, field string, fn func(a *TermsAggregation, b AggBuilder)) AggBuilder {
@@ -563,6 +689,34 @@ func (b *aggBuilderImpl) Terms(key, field string, fn func(a *TermsAggregation, b
 	return b
 }
 
+// MultiTerms adds a multi terms agg with a source per field
+func (b *aggBuilderImpl) MultiTerms(key string, fields []string, fn func(a *MultiTermsAggregation, b AggBuilder)) AggBuilder {
+	innerAgg := &MultiTermsAggregation{}
+	for _, field := range fields {
+		innerAgg.Terms = append(innerAgg.Terms, &MultiTermsSource{Field: field})
+	}
+	aggDef := newAggDefinition(key, &AggContainer{
+		Type:        "multi_terms",
+		Aggregation: innerAgg,
+	})
+
+	if fn != nil {
+		builder := newAggBuilder(b.version, b.flavor)
+		aggDef.builders = append(aggDef.builders, builder)
+		fn(innerAgg, builder)
+	}
+
+	// multi terms came after _term was renamed to _key
+	if orderBy, exists := innerAgg.Order[termsOrderTerm]; exists {
+		innerAgg.Order["_key"] = orderBy
+		delete(innerAgg.Order, termsOrderTerm)
+	}
+
+	b.aggDefs = append(b.aggDefs, aggDef)
+
+	return b
+}
+
 func (b *aggBuilderImpl) Filters(key string, fn func(a *FiltersAggregation, b AggBuilder)) AggBuilder {
 	innerAgg := &FiltersAggregation{
 		Filters: make(map[string]interface{}),
@@ -727,6 +881,127 @@ func (b *aggBuilderImpl) GeoHashGrid(key, field string, fn func(a *GeoHashGridAg
 	return b
 }
 
+func (b *aggBuilderImpl) GeoTileGrid(key, field string, fn func(a *GeoTileGridAggregation, b AggBuilder)) AggBuilder {
+	innerAgg := &GeoTileGridAggregation{
+		Field:     field,
+		Precision: 7,
+	}
+	aggDef := newAggDefinition(key, &AggContainer{
+		Type:        "geotile_grid",
+		Aggregation: innerAgg,
+	})
+
+	if fn != nil {
+		builder := newAggBuilder(b.version, b.flavor)
+		aggDef.builders = append(aggDef.builders, builder)
+		fn(innerAgg, builder)
+	}
+
+	b.aggDefs = append(b.aggDefs, aggDef)
+
+	return b
+}
+
+func (b *aggBuilderImpl) Range(key, field string, fn func(a *RangeAggregation, b AggBuilder)) AggBuilder {
+	return b.rangeAgg("range", key, field, fn)
+}
+
+func (b *aggBuilderImpl) DateRange(key, field string, fn func(a *RangeAggregation, b AggBuilder)) AggBuilder {
+	return b.rangeAgg("date_range", key, field, fn)
+}
+
+func (b *aggBuilderImpl) IPRange(key, field string, fn func(a *RangeAggregation, b AggBuilder)) AggBuilder {
+	return b.rangeAgg("ip_range", key, field, fn)
+}
+
+func (b *aggBuilderImpl) rangeAgg(rangeType, key, field string, fn func(a *RangeAggregation, b AggBuilder)) AggBuilder {
+	innerAgg := &RangeAggregation{
+		Field: field,
+	}
+	aggDef := newAggDefinition(key, &AggContainer{
+		Type:        rangeType,
+		Aggregation: innerAgg,
+	})
+
+	if fn != nil {
+		builder := newAggBuilder(b.version, b.flavor)
+		aggDef.builders = append(aggDef.builders, builder)
+		fn(innerAgg, builder)
+	}
+
+	b.aggDefs = append(b.aggDefs, aggDef)
+
+	return b
+}
+
+func (b *aggBuilderImpl) Composite(key string, fn func(a *CompositeAggregation, b AggBuilder)) AggBuilder {
+	innerAgg := &CompositeAggregation{}
+	aggDef := newAggDefinition(key, &AggContainer{
+		Type:        "composite",
+		Aggregation: innerAgg,
+	})
+
+	if fn != nil {
+		builder := newAggBuilder(b.version, b.flavor)
+		aggDef.builders = append(aggDef.builders, builder)
+		fn(innerAgg, builder)
+	}
+
+	if supportsCalendarInterval(b.flavor, b.version) {
+		for _, source := range innerAgg.Sources {
+			if interval, ok := source.Interval.(string); ok && source.Type == "date_histogram" {
+				var legacyInterval string
+				source.CalendarInterval, source.FixedInterval, legacyInterval = splitDateHistogramInterval(interval)
+				source.Interval = legacyInterval
+			}
+		}
+	}
+
+	b.aggDefs = append(b.aggDefs, aggDef)
+
+	return b
+}
+
+func (b *aggBuilderImpl) Nested(key, path string, fn func(a *NestedAggregation, b AggBuilder)) AggBuilder {
+	innerAgg := &NestedAggregation{
+		Path: path,
+	}
+	aggDef := newAggDefinition(key, &AggContainer{
+		Type:        "nested",
+		Aggregation: innerAgg,
+	})
+
+	if fn != nil {
+		builder := newAggBuilder(b.version, b.flavor)
+		aggDef.builders = append(aggDef.builders, builder)
+		fn(innerAgg, builder)
+	}
+
+	b.aggDefs = append(b.aggDefs, aggDef)
+
+	return b
+}
+
+func (b *aggBuilderImpl) ReverseNested(key, path string, fn func(a *ReverseNestedAggregation, b AggBuilder)) AggBuilder {
+	innerAgg := &ReverseNestedAggregation{
+		Path: path,
+	}
+	aggDef := newAggDefinition(key, &AggContainer{
+		Type:        "reverse_nested",
+		Aggregation: innerAgg,
+	})
+
+	if fn != nil {
+		builder := newAggBuilder(b.version, b.flavor)
+		aggDef.builders = append(aggDef.builders, builder)
+		fn(innerAgg, builder)
+	}
+
+	b.aggDefs = append(b.aggDefs, aggDef)
+
+	return b
+}
+
 func (b *aggBuilderImpl) Metric(key, metricType, field string, fn func(a *MetricAggregation)) AggBuilder {
 	innerAgg := &MetricAggregation{
 		Field:    field,
@@ -741,6 +1016,77 @@ func (b *aggBuilderImpl) Metric(key, metricType, field string, fn func(a *Metric
 		fn(innerAgg)
 	}
 
+	switch metricType {
+	case "weighted_avg":
+		aggDef.aggregation.Aggregation = weightedAvg(innerAgg)
+	case "percentile_ranks":
+		if values, ok := innerAgg.Settings["values"]; ok {
+			innerAgg.Settings["values"] = percentileRankValues(values)
+		}
+	}
+
+	b.aggDefs = append(b.aggDefs, aggDef)
+
+	return b
+}
+
+// weightedAvg turns a metric aggregation into a weighted average of its field,
+// weighted by the field of its "weight" setting. The "missing" and "weightMissing"
+// settings are the values of documents without the fields.
+func weightedAvg(a *MetricAggregation) *WeightedAvgAggregation {
+	weight, _ := a.Settings["weight"].(string)
+	return &WeightedAvgAggregation{
+		Value:  &WeightedAvgSource{Field: a.Field, Missing: a.Settings["missing"]},
+		Weight: &WeightedAvgSource{Field: weight, Missing: a.Settings["weightMissing"]},
+	}
+}
+
+// percentileRankValues returns the values of a percentile ranks aggregation as
+// numbers, which are strings in the query editor, or a comma separated string
+func percentileRankValues(values interface{}) []float64 {
+	var items []interface{}
+	switch v := values.(type) {
+	case []interface{}:
+		items = v
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			items = append(items, item)
+		}
+	default:
+		items = []interface{}{v}
+	}
+
+	numbers := make([]float64, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case float64:
+			numbers = append(numbers, v)
+		case json.Number:
+			if f, err := v.Float64(); err == nil {
+				numbers = append(numbers, f)
+			}
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				numbers = append(numbers, f)
+			}
+		}
+	}
+	return numbers
+}
+
+func (b *aggBuilderImpl) TopHits(key string, fn func(a *TopHitsAggregation)) AggBuilder {
+	innerAgg := &TopHitsAggregation{
+		Size: 1,
+	}
+	aggDef := newAggDefinition(key, &AggContainer{
+		Type:        "top_hits",
+		Aggregation: innerAgg,
+	})
+
+	if fn != nil {
+		fn(innerAgg)
+	}
+
 	b.aggDefs = append(b.aggDefs, aggDef)
 
 	return b
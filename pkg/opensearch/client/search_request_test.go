@@ -7,6 +7,7 @@ import (
 
 	"github.com/Masterminds/semver"
 	"github.com/bitly/go-simplejson"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/opensearch-datasource/pkg/tsdb"
 	"github.com/stretchr/testify/assert"
 )
@@ -300,7 +301,7 @@ func TestMultiSearchRequest(t *testing.T) {
 	t.Run("When adding one search request, When building search request should contain one search request", func(t *testing.T) {
 		version, _ := semver.NewVersion("1.0.0")
 		b := NewMultiSearchRequestBuilder(OpenSearch, version)
-		b.Search(tsdb.Interval{Value: 15 * time.Second, Text: "15s"})
+		b.Search(tsdb.Interval{Value: 15 * time.Second, Text: "15s"}, backend.TimeRange{})
 
 		mr, err := b.Build()
 		assert.NoError(t, err)
@@ -310,12 +311,16 @@ func TestMultiSearchRequest(t *testing.T) {
 	t.Run("When adding two search requests, When building search request should contain two search requests", func(t *testing.T) {
 		version, _ := semver.NewVersion("1.0.0")
 		b := NewMultiSearchRequestBuilder(OpenSearch, version)
-		b.Search(tsdb.Interval{Value: 15 * time.Second, Text: "15s"})
-		b.Search(tsdb.Interval{Value: 15 * time.Second, Text: "15s"})
+		first := backend.TimeRange{From: time.Date(2018, 5, 14, 0, 0, 0, 0, time.UTC), To: time.Date(2018, 5, 14, 1, 0, 0, 0, time.UTC)}
+		second := backend.TimeRange{From: time.Date(2018, 5, 15, 0, 0, 0, 0, time.UTC), To: time.Date(2018, 5, 15, 1, 0, 0, 0, time.UTC)}
+		b.Search(tsdb.Interval{Value: 15 * time.Second, Text: "15s"}, first)
+		b.Search(tsdb.Interval{Value: 15 * time.Second, Text: "15s"}, second)
 
 		mr, err := b.Build()
 		assert.NoError(t, err)
 		assert.Len(t, mr.Requests, 2)
+		assert.Equal(t, first, mr.Requests[0].TimeRange)
+		assert.Equal(t, second, mr.Requests[1].TimeRange)
 	})
 }
 
@@ -666,3 +671,88 @@ func Test_OpenSearch_search_request_builder_marshals_to_correct_json(t *testing.
 	   ]
 	}`, string(body))
 }
+
+func Test_splitDateHistogramInterval(t *testing.T) {
+	for interval, expected := range map[string][3]string{
+		"$__interval": {"", "$__fixed_interval", ""},
+		"1d":          {"1d", "", ""},
+		"1w":          {"1w", "", ""},
+		"1M":          {"1M", "", ""},
+		"1y":          {"1y", "", ""},
+		"1h":          {"", "1h", ""},
+		"500ms":       {"", "500ms", ""},
+		"3d":          {"", "3d", ""},
+		"2w":          {"", "14d", ""},
+		"2M":          {"", "", "2M"},
+		"10x":         {"", "", "10x"},
+	} {
+		calendarInterval, fixedInterval, legacyInterval := splitDateHistogramInterval(interval)
+		assert.Equal(t, expected, [3]string{calendarInterval, fixedInterval, legacyInterval}, interval)
+	}
+}
+
+func Test_supportsCalendarInterval(t *testing.T) {
+	assert.True(t, supportsCalendarInterval(OpenSearch, semver.MustParse("1.0.0")))
+	assert.True(t, supportsCalendarInterval(Elasticsearch, semver.MustParse("7.2.0")))
+	assert.True(t, supportsCalendarInterval(Elasticsearch, semver.MustParse("7.10.2")))
+	assert.False(t, supportsCalendarInterval(Elasticsearch, semver.MustParse("7.1.1")))
+	assert.False(t, supportsCalendarInterval(Elasticsearch, nil))
+}
+
+func Test_composite_aggregation_json(t *testing.T) {
+	b := newAggBuilder(semver.MustParse("2.11.0"), OpenSearch)
+	b.Composite("2", func(a *CompositeAggregation, b AggBuilder) {
+		a.Size = 100
+		a.After = map[string]interface{}{"user.id": "a"}
+		a.Sources = []*CompositeSource{
+			{Name: "user.id", Type: "terms", Field: "user.id", MissingBucket: true},
+			{Name: "@timestamp", Type: "date_histogram", Field: "@timestamp", Interval: "1d", TimeZone: "Europe/Berlin"},
+			{Name: "bytes", Type: "histogram", Field: "bytes", Interval: 500.0},
+		}
+		b.Metric("1", "sum", "bytes", nil)
+	})
+	aggs, err := b.Build()
+	assert.NoError(t, err)
+
+	body, err := json.Marshal(aggs)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"2": {
+			"composite": {
+				"size": 100,
+				"after": { "user.id": "a" },
+				"sources": [
+					{ "user.id": { "terms": { "field": "user.id", "missing_bucket": true } } },
+					{ "@timestamp": { "date_histogram": { "field": "@timestamp", "calendar_interval": "1d", "time_zone": "Europe/Berlin" } } },
+					{ "bytes": { "histogram": { "field": "bytes", "interval": 500 } } }
+				]
+			},
+			"aggs": { "1": { "sum": { "field": "bytes" } } }
+		}
+	}`, string(body))
+}
+
+func Test_metric_aggregation_json(t *testing.T) {
+	b := newAggBuilder(semver.MustParse("2.11.0"), OpenSearch)
+	b.Metric("1", "weighted_avg", "grade", func(a *MetricAggregation) {
+		a.Settings = map[string]interface{}{"weight": "credits", "weightMissing": 1}
+	})
+	b.Metric("2", "percentile_ranks", "latency", func(a *MetricAggregation) {
+		a.Settings = map[string]interface{}{"values": []interface{}{"100", json.Number("300"), 500.5}}
+	})
+	b.Metric("3", "percentile_ranks", "latency", func(a *MetricAggregation) {
+		a.Settings = map[string]interface{}{"values": "100, 300"}
+	})
+	b.Metric("4", "median_absolute_deviation", "latency", nil)
+	aggs, err := b.Build()
+	assert.NoError(t, err)
+
+	body, err := json.Marshal(aggs)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"1": { "weighted_avg": { "value": { "field": "grade" }, "weight": { "field": "credits", "missing": 1 } } },
+		"2": { "percentile_ranks": { "field": "latency", "values": [100, 300, 500.5] } },
+		"3": { "percentile_ranks": { "field": "latency", "values": [100, 300] } },
+		"4": { "median_absolute_deviation": { "field": "latency" } }
+	}`, string(body))
+}
@@ -83,7 +83,7 @@ func TestGetNumberOfShards(t *testing.T) {
 		}),
 	}
 
-	c, err := NewClient(context.Background(), ds, &http.Client{}, nil)
+	c, err := NewClient(context.Background(), ds, &http.Client{})
 	require.NoError(t, err)
 
 	shards, err := c.GetNumberOfShards("bug-repro")
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	timeFilterWithColumnMacro = regexp.MustCompile(`\$__timeFilter\(([^)]*)\)`)
+	timeFilterMacro           = regexp.MustCompile(`\$__timeFilter\b`)
+	timeFromMacro             = regexp.MustCompile(`\$__timeFrom\b`)
+	timeToMacro               = regexp.MustCompile(`\$__timeTo\b`)
+)
+
+// SQLRequestBuilder represents a SQL request builder
+type SQLRequestBuilder struct {
+	index    string
+	sqlQuery string
+}
+
+// NewSQLRequestBuilder create a new SQL request builder
+func NewSQLRequestBuilder(index string) *SQLRequestBuilder {
+	builder := &SQLRequestBuilder{
+		index: index,
+	}
+	return builder
+}
+
+// Build builds and return a SQL query object
+func (b *SQLRequestBuilder) Build() (*SQLRequest, error) {
+	return &SQLRequest{
+		Query: b.sqlQuery,
+	}, nil
+}
+
+// AddSQLQueryString sets the SQL query string and expands its time range macros:
+//   - $__timeFilter filters the time field on the query's time range
+//   - $__timeFilter(column) filters the given column on the query's time range
+//   - $__timeFrom and $__timeTo are replaced with the start and end timestamps
+//
+// Unlike PPL, no time range filter is added when the query doesn't use a macro,
+// since there is no reliable place to inject one in arbitrary SQL.
+func (b *SQLRequestBuilder) AddSQLQueryString(timeField, to, from, querystring string) *SQLRequestBuilder {
+	// Sets a default query if the query string is empty
+	if strings.TrimSpace(querystring) == "" {
+		querystring = fmt.Sprintf("SELECT * FROM `%s` WHERE $__timeFilter", b.index)
+	}
+
+	querystring = timeFilterWithColumnMacro.ReplaceAllStringFunc(querystring, func(macro string) string {
+		column := timeFilterWithColumnMacro.FindStringSubmatch(macro)[1]
+		column = strings.Trim(strings.TrimSpace(column), "`")
+		if column == "" {
+			column = timeField
+		}
+		return sqlTimeFilter(column, to, from)
+	})
+	querystring = timeFilterMacro.ReplaceAllLiteralString(querystring, sqlTimeFilter(timeField, to, from))
+	querystring = timeFromMacro.ReplaceAllLiteralString(querystring, sqlTimestamp(from))
+	querystring = timeToMacro.ReplaceAllLiteralString(querystring, sqlTimestamp(to))
+
+	b.sqlQuery = querystring
+	return b
+}
+
+func sqlTimeFilter(column, to, from string) string {
+	return fmt.Sprintf("`%s` >= %s and `%s` <= %s", column, sqlTimestamp(from), column, sqlTimestamp(to))
+}
+
+func sqlTimestamp(t string) string {
+	return fmt.Sprintf("timestamp('%s')", t)
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLRequest(t *testing.T) {
+	timeField := "@timestamp"
+	index := "default_index"
+
+	t.Run("When marshal to JSON should generate correct json", func(t *testing.T) {
+		sr, err := NewSQLRequestBuilder(index).AddSQLQueryString(timeField, "$timeTo", "$timeFrom", "SELECT 1").Build()
+		assert.NoError(t, err)
+		body, err := json.Marshal(sr)
+		assert.NoError(t, err)
+		json, err := simplejson.NewJson(body)
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT 1", json.Get("query").MustString())
+	})
+
+	t.Run("Should use a default query with a time filter when the query is empty", func(t *testing.T) {
+		sr, err := NewSQLRequestBuilder(index).AddSQLQueryString(timeField, "$timeTo", "$timeFrom", "  ").Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM `default_index` WHERE `@timestamp` >= timestamp('$timeFrom') and `@timestamp` <= timestamp('$timeTo')", sr.Query)
+	})
+
+	t.Run("Should expand $__timeFilter with the time field", func(t *testing.T) {
+		sr, err := NewSQLRequestBuilder(index).AddSQLQueryString(timeField, "$timeTo", "$timeFrom", "SELECT * FROM logs WHERE $__timeFilter AND level = 'error'").Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM logs WHERE `@timestamp` >= timestamp('$timeFrom') and `@timestamp` <= timestamp('$timeTo') AND level = 'error'", sr.Query)
+	})
+
+	t.Run("Should expand $__timeFilter with an explicit column", func(t *testing.T) {
+		sr, err := NewSQLRequestBuilder(index).AddSQLQueryString(timeField, "$timeTo", "$timeFrom", "SELECT * FROM logs WHERE $__timeFilter(`created_at`)").Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM logs WHERE `created_at` >= timestamp('$timeFrom') and `created_at` <= timestamp('$timeTo')", sr.Query)
+	})
+
+	t.Run("Should expand $__timeFrom and $__timeTo", func(t *testing.T) {
+		sr, err := NewSQLRequestBuilder(index).AddSQLQueryString(timeField, "$timeTo", "$timeFrom", "SELECT * FROM logs WHERE ts BETWEEN $__timeFrom AND $__timeTo").Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM logs WHERE ts BETWEEN timestamp('$timeFrom') AND timestamp('$timeTo')", sr.Query)
+	})
+
+	t.Run("Should not add a time filter without a macro", func(t *testing.T) {
+		sr, err := NewSQLRequestBuilder(index).AddSQLQueryString(timeField, "$timeTo", "$timeFrom", "SELECT count(*) FROM logs").Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT count(*) FROM logs", sr.Query)
+	})
+}
@@ -0,0 +1,328 @@
+package opensearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+	"github.com/grafana/opensearch-datasource/pkg/utils"
+)
+
+const (
+	// defaultCompositeSize is the number of buckets requested per page
+	defaultCompositeSize = 1000
+	// defaultCompositeLimit is the number of buckets after which paging stops
+	defaultCompositeLimit = 10000
+)
+
+// compositeSource is a value source of a composite bucket aggregation, configured in
+// its "sources" setting
+type compositeSource struct {
+	Type     string
+	Field    string
+	settings map[string]interface{}
+}
+
+func compositeSources(bucketAgg *BucketAgg) []compositeSource {
+	sources := make([]compositeSource, 0)
+	for _, s := range bucketAgg.Settings.Get("sources").MustArray() {
+		source := utils.NewJsonFromAny(s)
+		sources = append(sources, compositeSource{
+			Type:     source.Get("type").MustString(),
+			Field:    source.Get("field").MustString(),
+			settings: source.MustMap(),
+		})
+	}
+	return sources
+}
+
+// compositeBucketAgg returns the composite bucket aggregation of the query, if any
+func compositeBucketAgg(q *Query) *BucketAgg {
+	for _, bucketAgg := range q.BucketAggs {
+		if bucketAgg.Type == compositeType {
+			return bucketAgg
+		}
+	}
+	return nil
+}
+
+// validateCompositeAgg checks that a composite aggregation is the only bucket
+// aggregation of the query, as the buckets of all its sources are flat, that its
+// sources can be turned back into frames and that it has no sibling pipelines
+func validateCompositeAgg(q *Query) error {
+	bucketAgg := compositeBucketAgg(q)
+	if bucketAgg == nil {
+		return nil
+	}
+	if len(q.BucketAggs) > 1 {
+		return backend.DownstreamErrorf("invalid query, a composite aggregation can't be combined with other bucket aggregations")
+	}
+	sources := compositeSources(bucketAgg)
+	if len(sources) == 0 {
+		return backend.DownstreamErrorf("invalid query, composite aggregation %s has no sources", bucketAgg.ID)
+	}
+	fields := make(map[string]bool)
+	dateHistograms := 0
+	for _, source := range sources {
+		switch source.Type {
+		case termsType, histogramType:
+		case dateHistType:
+			dateHistograms++
+		default:
+			return backend.DownstreamErrorf("invalid query, composite aggregation source type %q is not supported", source.Type)
+		}
+		if source.Field == "" {
+			return backend.DownstreamErrorf("invalid query, composite aggregation source %s has no field", source.Type)
+		}
+		if fields[source.Field] {
+			return backend.DownstreamErrorf("invalid query, composite aggregation has more than one source for field %s", source.Field)
+		}
+		fields[source.Field] = true
+	}
+	if dateHistograms > 1 {
+		return backend.DownstreamErrorf("invalid query, composite aggregation has more than one date_histogram source")
+	}
+	// a sibling pipeline is computed over the buckets of a single page, not over
+	// all the buckets fetched
+	for _, m := range q.Metrics {
+		if isSiblingPipelineAgg(m.Type) {
+			return backend.DownstreamErrorf("invalid query, sibling pipeline aggregation %s can't be used with a composite aggregation", m.Type)
+		}
+	}
+	return nil
+}
+
+// compositeLimit returns the number of buckets fetched for a composite aggregation.
+// A missing, invalid or non-positive limit is the default limit.
+func compositeLimit(bucketAgg *BucketAgg) int {
+	limit := utils.StringToIntWithDefaultValue(fmt.Sprint(bucketAgg.Settings.Get("limit").Interface()), defaultCompositeLimit)
+	if limit <= 0 {
+		return defaultCompositeLimit
+	}
+	return limit
+}
+
+// compositeSize returns the number of buckets requested per page of a composite
+// aggregation. A missing, invalid or non-positive size, which OpenSearch rejects, is
+// the default size.
+func compositeSize(bucketAgg *BucketAgg) int {
+	size := utils.StringToIntWithDefaultValue(fmt.Sprint(bucketAgg.Settings.Get("size").Interface()), defaultCompositeSize)
+	if size <= 0 {
+		return defaultCompositeSize
+	}
+	return size
+}
+
+// addCompositeAgg requests the buckets of the sources of a composite aggregation.
+// The sources are named after their field.
+func addCompositeAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg, timeZone string) client.AggBuilder {
+	aggBuilder.Composite(bucketAgg.ID, func(a *client.CompositeAggregation, b client.AggBuilder) {
+		a.Size = compositeSize(bucketAgg)
+		for _, source := range compositeSources(bucketAgg) {
+			settings := utils.NewJsonFromAny(source.settings)
+			s := &client.CompositeSource{
+				Name:          source.Field,
+				Type:          source.Type,
+				Field:         source.Field,
+				MissingBucket: settings.Get("missingBucket").MustBool(false),
+			}
+			switch source.Type {
+			case histogramType:
+				s.Interval = stringToFloatWithDefaultValue(fmt.Sprint(settings.Get("interval").Interface()), 1000)
+			case dateHistType:
+				interval := settings.Get("interval").MustString("auto")
+				if interval == "auto" {
+					interval = "$__interval"
+				}
+				s.Interval = interval
+				s.TimeZone = histogramTimeZone(settings.Get("timeZone").MustString(), timeZone)
+			}
+			a.Sources = append(a.Sources, s)
+		}
+		aggBuilder = b
+	})
+
+	return aggBuilder
+}
+
+// fetchCompositePages follows the after_key of the composite aggregation of a
+// paginated search until all its buckets, or its limit, are fetched. The buckets of
+// all pages are merged into the first page's response.
+func (h *luceneHandler) fetchCompositePages(ctx context.Context, p *paginatedSearch) (*client.SearchResponse, error) {
+	req, err := p.ms.Build()
+	if err != nil {
+		return nil, backend.PluginError(err)
+	}
+	search := req.Requests[0]
+	var composite *client.CompositeAggregation
+	for _, agg := range search.Aggs {
+		if agg.Key == p.composite {
+			composite, _ = agg.Aggregation.Aggregation.(*client.CompositeAggregation)
+		}
+	}
+	if composite == nil {
+		return nil, backend.PluginError(errors.New("composite aggregation is missing from the search"))
+	}
+
+	var merged *client.SearchResponse
+	buckets := make([]interface{}, 0)
+	for {
+		res, err := h.client.ExecuteMultisearch(ctx, &client.MultiSearchRequest{Requests: []*client.SearchRequest{search}})
+		if err != nil {
+			return nil, err
+		}
+		if len(res.Responses) == 0 {
+			return nil, backend.PluginError(errors.New("multisearch response is empty"))
+		}
+		pageRes := res.Responses[0]
+		if pageRes.Error != nil {
+			// let the response parser report the error of the page
+			return pageRes, nil
+		}
+		if merged == nil {
+			merged = pageRes
+		} else {
+			merged.Took += pageRes.Took
+		}
+
+		agg, _ := pageRes.Aggregations[p.composite].(map[string]interface{})
+		page, _ := agg["buckets"].([]interface{})
+		buckets = append(buckets, page...)
+		afterKey, _ := agg["after_key"].(map[string]interface{})
+		if len(buckets) >= p.limit {
+			if len(buckets) > p.limit || (afterKey != nil && len(page) > 0) {
+				backend.Logger.Warn("Composite aggregation has more buckets than its limit", "limit", p.limit)
+				p.notices = append(p.notices, warning(fmt.Sprintf("Showing the first %d buckets, the composite aggregation has more than its limit", p.limit)))
+			}
+			buckets = buckets[:p.limit]
+			break
+		}
+		if afterKey == nil || len(page) == 0 {
+			break
+		}
+		composite.After = afterKey
+	}
+
+	if merged.Aggregations == nil {
+		merged.Aggregations = make(map[string]interface{})
+	}
+	merged.Aggregations[p.composite] = map[string]interface{}{"buckets": buckets}
+	return merged, nil
+}
+
+// expandCompositeAgg turns the flat buckets of a composite aggregation into the
+// nested buckets the same query would get with a bucket aggregation per source, so
+// they are processed into the same frames. The date_histogram source, if any, is the
+// innermost aggregation so every other source is a series. The returned query has
+// those bucket aggregations instead of the composite one.
+func expandCompositeAgg(aggs map[string]interface{}, target *Query) (map[string]interface{}, *Query) {
+	bucketAgg := compositeBucketAgg(target)
+	if bucketAgg == nil {
+		return aggs, target
+	}
+
+	sources := compositeSources(bucketAgg)
+	ordered := make([]compositeSource, 0, len(sources))
+	var dateHistogram *compositeSource
+	for i, source := range sources {
+		if source.Type == dateHistType {
+			dateHistogram = &sources[i]
+			continue
+		}
+		ordered = append(ordered, source)
+	}
+	if dateHistogram != nil {
+		ordered = append(ordered, *dateHistogram)
+	}
+
+	expanded := *target
+	expanded.BucketAggs = make([]*BucketAgg, len(ordered))
+	for i, source := range ordered {
+		expanded.BucketAggs[i] = &BucketAgg{
+			ID:       bucketAgg.ID + ":" + strconv.Itoa(i),
+			Type:     source.Type,
+			Field:    source.Field,
+			Settings: utils.NewJsonFromAny(map[string]interface{}{}),
+		}
+	}
+
+	compositeRes, _ := aggs[bucketAgg.ID].(map[string]interface{})
+	buckets, _ := compositeRes["buckets"].([]interface{})
+	expandedAggs := make(map[string]interface{}, len(aggs))
+	for k, v := range aggs {
+		if k != bucketAgg.ID {
+			expandedAggs[k] = v
+		}
+	}
+	expandedAggs[expanded.BucketAggs[0].ID] = map[string]interface{}{
+		"buckets": nestCompositeBuckets(buckets, expanded.BucketAggs, 0),
+	}
+	return expandedAggs, &expanded
+}
+
+// nestCompositeBuckets groups composite buckets by the value of the source of the
+// bucket aggregation at depth, in the order the values first appear
+func nestCompositeBuckets(buckets []interface{}, bucketAggs []*BucketAgg, depth int) []interface{} {
+	bucketAgg := bucketAggs[depth]
+	keyOf := func(bucket map[string]interface{}) interface{} {
+		key, _ := bucket["key"].(map[string]interface{})
+		value := key[bucketAgg.Field]
+		if value == nil && bucketAgg.Type != dateHistType {
+			// missing bucket
+			return ""
+		}
+		return value
+	}
+
+	if depth == len(bucketAggs)-1 {
+		nested := make([]interface{}, 0, len(buckets))
+		for _, b := range buckets {
+			bucket, _ := b.(map[string]interface{})
+			key := keyOf(bucket)
+			if key == nil {
+				continue
+			}
+			leaf := make(map[string]interface{}, len(bucket))
+			for k, v := range bucket {
+				leaf[k] = v
+			}
+			leaf["key"] = key
+			nested = append(nested, leaf)
+		}
+		return nested
+	}
+
+	keys := make([]interface{}, 0)
+	groups := make(map[string][]interface{})
+	for _, b := range buckets {
+		bucket, _ := b.(map[string]interface{})
+		key := keyOf(bucket)
+		group := fmt.Sprint(key)
+		if _, ok := groups[group]; !ok {
+			keys = append(keys, key)
+		}
+		groups[group] = append(groups[group], bucket)
+	}
+
+	nested := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		group := groups[fmt.Sprint(key)]
+		docCount := 0.0
+		for _, b := range group {
+			if count, ok := b.(map[string]interface{})["doc_count"].(float64); ok {
+				docCount += count
+			}
+		}
+		nested = append(nested, map[string]interface{}{
+			"key":       key,
+			"doc_count": docCount,
+			bucketAggs[depth+1].ID: map[string]interface{}{
+				"buckets": nestCompositeBuckets(group, bucketAggs, depth+1),
+			},
+		})
+	}
+	return nested
+}
@@ -0,0 +1,106 @@
+package opensearch
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// defaultMaxConcurrentQueries is used when jsonData.maxConcurrentQueries is unset or invalid
+const defaultMaxConcurrentQueries = 5
+
+// maxConcurrentQueriesFrom reads the number of requests a single query request may
+// send to the datasource at once. It is safe to call with a nil dsSettings.
+func maxConcurrentQueriesFrom(dsSettings *backend.DataSourceInstanceSettings) int {
+	if dsSettings == nil {
+		return defaultMaxConcurrentQueries
+	}
+	jsonData, err := simplejson.NewJson(dsSettings.JSONData)
+	if err != nil {
+		return defaultMaxConcurrentQueries
+	}
+	if v, err := jsonData.Get("maxConcurrentQueries").Int(); err == nil && v > 0 {
+		return v
+	}
+	return defaultMaxConcurrentQueries
+}
+
+// concurrencyLimiter bounds the number of requests sent to the datasource at once.
+// It is shared by all handlers of a query request.
+type concurrencyLimiter chan struct{}
+
+func newConcurrencyLimiter(limit int) concurrencyLimiter {
+	if limit < 1 {
+		limit = 1
+	}
+	return make(concurrencyLimiter, limit)
+}
+
+// acquire blocks until a request can be sent, or returns the context's error
+// if it is done first
+func (l concurrencyLimiter) acquire(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l concurrencyLimiter) release() {
+	<-l
+}
+
+// queryResult is the outcome of executing a single PPL or SQL query. err is set
+// when the request to the datasource failed.
+type queryResult struct {
+	refID    string
+	response backend.DataResponse
+	err      error
+}
+
+// executeConcurrently runs execute for every refID, within the limits of limiter,
+// and returns the results ordered by refID so merging them is deterministic.
+// Queries that can't start because ctx is done fail with the context's error.
+func executeConcurrently(ctx context.Context, limiter concurrencyLimiter, refIDs []string, execute func(ctx context.Context, refID string) (backend.DataResponse, error)) []queryResult {
+	sort.Strings(refIDs)
+	results := make([]queryResult, len(refIDs))
+
+	var wg sync.WaitGroup
+	for i, refID := range refIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i].refID = refID
+			if err := limiter.acquire(ctx); err != nil {
+				results[i].err = backend.DownstreamError(err)
+				return
+			}
+			defer limiter.release()
+			results[i].response, results[i].err = execute(ctx, refID)
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+// collectResults turns the results of executeConcurrently into a query data
+// response. A failed request only fails its own query.
+func collectResults(results []queryResult) *backend.QueryDataResponse {
+	result := backend.NewQueryDataResponse()
+	for _, r := range results {
+		if r.err != nil {
+			result.Responses[r.refID] = backend.ErrorResponseWithErrorSource(r.err)
+			continue
+		}
+		result.Responses[r.refID] = r.response
+	}
+	return result
+}
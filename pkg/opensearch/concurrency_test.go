@@ -0,0 +1,109 @@
+package opensearch
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_maxConcurrentQueriesFrom(t *testing.T) {
+	assert.Equal(t, defaultMaxConcurrentQueries, maxConcurrentQueriesFrom(nil))
+	assert.Equal(t, defaultMaxConcurrentQueries, maxConcurrentQueriesFrom(&backend.DataSourceInstanceSettings{}))
+	assert.Equal(t, defaultMaxConcurrentQueries, maxConcurrentQueriesFrom(&backend.DataSourceInstanceSettings{JSONData: []byte(`{"maxConcurrentQueries": 0}`)}))
+	assert.Equal(t, defaultMaxConcurrentQueries, maxConcurrentQueriesFrom(&backend.DataSourceInstanceSettings{JSONData: []byte(`{"maxConcurrentQueries": "many"}`)}))
+	assert.Equal(t, 2, maxConcurrentQueriesFrom(&backend.DataSourceInstanceSettings{JSONData: []byte(`{"maxConcurrentQueries": 2}`)}))
+}
+
+func Test_executeConcurrently(t *testing.T) {
+	t.Run("runs at most limit queries at once and orders results by refID", func(t *testing.T) {
+		var inFlight, maxInFlight atomic.Int32
+		execute := func(ctx context.Context, refID string) (backend.DataResponse, error) {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				max := maxInFlight.Load()
+				if n <= max || maxInFlight.CompareAndSwap(max, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return backend.DataResponse{Frames: data.Frames{data.NewFrame(refID)}}, nil
+		}
+
+		results := executeConcurrently(context.Background(), newConcurrencyLimiter(2), []string{"E", "B", "D", "A", "C", "F"}, execute)
+
+		assert.Equal(t, int32(2), maxInFlight.Load())
+		refIDs := make([]string, 0, len(results))
+		for _, r := range results {
+			require.NoError(t, r.err)
+			assert.Equal(t, r.refID, r.response.Frames[0].Name)
+			refIDs = append(refIDs, r.refID)
+		}
+		assert.Equal(t, []string{"A", "B", "C", "D", "E", "F"}, refIDs)
+	})
+
+	t.Run("does not start queries once the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var executed atomic.Int32
+		execute := func(ctx context.Context, refID string) (backend.DataResponse, error) {
+			executed.Add(1)
+			return backend.DataResponse{}, nil
+		}
+
+		results := executeConcurrently(ctx, newConcurrencyLimiter(2), []string{"A", "B"}, execute)
+
+		assert.Equal(t, int32(0), executed.Load())
+		for _, r := range results {
+			assert.ErrorIs(t, r.err, context.Canceled)
+		}
+	})
+
+	t.Run("waiting queries stop when the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		execute := func(ctx context.Context, refID string) (backend.DataResponse, error) {
+			cancel()
+			<-ctx.Done()
+			return backend.DataResponse{}, ctx.Err()
+		}
+
+		results := executeConcurrently(ctx, newConcurrencyLimiter(1), []string{"A", "B", "C"}, execute)
+
+		require.Len(t, results, 3)
+		for _, r := range results {
+			assert.ErrorIs(t, r.err, context.Canceled)
+		}
+	})
+}
+
+func Test_collectResults(t *testing.T) {
+	t.Run("returns every response", func(t *testing.T) {
+		res := collectResults([]queryResult{
+			{refID: "A", response: backend.DataResponse{Frames: data.Frames{data.NewFrame("a")}}},
+			{refID: "B", response: backend.DataResponse{Frames: data.Frames{data.NewFrame("b")}}},
+		})
+		assert.Len(t, res.Responses, 2)
+	})
+
+	t.Run("a failed request only fails its own query", func(t *testing.T) {
+		res := collectResults([]queryResult{
+			{refID: "A", response: backend.DataResponse{Frames: data.Frames{data.NewFrame("a")}}},
+			{refID: "B", err: backend.DownstreamError(errors.New("b failed"))},
+			{refID: "C", err: backend.PluginError(errors.New("c failed"))},
+		})
+		require.Len(t, res.Responses, 3)
+		assert.NoError(t, res.Responses["A"].Error)
+		assert.Len(t, res.Responses["A"].Frames, 1)
+		assert.EqualError(t, res.Responses["B"].Error, "b failed")
+		assert.Equal(t, backend.ErrorSourceDownstream, res.Responses["B"].ErrorSource)
+		assert.EqualError(t, res.Responses["C"].Error, "c failed")
+		assert.Equal(t, backend.ErrorSourcePlugin, res.Responses["C"].ErrorSource)
+	})
+}
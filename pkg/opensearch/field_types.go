@@ -0,0 +1,500 @@
+package opensearch
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+)
+
+const (
+	// fieldMappingCacheTTL bounds how long the field types of an index are reused
+	// before we look them up again. New fields are mapped as documents arrive, so
+	// the mapping is refreshed sooner than it would be for settings.
+	fieldMappingCacheTTL = 5 * time.Minute
+	// fieldMappingCacheMax bounds the cache so rotating concrete index names can't
+	// grow it without limit.
+	fieldMappingCacheMax = 256
+)
+
+// fieldKind is the kind of column the values of a field are shown in
+type fieldKind int
+
+const (
+	// fieldKindUnknown fields are typed by their values
+	fieldKindUnknown fieldKind = iota
+	fieldKindTime
+	fieldKindNumber
+	fieldKindBool
+	fieldKindString
+	fieldKindIP
+	fieldKindGeoPoint
+)
+
+// mappingTypeKinds are the kinds of the mapping types of fields. Objects, nested
+// fields and any other type aren't in it and are typed by their values.
+var mappingTypeKinds = map[string]fieldKind{
+	"date":             fieldKindTime,
+	"date_nanos":       fieldKindTime,
+	"long":             fieldKindNumber,
+	"integer":          fieldKindNumber,
+	"short":            fieldKindNumber,
+	"byte":             fieldKindNumber,
+	"double":           fieldKindNumber,
+	"float":            fieldKindNumber,
+	"half_float":       fieldKindNumber,
+	"scaled_float":     fieldKindNumber,
+	"unsigned_long":    fieldKindNumber,
+	"token_count":      fieldKindNumber,
+	"boolean":          fieldKindBool,
+	"keyword":          fieldKindString,
+	"constant_keyword": fieldKindString,
+	"wildcard":         fieldKindString,
+	"text":             fieldKindString,
+	"match_only_text":  fieldKindString,
+	"version":          fieldKindString,
+	"_id":              fieldKindString,
+	"_index":           fieldKindString,
+	"ip":               fieldKindIP,
+	"geo_point":        fieldKindGeoPoint,
+}
+
+// fieldMapping is the kind of every mapped field of the index of a query
+type fieldMapping map[string]fieldKind
+
+// newFieldMapping returns the kinds of fields with the given mapping types. A field
+// mapped to types of different kinds in different indices is a string, which all of
+// its values can be shown as.
+func newFieldMapping(types map[string][]string) fieldMapping {
+	mapping := make(fieldMapping, len(types))
+	for field, fieldTypes := range types {
+		kind := fieldKindUnknown
+		for _, t := range fieldTypes {
+			k, ok := mappingTypeKinds[t]
+			if !ok {
+				kind = fieldKindUnknown
+				break
+			}
+			if kind != fieldKindUnknown && kind != k {
+				k = fieldKindString
+			}
+			kind = k
+		}
+		if kind != fieldKindUnknown {
+			mapping[field] = kind
+		}
+	}
+	return mapping
+}
+
+// without returns the mapping without fields, which have values of their own
+func (m fieldMapping) without(fields ...string) fieldMapping {
+	if m == nil {
+		return nil
+	}
+	mapping := make(fieldMapping, len(m))
+	for field, kind := range m {
+		mapping[field] = kind
+	}
+	for _, field := range fields {
+		delete(mapping, field)
+	}
+	return mapping
+}
+
+// geoPointOf returns the geo_point field a property of a document is, or is the
+// latitude or longitude of when the point is an object flattened into them
+func (m fieldMapping) geoPointOf(propName string) (string, bool) {
+	if m[propName] == fieldKindGeoPoint {
+		return propName, true
+	}
+	for _, suffix := range []string{".lat", ".lon"} {
+		if parent, ok := strings.CutSuffix(propName, suffix); ok && m[parent] == fieldKindGeoPoint {
+			return parent, true
+		}
+	}
+	return "", false
+}
+
+type fieldMappingEntry struct {
+	mapping fieldMapping
+	expires time.Time
+}
+
+// fieldMappingCache memoizes the field types of indices across query requests,
+// keyed by datasource UID + the indices searched, the same way as shardCountCache.
+// The indices are those of the time range of the query, so a new daily index,
+// which can be mapped differently, is looked up instead of served from the cache.
+var (
+	fieldMappingMu    sync.Mutex
+	fieldMappingCache = map[string]fieldMappingEntry{}
+)
+
+// lookupFieldMapping returns the kinds of the fields of the indices searched, as
+// returned by SearchIndex, or nil when they can't be looked up, in which case every
+// column is typed by its values. Successful lookups are cached per datasource and
+// indices for fieldMappingCacheTTL.
+func lookupFieldMapping(ctx context.Context, c client.Client, dsSettings *backend.DataSourceInstanceSettings, index string) fieldMapping {
+	key := fieldMappingKey(dsSettings, index)
+	if mapping, ok := cachedFieldMapping(key); ok {
+		return mapping
+	}
+
+	types, err := c.GetFieldTypes(ctx, index)
+	if err != nil {
+		// Don't cache the failure so a transient error is retried on the next query
+		backend.Logger.Debug("Failed to look up field types", "index", index, "error", err)
+		return nil
+	}
+
+	mapping := newFieldMapping(types)
+	storeFieldMapping(key, mapping)
+	return mapping
+}
+
+func fieldMappingKey(dsSettings *backend.DataSourceInstanceSettings, index string) string {
+	var uid string
+	if dsSettings != nil {
+		uid = dsSettings.UID
+	}
+	return uid + "|" + index
+}
+
+// lookupFieldMappings looks up the field mappings of the document queries, once
+// for the indices searched by any number of them. The lookups which aren't cached
+// are sent concurrently within the limit of concurrent requests.
+func (h *luceneHandler) lookupFieldMappings(ctx context.Context) {
+	queries := make(map[string][]*Query)
+	for _, q := range h.queries {
+		if !isDocumentQuery(q) {
+			continue
+		}
+		index := h.client.SearchIndex(q.Index, q.TimeRange)
+		if mapping, ok := cachedFieldMapping(fieldMappingKey(h.dsSettings, index)); ok {
+			q.fieldTypes = mapping
+			continue
+		}
+		queries[index] = append(queries[index], q)
+	}
+
+	var wg sync.WaitGroup
+	for index, indexQueries := range queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := h.limiter.acquire(ctx); err != nil {
+				return
+			}
+			defer h.limiter.release()
+			mapping := lookupFieldMapping(ctx, h.client, h.dsSettings, index)
+			for _, q := range indexQueries {
+				q.fieldTypes = mapping
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// cachedFieldMapping returns a non-expired cached field mapping for key, if any
+func cachedFieldMapping(key string) (fieldMapping, bool) {
+	fieldMappingMu.Lock()
+	defer fieldMappingMu.Unlock()
+	entry, ok := fieldMappingCache[key]
+	if !ok || !time.Now().Before(entry.expires) {
+		return nil, false
+	}
+	return entry.mapping, true
+}
+
+// storeFieldMapping caches mapping for key, evicting expired entries (and, if the
+// cache is still at capacity, resetting it) so the map stays bounded
+func storeFieldMapping(key string, mapping fieldMapping) {
+	fieldMappingMu.Lock()
+	defer fieldMappingMu.Unlock()
+	if len(fieldMappingCache) >= fieldMappingCacheMax {
+		now := time.Now()
+		for k, entry := range fieldMappingCache {
+			if !now.Before(entry.expires) {
+				delete(fieldMappingCache, k)
+			}
+		}
+		if len(fieldMappingCache) >= fieldMappingCacheMax {
+			fieldMappingCache = map[string]fieldMappingEntry{}
+		}
+	}
+	fieldMappingCache[key] = fieldMappingEntry{mapping: mapping, expires: time.Now().Add(fieldMappingCacheTTL)}
+}
+
+// mappedField returns the column of a property of the documents typed by the kind
+// of its field. The values of a multi-valued
+// field are a JSON array in every row. Values which can't be converted to the kind
+// make the whole column a string column, so its type never depends on the order of
+// the documents.
+func mappedField(docs []map[string]interface{}, propName string, kind fieldKind, isFilterable bool) *data.Field {
+	values := make([]interface{}, len(docs))
+	multiValued := false
+	for i, doc := range docs {
+		v := doc[propName]
+		if list, ok := v.([]interface{}); ok {
+			switch len(list) {
+			case 0:
+				v = nil
+			case 1:
+				v = list[0]
+			default:
+				multiValued = true
+			}
+		}
+		values[i] = v
+	}
+	if multiValued {
+		return jsonArrayField(propName, values, isFilterable)
+	}
+
+	var field *data.Field
+	switch kind {
+	case fieldKindTime:
+		field = convertedField(propName, values, toTime)
+	case fieldKindNumber:
+		field = convertedField(propName, values, toNumber)
+	case fieldKindBool:
+		field = convertedField(propName, values, toBool)
+	}
+	if field == nil {
+		field = convertedField(propName, values, func(v interface{}) (string, bool) { return toString(v), true })
+	}
+	field.Config = &data.FieldConfig{Filterable: &isFilterable}
+	return field
+}
+
+// convertedField returns a field of the values converted by convert, or nil if any
+// of them can't be
+func convertedField[T time.Time | float64 | bool | string](name string, values []interface{}, convert func(interface{}) (T, bool)) *data.Field {
+	vector := make([]*T, len(values))
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		converted, ok := convert(v)
+		if !ok {
+			return nil
+		}
+		vector[i] = &converted
+	}
+	return data.NewField(name, nil, vector)
+}
+
+func jsonArrayField(name string, values []interface{}, isFilterable bool) *data.Field {
+	vector := make([]*json.RawMessage, len(values))
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		if _, ok := v.([]interface{}); !ok {
+			v = []interface{}{v}
+		}
+		bytes, err := json.Marshal(v)
+		if err != nil {
+			// We skip values that cannot be marshalled
+			continue
+		}
+		value := json.RawMessage(bytes)
+		vector[i] = &value
+	}
+	field := data.NewField(name, nil, vector)
+	field.Config = &data.FieldConfig{Filterable: &isFilterable}
+	return field
+}
+
+// dateLayouts are the layouts dates without a custom format are parsed with
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// toTime converts a date, which is a string or a number of milliseconds since the
+// epoch. Dates without a time zone are in UTC.
+func toTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		for _, layout := range dateLayouts {
+			if parsed, err := time.Parse(layout, t); err == nil {
+				return parsed, true
+			}
+		}
+	}
+	if ms, ok := toNumber(v); ok {
+		return time.UnixMicro(int64(math.Round(ms * 1000))).UTC(), true
+	}
+	return time.Time{}, false
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toBool(v interface{}) (bool, bool) {
+	switch b := v.(type) {
+	case bool:
+		return b, true
+	case string:
+		parsed, err := strconv.ParseBool(b)
+		return parsed, err == nil
+	}
+	return false, false
+}
+
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(s)
+	case time.Time:
+		return s.Format(time.RFC3339Nano)
+	case json.Number:
+		return s.String()
+	}
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(bytes)
+}
+
+// geoPointFields returns the latitude and longitude columns of a geo_point field,
+// named like the properties of a point object. Points are objects, which are
+// flattened into those properties, "lat,lon" strings, geohashes, [lon, lat] arrays,
+// GeoJSON or WKT points. A field with several points in a document is a JSON column
+// of arrays of point objects instead.
+func geoPointFields(docs []map[string]interface{}, field string, isFilterable bool) []*data.Field {
+	points := make([][]*geoPoint, len(docs))
+	multiValued := false
+	for i, doc := range docs {
+		if v, ok := doc[field]; ok && v != nil {
+			points[i] = decodeGeoPoints(v)
+		} else {
+			lat, latOk := toNumber(doc[field+".lat"])
+			lon, lonOk := toNumber(doc[field+".lon"])
+			if latOk && lonOk {
+				points[i] = []*geoPoint{{Lat: lat, Lon: lon}}
+			}
+		}
+		multiValued = multiValued || len(points[i]) > 1
+	}
+
+	if multiValued {
+		values := make([]interface{}, len(points))
+		for i, p := range points {
+			if len(p) > 0 {
+				values[i] = p
+			}
+		}
+		return []*data.Field{jsonArrayField(field, values, isFilterable)}
+	}
+
+	lats := make([]*float64, len(points))
+	lons := make([]*float64, len(points))
+	for i, p := range points {
+		if len(p) == 1 {
+			lats[i] = &p[0].Lat
+			lons[i] = &p[0].Lon
+		}
+	}
+	latField := data.NewField(field+".lat", nil, lats)
+	latField.Config = &data.FieldConfig{Filterable: &isFilterable}
+	lonField := data.NewField(field+".lon", nil, lons)
+	lonField.Config = &data.FieldConfig{Filterable: &isFilterable}
+	return []*data.Field{latField, lonField}
+}
+
+type geoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// decodeGeoPoints returns the points of the value of a geo_point field, skipping
+// those it can't decode
+func decodeGeoPoints(v interface{}) []*geoPoint {
+	if list, ok := v.([]interface{}); ok {
+		if p, ok := decodeGeoPoint(list); ok {
+			return []*geoPoint{p}
+		}
+		points := make([]*geoPoint, 0, len(list))
+		for _, item := range list {
+			if p, ok := decodeGeoPoint(item); ok {
+				points = append(points, p)
+			}
+		}
+		return points
+	}
+	if p, ok := decodeGeoPoint(v); ok {
+		return []*geoPoint{p}
+	}
+	return nil
+}
+
+func decodeGeoPoint(v interface{}) (*geoPoint, bool) {
+	switch p := v.(type) {
+	case map[string]interface{}:
+		if coordinates, ok := p["coordinates"].([]interface{}); ok {
+			return decodeGeoPoint(coordinates)
+		}
+		lat, latOk := toNumber(p["lat"])
+		lon, lonOk := toNumber(p["lon"])
+		if latOk && lonOk {
+			return &geoPoint{Lat: lat, Lon: lon}, true
+		}
+	case []interface{}:
+		if len(p) == 2 {
+			lon, lonOk := toNumber(p[0])
+			lat, latOk := toNumber(p[1])
+			if latOk && lonOk {
+				return &geoPoint{Lat: lat, Lon: lon}, true
+			}
+		}
+	case string:
+		s := strings.TrimSpace(p)
+		if wkt, ok := strings.CutPrefix(strings.ToUpper(s), "POINT"); ok {
+			coords := strings.Fields(strings.Trim(strings.TrimSpace(wkt), "()"))
+			if len(coords) == 2 {
+				return decodeGeoPoint([]interface{}{coords[0], coords[1]})
+			}
+			return nil, false
+		}
+		if lat, lon, ok := strings.Cut(s, ","); ok {
+			return decodeGeoPoint(map[string]interface{}{"lat": lat, "lon": lon})
+		}
+		if lat, lon, ok := geohashCenter(s); ok {
+			return &geoPoint{Lat: lat, Lon: lon}, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,202 @@
+package opensearch
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFieldMapping(t *testing.T) {
+	mapping := newFieldMapping(map[string][]string{
+		"@timestamp":  {"date"},
+		"bytes":       {"long"},
+		"ratio":       {"float", "scaled_float"},
+		"ok":          {"boolean"},
+		"status":      {"keyword"},
+		"client":      {"ip"},
+		"location":    {"geo_point"},
+		"code":        {"keyword", "long"},
+		"user":        {"object"},
+		"user.tokens": {"nested"},
+		"extra":       {"keyword", "object"},
+	})
+
+	assert.Equal(t, fieldMapping{
+		"@timestamp": fieldKindTime,
+		"bytes":      fieldKindNumber,
+		"ratio":      fieldKindNumber,
+		"ok":         fieldKindBool,
+		"status":     fieldKindString,
+		"client":     fieldKindIP,
+		"location":   fieldKindGeoPoint,
+		"code":       fieldKindString,
+	}, mapping)
+}
+
+func TestFieldMapping_FallbackAndCache(t *testing.T) {
+	dsSettings := &backend.DataSourceInstanceSettings{}
+	from := time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC)
+	to := time.Date(2018, 5, 15, 17, 55, 0, 0, time.UTC)
+	rawDataQuery := `{
+		"timeField": "@timestamp",
+		"metrics": [{ "type": "raw_data", "id": "1" }]
+	}`
+
+	t.Run("client error falls back to no mapping and is not cached", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		assert.Nil(t, lookupFieldMapping(context.Background(), c, dsSettings, "err-index"))
+		_, cached := cachedFieldMapping("|err-index")
+		assert.False(t, cached, "failures should not be cached")
+	})
+
+	t.Run("successful lookup is cached", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		c.fieldTypes = map[string][]string{"bytes": {"long"}}
+		assert.Equal(t, fieldMapping{"bytes": fieldKindNumber}, lookupFieldMapping(context.Background(), c, dsSettings, "mapping-cache-index"))
+
+		// Even if the mapping has changed, the cached one is used
+		c.fieldTypes = map[string][]string{"bytes": {"keyword"}}
+		assert.Equal(t, fieldMapping{"bytes": fieldKindNumber}, lookupFieldMapping(context.Background(), c, dsSettings, "mapping-cache-index"))
+		assert.Equal(t, 1, c.fieldTypesRequests)
+	})
+
+	t.Run("only document queries look up the mapping", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		c.fieldTypes = map[string][]string{"bytes": {"long"}}
+		c.index = "document-queries-"
+
+		_, err := executeTsdbQuery(c, `{
+			"timeField": "@timestamp",
+			"metrics": [{ "type": "count", "id": "1" }],
+			"bucketAggs": [{ "type": "date_histogram", "field": "@timestamp", "id": "2" }]
+		}`, from, to, 15*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, 0, c.fieldTypesRequests)
+
+		_, err = executeTsdbQuery(c, rawDataQuery, from, to, 15*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, 1, c.fieldTypesRequests)
+	})
+
+	t.Run("queries searching the same indices share a lookup", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		c.fieldTypes = map[string][]string{"bytes": {"long"}}
+		c.index = "shared-lookup-"
+		queries := []backend.DataQuery{
+			{RefID: "A", JSON: []byte(rawDataQuery), TimeRange: backend.TimeRange{From: from, To: to}},
+			{RefID: "B", JSON: []byte(rawDataQuery), TimeRange: backend.TimeRange{From: from, To: to}},
+		}
+
+		_, err := newQueryRequest(c, queries, dsSettings).execute(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"shared-lookup-2018.05.15"}, c.fieldTypesIndices)
+	})
+
+	t.Run("the indices of another time range are looked up again", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		c.fieldTypes = map[string][]string{"bytes": {"long"}}
+		c.index = "rolling-"
+
+		_, err := executeTsdbQuery(c, rawDataQuery, from, to, 15*time.Second)
+		require.NoError(t, err)
+		_, err = executeTsdbQuery(c, rawDataQuery, from.Add(24*time.Hour), to.Add(24*time.Hour), 15*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"rolling-2018.05.15", "rolling-2018.05.16"}, c.fieldTypesIndices)
+	})
+}
+
+func Test_processDocsToDataFrameFields_with_mapping(t *testing.T) {
+	t.Run("numeric field whose first value is a string is a number column", func(t *testing.T) {
+		docs := []map[string]interface{}{{"bytes": "12"}, {"bytes": 13.5}, {}}
+		fields := processDocsToDataFrameFields(docs, []string{"bytes"}, fieldMapping{"bytes": fieldKindNumber}, true)
+
+		require.Len(t, fields, 1)
+		assert.Equal(t, data.FieldTypeNullableFloat64, fields[0].Type())
+		assert.EqualValues(t, 12, *fields[0].At(0).(*float64))
+		assert.EqualValues(t, 13.5, *fields[0].At(1).(*float64))
+		assert.Nil(t, fields[0].At(2))
+	})
+
+	t.Run("numeric looking keyword is a string column", func(t *testing.T) {
+		docs := []map[string]interface{}{{"code": 200.0}, {"code": "404"}}
+		fields := processDocsToDataFrameFields(docs, []string{"code"}, fieldMapping{"code": fieldKindString}, true)
+
+		require.Len(t, fields, 1)
+		assert.Equal(t, data.FieldTypeNullableString, fields[0].Type())
+		assert.Equal(t, "200", *fields[0].At(0).(*string))
+		assert.Equal(t, "404", *fields[0].At(1).(*string))
+	})
+
+	t.Run("values which don't convert make a string column", func(t *testing.T) {
+		docs := []map[string]interface{}{{"bytes": 1.0}, {"bytes": "n/a"}}
+		fields := processDocsToDataFrameFields(docs, []string{"bytes"}, fieldMapping{"bytes": fieldKindNumber}, true)
+
+		require.Len(t, fields, 1)
+		assert.Equal(t, data.FieldTypeNullableString, fields[0].Type())
+		assert.Equal(t, "1", *fields[0].At(0).(*string))
+		assert.Equal(t, "n/a", *fields[0].At(1).(*string))
+	})
+
+	t.Run("dates are time columns", func(t *testing.T) {
+		docs := []map[string]interface{}{{"seen": "2024-01-02T03:04:05.123Z"}, {"seen": 1704164645123.0}, {"seen": []interface{}{"2024-01-02 03:04:05"}}}
+		fields := processDocsToDataFrameFields(docs, []string{"seen"}, fieldMapping{"seen": fieldKindTime}, true)
+
+		require.Len(t, fields, 1)
+		assert.Equal(t, data.FieldTypeNullableTime, fields[0].Type())
+		expected := time.Date(2024, 1, 2, 3, 4, 5, 123000000, time.UTC)
+		assert.True(t, expected.Equal(*fields[0].At(0).(*time.Time)))
+		assert.True(t, expected.Equal(*fields[0].At(1).(*time.Time)))
+		assert.True(t, expected.Truncate(time.Second).Equal(*fields[0].At(2).(*time.Time)))
+	})
+
+	t.Run("multi-valued field is a JSON array in every row", func(t *testing.T) {
+		docs := []map[string]interface{}{{"tags": "a"}, {"tags": []interface{}{"b", "c"}}, {}}
+		fields := processDocsToDataFrameFields(docs, []string{"tags"}, fieldMapping{"tags": fieldKindString}, true)
+
+		require.Len(t, fields, 1)
+		assert.Equal(t, data.FieldTypeNullableJSON, fields[0].Type())
+		assert.JSONEq(t, `["a"]`, string(*fields[0].At(0).(*json.RawMessage)))
+		assert.JSONEq(t, `["b","c"]`, string(*fields[0].At(1).(*json.RawMessage)))
+		assert.Nil(t, fields[0].At(2))
+	})
+
+	t.Run("geo points are latitude and longitude columns", func(t *testing.T) {
+		docs := []map[string]interface{}{
+			{"location.lat": 52.5, "location.lon": 13.4},
+			{"location": "52.5,13.4"},
+			{"location": []interface{}{13.4, 52.5}},
+			{"location": "POINT (13.4 52.5)"},
+			{"location": map[string]interface{}{"type": "Point", "coordinates": []interface{}{13.4, 52.5}}},
+			{"location": "u33d"},
+			{},
+		}
+		fields := processDocsToDataFrameFields(docs, []string{"location", "location.lat", "location.lon"}, fieldMapping{"location": fieldKindGeoPoint}, true)
+
+		require.Len(t, fields, 2)
+		assert.Equal(t, "location.lat", fields[0].Name)
+		assert.Equal(t, "location.lon", fields[1].Name)
+		for i := 0; i < 5; i++ {
+			assert.InDelta(t, 52.5, *fields[0].At(i).(*float64), 0.0001)
+			assert.InDelta(t, 13.4, *fields[1].At(i).(*float64), 0.0001)
+		}
+		assert.InDelta(t, 52.5, *fields[0].At(5).(*float64), 0.1)
+		assert.InDelta(t, 13.4, *fields[1].At(5).(*float64), 0.2)
+		assert.Nil(t, fields[0].At(6))
+		assert.Nil(t, fields[1].At(6))
+	})
+
+	t.Run("unmapped fields are typed by their first value", func(t *testing.T) {
+		docs := []map[string]interface{}{{"bytes": "12"}, {"bytes": 13.0}}
+		fields := processDocsToDataFrameFields(docs, []string{"bytes"}, fieldMapping{}, true)
+
+		require.Len(t, fields, 1)
+		assert.Equal(t, data.FieldTypeNullableString, fields[0].Type())
+	})
+}
@@ -0,0 +1,136 @@
+package opensearch
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+	"github.com/grafana/opensearch-datasource/pkg/utils"
+)
+
+const (
+	geotileGridType = "geotile_grid"
+	geoCentroidType = "geo_centroid"
+	geoBoundsType   = "geo_bounds"
+	// defaultGeotilePrecision is the zoom level of geotile grid buckets by default
+	defaultGeotilePrecision = 7
+	// latitudeField and longitudeField are the names of the columns of the centers
+	// of geo grid cells, which the Geomap panel finds without configuration
+	latitudeField  = "latitude"
+	longitudeField = "longitude"
+)
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+func addGeoTileGridAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg) client.AggBuilder {
+	aggBuilder.GeoTileGrid(bucketAgg.ID, bucketAgg.Field, func(a *client.GeoTileGridAggregation, b client.AggBuilder) {
+		a.Precision = utils.StringToIntWithDefaultValue(fmt.Sprint(bucketAgg.Settings.Get("precision").Interface()), defaultGeotilePrecision)
+		if size, err := castToInt(bucketAgg.Settings.Get("size")); err == nil && size > 0 {
+			a.Size = &size
+		}
+		aggBuilder = b
+	})
+
+	return aggBuilder
+}
+
+func isGeoGridAgg(aggType string) bool {
+	return aggType == geohashGridType || aggType == geotileGridType
+}
+
+// geoGridCellCenter returns the latitude and longitude of the center of the cell of
+// a geohash or geotile grid bucket, or nils if its key isn't a valid cell
+func geoGridCellCenter(aggType, key string) (lat, lon *float64) {
+	var la, lo float64
+	var ok bool
+	if aggType == geotileGridType {
+		la, lo, ok = geotileCenter(key)
+	} else {
+		la, lo, ok = geohashCenter(key)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &la, &lo
+}
+
+// geohashCenter decodes a geohash, whose bits alternately halve the longitude and
+// latitude ranges, starting with the longitude
+func geohashCenter(hash string) (lat, lon float64, ok bool) {
+	if hash == "" {
+		return 0, 0, false
+	}
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	even := true
+	for _, c := range strings.ToLower(hash) {
+		idx := strings.IndexRune(geohashAlphabet, c)
+		if idx < 0 {
+			return 0, 0, false
+		}
+		for bit := 4; bit >= 0; bit-- {
+			r := &latRange
+			if even {
+				r = &lonRange
+			}
+			mid := (r[0] + r[1]) / 2
+			if idx>>bit&1 == 1 {
+				r[0] = mid
+			} else {
+				r[1] = mid
+			}
+			even = !even
+		}
+	}
+	return (latRange[0] + latRange[1]) / 2, (lonRange[0] + lonRange[1]) / 2, true
+}
+
+// geotileCenter decodes a "zoom/x/y" web mercator map tile
+func geotileCenter(key string) (lat, lon float64, ok bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 3 {
+		return 0, 0, false
+	}
+	coords := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, 0, false
+		}
+		coords[i] = n
+	}
+	tiles := math.Exp2(float64(coords[0]))
+	x, y := float64(coords[1])+0.5, float64(coords[2])+0.5
+	if x > tiles || y > tiles {
+		return 0, 0, false
+	}
+	lon = x/tiles*360 - 180
+	lat = math.Atan(math.Sinh(math.Pi*(1-2*y/tiles))) * 180 / math.Pi
+	return lat, lon, true
+}
+
+// geoMetricValue is a coordinate of the result of a geo metric
+type geoMetricValue struct {
+	name  string
+	value *float64
+}
+
+// geoMetricValues returns the coordinates of the centroid, or of the edges of the
+// bounding box, of the documents of a bucket
+func geoMetricValues(bucket *simplejson.Json, metric *MetricAgg) []geoMetricValue {
+	if metric.Type == geoCentroidType {
+		return []geoMetricValue{
+			{latitudeField, castToFloat(bucket.GetPath(metric.ID, "location", "lat"))},
+			{longitudeField, castToFloat(bucket.GetPath(metric.ID, "location", "lon"))},
+		}
+	}
+	return []geoMetricValue{
+		{"top", castToFloat(bucket.GetPath(metric.ID, "bounds", "top_left", "lat"))},
+		{"left", castToFloat(bucket.GetPath(metric.ID, "bounds", "top_left", "lon"))},
+		{"bottom", castToFloat(bucket.GetPath(metric.ID, "bounds", "bottom_right", "lat"))},
+		{"right", castToFloat(bucket.GetPath(metric.ID, "bounds", "bottom_right", "lon"))},
+	}
+}
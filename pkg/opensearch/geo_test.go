@@ -0,0 +1,44 @@
+package opensearch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_geoGridCellCenter(t *testing.T) {
+	t.Run("decodes a geohash", func(t *testing.T) {
+		lat, lon := geoGridCellCenter(geohashGridType, "u33dc0")
+		require.NotNil(t, lat)
+		require.NotNil(t, lon)
+		assert.InDelta(t, 52.5178, *lat, 0.003)
+		assert.InDelta(t, 13.4033, *lon, 0.006)
+	})
+
+	t.Run("decodes a geotile", func(t *testing.T) {
+		lat, lon := geoGridCellCenter(geotileGridType, "0/0/0")
+		require.NotNil(t, lat)
+		require.NotNil(t, lon)
+		assert.InDelta(t, 0, *lat, 1e-9)
+		assert.InDelta(t, 0, *lon, 1e-9)
+
+		lat, lon = geoGridCellCenter(geotileGridType, "2/3/3")
+		require.NotNil(t, lat)
+		assert.InDelta(t, -79.17, *lat, 0.01)
+		assert.InDelta(t, 135, *lon, 1e-9)
+	})
+
+	t.Run("returns nils for invalid keys", func(t *testing.T) {
+		for _, tc := range []struct{ aggType, key string }{
+			{geohashGridType, ""},
+			{geohashGridType, "u33a!"},
+			{geotileGridType, "1/2/0"},
+			{geotileGridType, "a/b/c"},
+		} {
+			lat, lon := geoGridCellCenter(tc.aggType, tc.key)
+			assert.Nil(t, lat, tc.key)
+			assert.Nil(t, lon, tc.key)
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package opensearch
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	// highlightPreTag and highlightPostTag surround the terms of highlighted values
+	// which match the query of a logs query
+	highlightPreTag  = "@HIGHLIGHT@"
+	highlightPostTag = "@/HIGHLIGHT@"
+)
+
+// highlightedWords adds the terms between highlight tags in the values of the
+// highlight section of a hit to words
+func highlightedWords(highlight map[string]interface{}, words map[string]bool) {
+	for _, fragments := range highlight {
+		list, ok := fragments.([]interface{})
+		if !ok {
+			continue
+		}
+		for _, fragment := range list {
+			s, ok := fragment.(string)
+			if !ok {
+				continue
+			}
+			for {
+				_, rest, found := strings.Cut(s, highlightPreTag)
+				if !found {
+					break
+				}
+				word, after, found := strings.Cut(rest, highlightPostTag)
+				if !found {
+					break
+				}
+				if word != "" {
+					words[word] = true
+				}
+				s = after
+			}
+		}
+	}
+}
+
+// sortedSearchWords returns the highlighted words of a logs frame in a stable order
+func sortedSearchWords(words map[string]bool) []string {
+	sorted := make([]string, 0, len(words))
+	for word := range words {
+		sorted = append(sorted, word)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
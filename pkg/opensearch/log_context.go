@@ -0,0 +1,208 @@
+package opensearch
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+	"github.com/grafana/opensearch-datasource/pkg/tsdb"
+)
+
+const (
+	// logContext is the handler of log context queries, which can be Lucene or PPL queries
+	logContext = "logContext"
+	// defaultLogContextLimit is the number of documents returned in each direction
+	defaultLogContextLimit = 10
+
+	logContextBackward = "BACKWARD"
+	logContextForward  = "FORWARD"
+)
+
+// logContextSettings locate the log row whose surrounding documents a log context
+// query returns. Sort holds the row's sort values of a Lucene logs query, PPL rows
+// only have a timestamp.
+type logContextSettings struct {
+	Timestamp int64
+	ID        string
+	Sort      []interface{}
+	Index     string
+	Limit     int
+	// Direction is BACKWARD for older documents, FORWARD for newer ones, or empty for both
+	Direction string
+}
+
+// parseLogContextSettings reads the "logContext" object of the query model
+func parseLogContextSettings(model *simplejson.Json) *logContextSettings {
+	logContext := model.Get("logContext")
+	limit := logContext.Get("limit").MustInt(defaultLogContextLimit)
+	if limit <= 0 {
+		limit = defaultLogContextLimit
+	}
+	return &logContextSettings{
+		Timestamp: logContext.Get("timestamp").MustInt64(),
+		ID:        logContext.Get("id").MustString(),
+		Sort:      logContext.Get("sort").MustArray(),
+		Index:     logContext.Get("index").MustString(),
+		Limit:     limit,
+		Direction: logContext.Get("direction").MustString(),
+	}
+}
+
+// searchAfter returns the position of the row in a search sorted by time field and,
+// when the row has an ID, _id. The row's sort value of the time field is more
+// precise than its timestamp, e.g. for date_nanos fields.
+func (s *logContextSettings) searchAfter() []interface{} {
+	var sortTime interface{} = s.Timestamp
+	if len(s.Sort) > 0 {
+		sortTime = s.Sort[0]
+	}
+	if s.ID == "" {
+		return []interface{}{sortTime}
+	}
+	return []interface{}{sortTime, s.ID}
+}
+
+// index returns the index the row was found in, or the index of its query
+func (s *logContextSettings) index(q *Query) string {
+	if s.Index == "" && q.QueryType == Lucene {
+		return q.Index
+	}
+	return s.Index
+}
+
+// logContextHandler returns the documents surrounding a log row, in the logs frame
+// format. The documents are searched for in the row's index regardless of the
+// query's language or query string, so it serves Lucene and PPL logs queries alike.
+type logContextHandler struct {
+	client     client.Client
+	dsSettings *backend.DataSourceInstanceSettings
+	limiter    concurrencyLimiter
+	queries    map[string]*Query
+}
+
+func newLogContextHandler(openSearchClient client.Client, dsSettings *backend.DataSourceInstanceSettings, limiter concurrencyLimiter) *logContextHandler {
+	return &logContextHandler{
+		client:     openSearchClient,
+		dsSettings: dsSettings,
+		limiter:    limiter,
+		queries:    make(map[string]*Query),
+	}
+}
+
+func (h *logContextHandler) processQuery(q *Query) error {
+	isLogsQuery := (q.QueryType == Lucene && len(q.Metrics) > 0 && q.Metrics[0].Type == logsType) ||
+		(q.QueryType == PPL && q.Format == logsType)
+	if !isLogsQuery {
+		return backend.DownstreamError(errors.New("log context is only supported for Lucene and PPL logs queries"))
+	}
+	if q.logContext.Timestamp == 0 && len(q.logContext.Sort) == 0 {
+		return backend.DownstreamError(errors.New("log context requires the timestamp or sort values of the log row"))
+	}
+	switch q.logContext.Direction {
+	case "", logContextBackward, logContextForward:
+	default:
+		return backend.DownstreamErrorf("invalid log context direction %q, expected %s or %s", q.logContext.Direction, logContextBackward, logContextForward)
+	}
+	h.queries[q.RefID] = q
+	return nil
+}
+
+func (h *logContextHandler) executeQueries(ctx context.Context) (*backend.QueryDataResponse, error) {
+	refIDs := make([]string, 0, len(h.queries))
+	for refID := range h.queries {
+		refIDs = append(refIDs, refID)
+	}
+	results := executeConcurrently(ctx, h.limiter, refIDs, h.executeQuery)
+	return collectResults(results), nil
+}
+
+// executeQuery searches for the documents before and after the row in one
+// multisearch, and returns them newest first like a logs query
+func (h *logContextHandler) executeQuery(ctx context.Context, refID string) (backend.DataResponse, error) {
+	q := h.queries[refID]
+	settings := q.logContext
+
+	directions := []string{logContextForward, logContextBackward}
+	if settings.Direction != "" {
+		directions = []string{settings.Direction}
+	}
+
+	ms := h.client.MultiSearch()
+	for _, direction := range directions {
+		h.addSearch(ms, q, direction)
+	}
+	req, err := ms.Build()
+	if err != nil {
+		return backend.DataResponse{}, backend.PluginError(err)
+	}
+	for _, search := range req.Requests {
+		search.SearchAfter = settings.searchAfter()
+	}
+
+	res, err := h.client.ExecuteMultisearch(ctx, req)
+	if err != nil {
+		if backend.IsDownstreamHTTPError(err) {
+			err = backend.DownstreamError(err)
+		}
+		return backend.DataResponse{}, err
+	}
+	if len(res.Responses) != len(directions) {
+		return backend.DataResponse{}, backend.PluginErrorf("expected %d multisearch responses, got %d", len(directions), len(res.Responses))
+	}
+
+	hits := make([]map[string]interface{}, 0, len(directions)*settings.Limit)
+	for i, direction := range directions {
+		searchRes := res.Responses[i]
+		if searchRes.Error != nil {
+			return backend.DataResponse{}, backend.DownstreamError(getErrorFromOpenSearchResponse(searchRes))
+		}
+		if searchRes.Hits == nil {
+			continue
+		}
+		directionHits := searchRes.Hits.Hits
+		if direction == logContextForward {
+			// newer documents are searched for oldest first
+			directionHits = slices.Clone(directionHits)
+			slices.Reverse(directionHits)
+		}
+		hits = append(hits, directionHits...)
+	}
+
+	// the documents are typed like those of the logs query of the row
+	mapping := lookupFieldMapping(ctx, h.client, h.dsSettings, h.client.SearchIndex(settings.index(q), q.TimeRange))
+	queryRes := processLogsResponse(&client.SearchResponse{Hits: &client.SearchResponseHits{Hits: hits}}, h.client.GetConfiguredFields(), mapping, backend.DataResponse{})
+	if queryRes.Error != nil {
+		return backend.DataResponse{}, queryRes.Error
+	}
+	for _, frame := range queryRes.Frames {
+		frame.RefID = refID
+	}
+	return queryRes, nil
+}
+
+// addSearch adds the search for the documents in one direction from the row, sorted
+// by time field and _id so documents with the same timestamp keep their order. Rows
+// without an ID, such as those of PPL queries, can't be told apart from the other
+// documents with their timestamp, so those are left out in both directions rather
+// than returning the row itself.
+func (h *logContextHandler) addSearch(ms *client.MultiSearchRequestBuilder, q *Query, direction string) {
+	order := descending
+	if direction == logContextForward {
+		order = ascending
+	}
+	timeField := h.client.GetConfiguredFields().TimeField
+
+	b := ms.Search(tsdb.Interval{}, q.TimeRange)
+	if index := q.logContext.index(q); index != "" {
+		b.SetIndex(index)
+	}
+	b.Size(q.logContext.Limit)
+	b.Sort(order, timeField, "boolean")
+	if q.logContext.ID != "" {
+		b.Sort(order, "_id", "")
+	}
+	b.SetCustomProps(timeField, logsType)
+}
@@ -0,0 +1,213 @@
+package opensearch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+	"github.com/grafana/opensearch-datasource/pkg/utils"
+)
+
+const (
+	// logsVolumeLevelsSize is the number of distinct log levels a logs volume query splits by
+	logsVolumeLevelsSize = 20
+	// unknownLogLevel labels documents without a level, or with one Grafana doesn't know
+	unknownLogLevel = "unknown"
+)
+
+// logLevels maps lowercase log level values to the levels Grafana colors logs volume
+// series by, see getLogLevelFromKey in Grafana
+var logLevels = map[string]string{
+	"emerg":         "critical",
+	"fatal":         "critical",
+	"alert":         "critical",
+	"crit":          "critical",
+	"critical":      "critical",
+	"eror":          "error",
+	"err":           "error",
+	"error":         "error",
+	"warn":          "warning",
+	"warning":       "warning",
+	"info":          "info",
+	"information":   "info",
+	"informational": "info",
+	"notice":        "info",
+	"dbug":          "debug",
+	"debug":         "debug",
+	"trace":         "trace",
+	"unknown":       unknownLogLevel,
+}
+
+// normalizeLogLevel returns the Grafana log level of a level field value
+func normalizeLogLevel(value interface{}) string {
+	s, ok := value.(string)
+	if !ok {
+		return unknownLogLevel
+	}
+	if level, ok := logLevels[strings.ToLower(strings.TrimSpace(s))]; ok {
+		return level
+	}
+	return unknownLogLevel
+}
+
+// processLogsVolumeQuery requests the number of documents per interval and log level
+func processLogsVolumeQuery(b *client.SearchRequestBuilder, from, to int64, defaultTimeField, logLevelField, timeZone string) {
+	b.Size(0)
+	histogram := &BucketAgg{
+		Type:     dateHistType,
+		Field:    defaultTimeField,
+		ID:       "1",
+		Settings: utils.NewJsonFromAny(map[string]interface{}{"interval": "auto", "min_doc_count": 0}),
+	}
+	aggBuilder := addDateHistogramAgg(b.Agg(), histogram, from, to, defaultTimeField, timeZone)
+	if logLevelField == "" {
+		return
+	}
+	aggBuilder.Terms("2", logLevelField, func(a *client.TermsAggregation, _ client.AggBuilder) {
+		a.Size = logsVolumeLevelsSize
+		missing := unknownLogLevel
+		a.Missing = &missing
+	})
+}
+
+// processLogsVolumeResponse turns the date histogram of a logs volume query, split
+// by log level if one is configured, into logs volume frames
+func processLogsVolumeResponse(res *client.SearchResponse, target *Query, configuredFields client.ConfiguredFields, queryRes backend.DataResponse) backend.DataResponse {
+	volume := newLogsVolume()
+	histogram, _ := res.Aggregations["1"].(map[string]interface{})
+	buckets, _ := histogram["buckets"].([]interface{})
+	for _, b := range buckets {
+		bucket, ok := b.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		key, ok := bucket["key"].(float64)
+		if !ok {
+			continue
+		}
+		t := time.UnixMilli(int64(key)).UTC()
+
+		levels, hasLevels := bucket["2"].(map[string]interface{})
+		if configuredFields.LogLevelField == "" || !hasLevels {
+			count, _ := bucket["doc_count"].(float64)
+			volume.add(t, unknownLogLevel, count)
+			continue
+		}
+		volume.addTime(t)
+		levelBuckets, _ := levels["buckets"].([]interface{})
+		for _, lb := range levelBuckets {
+			levelBucket, ok := lb.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			count, _ := levelBucket["doc_count"].(float64)
+			volume.add(t, normalizeLogLevel(levelBucket["key"]), count)
+		}
+	}
+
+	queryRes.Frames = append(queryRes.Frames, volume.frames(target.TimeRange)...)
+	return queryRes
+}
+
+// logsVolumePPLQuery returns a PPL query counting the documents of query per span and level
+func logsVolumePPLQuery(query, index, timeField, logLevelField string, interval time.Duration) string {
+	query = strings.TrimSpace(query)
+	if query == "" || strings.HasPrefix(query, "|") {
+		query = strings.TrimSpace(fmt.Sprintf("source = %s %s", index, query))
+	}
+	stats := fmt.Sprintf(" | stats count() by span(`%s`, %s)", timeField, pplSpan(interval))
+	if logLevelField != "" {
+		stats += fmt.Sprintf(", `%s`", logLevelField)
+	}
+	return query + stats
+}
+
+// pplSpan formats interval as a PPL span length in the largest unit that keeps it exact
+func pplSpan(interval time.Duration) string {
+	switch {
+	case interval <= 0:
+		return "1m"
+	case interval%time.Hour == 0:
+		return fmt.Sprintf("%dh", interval/time.Hour)
+	case interval%time.Minute == 0:
+		return fmt.Sprintf("%dm", interval/time.Minute)
+	case interval%time.Second == 0:
+		return fmt.Sprintf("%ds", interval/time.Second)
+	default:
+		return fmt.Sprintf("%dms", interval.Milliseconds())
+	}
+}
+
+// logsVolume counts documents per time and normalized log level
+type logsVolume struct {
+	times  map[time.Time]bool
+	counts map[string]map[time.Time]float64
+}
+
+func newLogsVolume() *logsVolume {
+	return &logsVolume{
+		times:  make(map[time.Time]bool),
+		counts: make(map[string]map[time.Time]float64),
+	}
+}
+
+// addTime makes sure there is a point at t, even if no level has documents then
+func (v *logsVolume) addTime(t time.Time) {
+	v.times[t] = true
+}
+
+func (v *logsVolume) add(t time.Time, level string, count float64) {
+	v.addTime(t)
+	if v.counts[level] == nil {
+		v.counts[level] = make(map[time.Time]float64)
+	}
+	// levels that normalize to the same label are summed, e.g. WARN and warning
+	v.counts[level][t] += count
+}
+
+// frames returns a time series per level, sorted by level, with a point at every
+// time so stacked series line up. The frames carry the meta data Grafana expects
+// of a full range logs volume.
+func (v *logsVolume) frames(timeRange backend.TimeRange) data.Frames {
+	times := make([]time.Time, 0, len(v.times))
+	for t := range v.times {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	levels := make([]string, 0, len(v.counts))
+	for level := range v.counts {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+
+	frames := make(data.Frames, 0, len(levels))
+	for _, level := range levels {
+		values := make([]float64, len(times))
+		for i, t := range times {
+			values[i] = v.counts[level][t]
+		}
+		valueField := data.NewField(data.TimeSeriesValueFieldName, data.Labels{"level": level}, values)
+		valueField.Config = &data.FieldConfig{DisplayNameFromDS: level}
+
+		frame := data.NewFrame(level, data.NewField(data.TimeSeriesTimeFieldName, nil, times), valueField)
+		frame.Meta = &data.FrameMeta{
+			Type:                   data.FrameTypeTimeSeriesMulti,
+			TypeVersion:            data.FrameTypeVersion{0, 1},
+			PreferredVisualization: data.VisTypeGraph,
+			Custom: map[string]interface{}{
+				"logsVolumeType": "FullRange",
+				"absoluteRange": map[string]int64{
+					"from": timeRange.From.UnixMilli(),
+					"to":   timeRange.To.UnixMilli(),
+				},
+			},
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
@@ -0,0 +1,38 @@
+package opensearch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_normalizeLogLevel(t *testing.T) {
+	for value, expected := range map[interface{}]string{
+		"ERROR":   "error",
+		"err":     "error",
+		"WARN":    "warning",
+		" Info ":  "info",
+		"notice":  "info",
+		"FATAL":   "critical",
+		"debug":   "debug",
+		"trace":   "trace",
+		"verbose": "unknown",
+		"":        "unknown",
+		3:         "unknown",
+		nil:       "unknown",
+	} {
+		assert.Equal(t, expected, normalizeLogLevel(value), "%v", value)
+	}
+}
+
+func Test_logsVolumePPLQuery(t *testing.T) {
+	assert.Equal(t, "source = logs | where status = 500 | stats count() by span(`@timestamp`, 1m), `level`",
+		logsVolumePPLQuery("source = logs | where status = 500", "default", "@timestamp", "level", time.Minute))
+	assert.Equal(t, "source = default | stats count() by span(`@timestamp`, 30s)",
+		logsVolumePPLQuery("", "default", "@timestamp", "", 30*time.Second))
+	assert.Equal(t, "source = default | where `level` = 'error' | stats count() by span(`@timestamp`, 2h)",
+		logsVolumePPLQuery("| where `level` = 'error'", "default", "@timestamp", "", 2*time.Hour))
+	assert.Equal(t, "source = logs | stats count() by span(`@timestamp`, 1500ms)",
+		logsVolumePPLQuery("source = logs", "default", "@timestamp", "", 1500*time.Millisecond))
+}
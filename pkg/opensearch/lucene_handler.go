@@ -2,14 +2,18 @@ package opensearch
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bitly/go-simplejson"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
 	"github.com/grafana/opensearch-datasource/pkg/tsdb"
 	"github.com/grafana/opensearch-datasource/pkg/utils"
@@ -22,38 +26,65 @@ const (
 	// or "No limit" (size 0) is selected. addTermsAgg and configuredTermsSize must
 	// agree on this so the bucket budget matches the request we send.
 	defaultTermsSize = 500
+	// maxPageSize is the default index.max_result_window, the most documents a
+	// single search can return
+	maxPageSize = 10000
+	// pointInTimeKeepAlive only needs to cover the time between two pages
+	pointInTimeKeepAlive = "1m"
 )
 
 type luceneHandler struct {
 	client     client.Client
-	reqQueries []backend.DataQuery
 	ms         *client.MultiSearchRequestBuilder
 	queries    []*Query
 	dsSettings *backend.DataSourceInstanceSettings
+	limiter    concurrencyLimiter
+	// paginated holds the searches of queries fetching more documents than a
+	// single page, keyed by their index in queries. They are not part of ms.
+	paginated map[int]*paginatedSearch
 }
 
-func newLuceneHandler(client client.Client, queries []backend.DataQuery, dsSettings *backend.DataSourceInstanceSettings) *luceneHandler {
+// paginatedSearch is a search fetched page by page, with search_after for documents
+// or with the after_key of its composite aggregation
+type paginatedSearch struct {
+	ms    *client.MultiSearchRequestBuilder
+	limit int
+	// composite is the key of the composite aggregation paged through, if any
+	composite string
+	// notices are warnings about the pages that failed to be fetched, or that were
+	// not fetched because of the limit
+	notices []data.Notice
+}
+
+func newLuceneHandler(client client.Client, dsSettings *backend.DataSourceInstanceSettings, limiter concurrencyLimiter) *luceneHandler {
 	return &luceneHandler{
 		client:     client,
-		reqQueries: queries,
 		ms:         client.MultiSearch(),
 		queries:    make([]*Query, 0),
 		dsSettings: dsSettings,
+		limiter:    limiter,
+		paginated:  make(map[int]*paginatedSearch),
 	}
 }
 
 func (h *luceneHandler) processQuery(q *Query) error {
 	if len(q.BucketAggs) == 0 {
-		// If no aggregations, only trace, document, and logs queries are valid
-		if q.luceneQueryType != "Traces" {
+		// If no aggregations, only trace, annotation, logs volume, document, and logs queries are valid
+		if q.luceneQueryType != luceneQueryTypeTraces && q.annotation == nil && !q.logsVolume {
 			if len(q.Metrics) == 0 || (q.Metrics[0].Type != rawDataType && q.Metrics[0].Type != rawDocumentType && q.Metrics[0].Type != logsType) {
 				return backend.DownstreamErrorf("invalid query, missing metrics and aggregations")
 			}
 		}
 	}
+	if err := validateCompositeAgg(q); err != nil {
+		return err
+	}
+	if err := validateMultiTermsAggs(q); err != nil {
+		return err
+	}
 
-	fromMs := h.reqQueries[0].TimeRange.From.UnixNano() / int64(time.Millisecond)
-	toMs := h.reqQueries[0].TimeRange.To.UnixNano() / int64(time.Millisecond)
+	fromMs := q.TimeRange.From.UnixNano() / int64(time.Millisecond)
+	toMs := q.TimeRange.To.UnixNano() / int64(time.Millisecond)
 
 	minInterval, err := h.client.GetMinInterval(q.Interval)
 	if err != nil {
@@ -69,14 +100,28 @@ func (h *luceneHandler) processQuery(q *Query) error {
 	if hasAutoDateHistogram(q.BucketAggs) && hasTermsAgg(q.BucketAggs) {
 		termsProduct = termsBucketProduct(q.BucketAggs, h.numberOfShards(q.Index), maxBuckets)
 	}
-	interval, err := tsdb.CalculateInterval(&h.reqQueries[0].TimeRange, minInterval, termsProduct, maxBuckets)
+	interval, err := tsdb.CalculateInterval(&q.TimeRange, minInterval, termsProduct, maxBuckets)
 	if err != nil {
 		return backend.DownstreamError(err)
 	}
 
 	h.queries = append(h.queries, q)
 
-	b := h.ms.Search(interval)
+	var b *client.SearchRequestBuilder
+	limit := documentsLimit(q)
+	composite := compositeBucketAgg(q)
+	if limit > 0 || composite != nil {
+		ms := h.client.MultiSearch()
+		b = ms.Search(interval, q.TimeRange)
+		p := &paginatedSearch{ms: ms, limit: limit}
+		if composite != nil {
+			p.composite = composite.ID
+			p.limit = compositeLimit(composite)
+		}
+		h.paginated[len(h.queries)-1] = p
+	} else {
+		b = h.ms.Search(interval, q.TimeRange)
+	}
 	if q.Index != "" {
 		b.SetIndex(q.Index)
 	}
@@ -111,24 +156,50 @@ func (h *luceneHandler) processQuery(q *Query) error {
 		return nil
 	}
 
+	if q.annotation != nil {
+		processAnnotationsQuery(q, b, fromMs, toMs, defaultTimeField)
+		return nil
+	}
+
 	filters.AddDateRangeFilter(defaultTimeField, client.DateFormatEpochMS, toMs, fromMs)
 	if q.RawQuery != "" && q.luceneQueryType != luceneQueryTypeTraces {
 		filters.AddQueryStringFilter(q.RawQuery, true)
 	}
 
+	if q.logsVolume {
+		processLogsVolumeQuery(b, fromMs, toMs, defaultTimeField, h.client.GetConfiguredFields().LogLevelField, q.TimeZone)
+		return nil
+	}
+
 	switch q.Metrics[0].Type {
 	case rawDocumentType, rawDataType:
 		processDocumentQuery(q, b, defaultTimeField)
 	case logsType:
-		processLogsQuery(q, b, fromMs, toMs, defaultTimeField)
+		processLogsQuery(q, b, fromMs, toMs, defaultTimeField, h.client.GetConfiguredFields().LogMessageField)
+		if limit > 0 {
+			// search_after needs a tiebreaker for documents with the same timestamp
+			b.Sort(descending, "_doc", "")
+		}
 	default:
 		processTimeSeriesQuery(q, b, fromMs, toMs, defaultTimeField)
 	}
 	return nil
 }
 
+// isDocumentQuery returns whether the response to a query is a frame of documents,
+// whose columns are typed by the mapping of their fields
+func isDocumentQuery(q *Query) bool {
+	if q.luceneQueryType == luceneQueryTypeTraces {
+		return q.serviceMapInfo.Type == Not && getTraceId(q.RawQuery) != ""
+	}
+	if q.annotation != nil || q.logsVolume || q.logContext != nil || len(q.Metrics) == 0 {
+		return false
+	}
+	return q.Metrics[0].Type == rawDataType || q.Metrics[0].Type == logsType
+}
+
 // termsBucketProduct returns the product of the per-terms bucket estimates of all
-// terms bucket aggregations, capped at ceiling to avoid overflow when many large
+// terms and multi terms bucket aggregations, capped at ceiling to avoid overflow when many large
 // terms aggregations are combined. A product at or above ceiling already exceeds
 // any usable bucket budget, so returning ceiling is sufficient for the interval
 // math. shards is the number of shards the target index has, which drives how many
@@ -136,7 +207,7 @@ func (h *luceneHandler) processQuery(q *Query) error {
 func termsBucketProduct(bucketAggs []*BucketAgg, shards, ceiling int64) int64 {
 	var product int64 = 1
 	for _, bucketAgg := range bucketAggs {
-		if bucketAgg.Type != termsType {
+		if bucketAgg.Type != termsType && bucketAgg.Type != multiTermsType {
 			continue
 		}
 		product *= termsBucketEstimate(configuredTermsSize(bucketAgg), shards)
@@ -195,11 +266,12 @@ func hasAutoDateHistogram(bucketAggs []*BucketAgg) bool {
 	return false
 }
 
-// hasTermsAgg reports whether any bucket aggregation is a terms aggregation, i.e.
-// whether the query can multiply the bucket count beyond the date histogram alone.
+// hasTermsAgg reports whether any bucket aggregation is a terms or multi terms
+// aggregation, i.e. whether the query can multiply the bucket count beyond the date
+// histogram alone.
 func hasTermsAgg(bucketAggs []*BucketAgg) bool {
 	for _, bucketAgg := range bucketAggs {
-		if bucketAgg.Type == termsType {
+		if bucketAgg.Type == termsType || bucketAgg.Type == multiTermsType {
 			return true
 		}
 	}
@@ -218,17 +290,21 @@ func getTraceId(rawQuery string) string {
 	return strings.TrimSpace(matches[1])
 }
 
-func processLogsQuery(q *Query, b *client.SearchRequestBuilder, from, to int64, defaultTimeField string) {
+func processLogsQuery(q *Query, b *client.SearchRequestBuilder, from, to int64, defaultTimeField, logMessageField string) {
 	metric := q.Metrics[0]
 	b.Sort(descending, defaultTimeField, "boolean")
 	b.SetCustomProps(defaultTimeField, "logs")
-
-	sizeString := metric.Settings.Get("size").MustString()
-	size, err := strconv.Atoi(sizeString)
-	if err != nil {
-		size = defaultLogsSize
+	// the terms matching the query are highlighted in the message, or in any field
+	// when the message is the whole source, which can't be highlighted
+	if q.RawQuery != "" {
+		if logMessageField != "" && logMessageField != "_source" {
+			b.Highlight(highlightPreTag, highlightPostTag, logMessageField)
+		} else {
+			b.Highlight(highlightPreTag, highlightPostTag)
+		}
 	}
-	b.Size(size)
+
+	b.Size(documentsSize(metric))
 
 	// For log query, we use only date histogram aggregation
 	aggBuilder := b.Agg()
@@ -242,7 +318,7 @@ func processLogsQuery(q *Query, b *client.SearchRequestBuilder, from, to int64,
 	defaultBucketAgg.Settings = utils.NewJsonFromAny(
 		defaultBucketAgg.generateSettingsForDSL(),
 	)
-	_ = addDateHistogramAgg(aggBuilder, defaultBucketAgg, from, to, defaultTimeField)
+	_ = addDateHistogramAgg(aggBuilder, defaultBucketAgg, from, to, defaultTimeField, q.TimeZone)
 }
 
 func (bucketAgg BucketAgg) generateSettingsForDSL() map[string]interface{} {
@@ -265,33 +341,105 @@ func processDocumentQuery(q *Query, b *client.SearchRequestBuilder, defaultTimeF
 	b.Sort(order, defaultTimeField, "boolean")
 	b.Sort(order, "_doc", "")
 	b.SetCustomProps(defaultTimeField, "raw_document")
+	b.Size(documentsSize(metric))
+}
+
+// documentsSize returns the number of documents a raw data, raw document or
+// logs query requests per search
+func documentsSize(metric *MetricAgg) int {
 	sizeString := metric.Settings.Get("size").MustString()
 	size, err := strconv.Atoi(sizeString)
 	if err != nil {
 		size = defaultLogsSize
 	}
-	b.Size(size)
+	return size
+}
+
+// documentsLimit returns the total number of documents to fetch for queries that
+// are paged through with search_after, or 0 if the query fits in a single search.
+// Pagination is enabled by setting a "limit" larger than the page size.
+func documentsLimit(q *Query) int {
+	if q.luceneQueryType == luceneQueryTypeTraces || q.annotation != nil || q.logsVolume || len(q.Metrics) == 0 {
+		return 0
+	}
+	metric := q.Metrics[0]
+	if metric.Type != rawDocumentType && metric.Type != rawDataType && metric.Type != logsType {
+		return 0
+	}
+	limit := utils.StringToIntWithDefaultValue(metric.Settings.Get("limit").MustString(), 0)
+	if limit <= min(documentsSize(metric), maxPageSize) {
+		return 0
+	}
+	return limit
+}
+
+// processAnnotationsQuery requests the documents an annotation query turns into events.
+// With an end time field, a region matches if it overlaps the time range, i.e. it
+// starts before the range ends and ends after the range starts, which includes
+// regions spanning the whole range. Documents without an end match if they start in
+// the range. The latest documents are returned first, so those are kept when more
+// match than the size of the search.
+func processAnnotationsQuery(q *Query, b *client.SearchRequestBuilder, from, to int64, defaultTimeField string) {
+	timeField := q.annotation.timeField(defaultTimeField)
+	filters := b.Query().Bool().Filter()
+	if q.annotation.TimeEndField == "" {
+		filters.AddDateRangeFilter(timeField, client.DateFormatEpochMS, to, from)
+	} else {
+		filters.AddFilterQuery(client.Query{
+			Bool: &client.BoolQuery{
+				ShouldFilters: []client.Filter{
+					client.Query{Bool: &client.BoolQuery{Filters: []client.Filter{
+						&client.RangeBoundFilter{Key: timeField, Operator: "lte", Value: to, Format: client.DateFormatEpochMS},
+						&client.RangeBoundFilter{Key: q.annotation.TimeEndField, Operator: "gte", Value: from, Format: client.DateFormatEpochMS},
+					}}},
+					&client.RangeFilter{Key: timeField, Lte: to, Gte: from, Format: client.DateFormatEpochMS},
+				},
+			},
+		})
+	}
+	filters.AddQueryStringFilter(q.RawQuery, true)
+
+	b.Sort(descending, timeField, "boolean")
+	b.SetCustomProps(timeField, annotationsType)
+	b.Size(defaultAnnotationsSize)
 }
 
 func processTimeSeriesQuery(q *Query, b *client.SearchRequestBuilder, fromMs int64, toMs int64, defaultTimeField string) {
 	aggBuilder := b.Agg()
+	// siblingBuilder adds aggregations next to the innermost bucket aggregation
+	siblingBuilder := aggBuilder
 
 	// iterate backwards to create aggregations bottom-down
 	for _, bucketAgg := range q.BucketAggs {
 		bucketAgg.Settings = utils.NewJsonFromAny(
 			bucketAgg.generateSettingsForDSL(),
 		)
+		siblingBuilder = aggBuilder
 		switch bucketAgg.Type {
 		case dateHistType:
-			aggBuilder = addDateHistogramAgg(aggBuilder, bucketAgg, fromMs, toMs, defaultTimeField)
+			aggBuilder = addDateHistogramAgg(aggBuilder, bucketAgg, fromMs, toMs, defaultTimeField, q.TimeZone)
+		case autoDateHistType:
+			aggBuilder = addAutoDateHistogramAgg(aggBuilder, bucketAgg, q.MaxDataPoints, defaultTimeField, q.TimeZone)
 		case histogramType:
 			aggBuilder = addHistogramAgg(aggBuilder, bucketAgg)
 		case filtersType:
 			aggBuilder = addFiltersAgg(aggBuilder, bucketAgg)
 		case termsType:
-			aggBuilder = addTermsAgg(aggBuilder, bucketAgg, q.Metrics)
+			aggBuilder = addTermsAgg(aggBuilder, bucketAgg, q.Metrics, defaultTimeField)
+		case multiTermsType:
+			aggBuilder = addMultiTermsAgg(aggBuilder, bucketAgg, q.Metrics, defaultTimeField)
 		case geohashGridType:
 			aggBuilder = addGeoHashGridAgg(aggBuilder, bucketAgg)
+		case geotileGridType:
+			aggBuilder = addGeoTileGridAgg(aggBuilder, bucketAgg)
+		case nestedType:
+			aggBuilder = addNestedAgg(aggBuilder, bucketAgg)
+		case reverseNestedType:
+			aggBuilder = addReverseNestedAgg(aggBuilder, bucketAgg)
+		case compositeType:
+			aggBuilder = addCompositeAgg(aggBuilder, bucketAgg, q.TimeZone)
+		case rangeType, dateRangeType, ipRangeType:
+			aggBuilder = addRangeAgg(aggBuilder, bucketAgg, q.TimeZone)
 		}
 	}
 
@@ -301,7 +449,13 @@ func processTimeSeriesQuery(q *Query, b *client.SearchRequestBuilder, fromMs int
 			continue
 		}
 
-		if isPipelineAgg(m.Type) {
+		if isSiblingPipelineAgg(m.Type) {
+			if len(q.BucketAggs) > 0 {
+				addSiblingPipelineAgg(siblingBuilder, m, q.BucketAggs[len(q.BucketAggs)-1], q.Metrics)
+			}
+		} else if m.Type == bucketSortType {
+			addBucketSortAgg(aggBuilder, m, q.Metrics)
+		} else if isPipelineAgg(m.Type) {
 			if isPipelineAggWithMultipleBucketPaths(m.Type) {
 				if len(m.PipelineVariables) > 0 {
 					bucketPaths := map[string]interface{}{}
@@ -354,6 +508,8 @@ func processTimeSeriesQuery(q *Query, b *client.SearchRequestBuilder, fromMs int
 					continue
 				}
 			}
+		} else if m.Type == topMetricsType {
+			addTopMetricsAgg(aggBuilder, m, defaultTimeField)
 		} else {
 			aggBuilder.Metric(m.ID, m.Type, m.Field, func(a *client.MetricAggregation) {
 				a.Settings = m.Settings.MustMap()
@@ -381,30 +537,283 @@ func (h *luceneHandler) executeQueries(ctx context.Context) (*backend.QueryDataR
 		return nil, nil
 	}
 
-	errRefID := h.queries[0].RefID
+	// errs holds the error of every query whose search failed, so the other
+	// queries still return their data
+	errs := make([]error, len(h.queries))
+	responses := make([]*client.SearchResponse, len(h.queries))
+	var debugInfo *client.SearchDebugInfo
+
+	// the searches of the queries which aren't paginated are sent together, while
+	// every paginated search is paged through on its own, all within the limit of
+	// concurrent requests. The field mappings document frames are typed by are
+	// looked up meanwhile.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h.lookupFieldMappings(ctx)
+	}()
+	if len(h.paginated) < len(h.queries) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var searchResponses []*client.SearchResponse
+			var searchErrs []error
+			if err := h.limiter.acquire(ctx); err != nil {
+				searchErrs = make([]error, len(h.queries)-len(h.paginated))
+				for i := range searchErrs {
+					searchErrs[i] = backend.DownstreamError(err)
+				}
+				searchResponses = make([]*client.SearchResponse, len(searchErrs))
+			} else {
+				searchResponses, searchErrs, debugInfo = h.search(ctx)
+				h.limiter.release()
+			}
+			// the responses are in the order of the searches in ms
+			next := 0
+			for i := range h.queries {
+				if _, ok := h.paginated[i]; ok {
+					continue
+				}
+				responses[i], errs[i] = searchResponses[next], searchErrs[next]
+				next++
+			}
+		}()
+	}
+
+	paginated := make(map[string]int, len(h.paginated))
+	refIDs := make([]string, 0, len(h.paginated))
+	for i := range h.paginated {
+		paginated[h.queries[i].RefID] = i
+		refIDs = append(refIDs, h.queries[i].RefID)
+	}
+	results := executeConcurrently(ctx, h.limiter, refIDs, func(ctx context.Context, refID string) (backend.DataResponse, error) {
+		i := paginated[refID]
+		p := h.paginated[i]
+		fetch := h.fetchPages
+		if p.composite != "" {
+			fetch = h.fetchCompositePages
+		}
+		res, err := fetch(ctx, p)
+		responses[i] = res
+		return backend.DataResponse{}, err
+	})
+	wg.Wait()
+
+	for _, r := range results {
+		i := paginated[r.refID]
+		p := h.paginated[i]
+		h.queries[i].notices = p.notices
+		if err := r.err; err != nil {
+			if backend.IsDownstreamHTTPError(err) {
+				err = backend.DownstreamError(err)
+			}
+			errs[i] = err
+		}
+	}
+
+	result := backend.NewQueryDataResponse()
+	targets := make([]*Query, 0, len(h.queries))
+	searchResponses := make([]*client.SearchResponse, 0, len(h.queries))
+	for i, q := range h.queries {
+		if errs[i] != nil {
+			result.Responses[q.RefID] = backend.ErrorResponseWithErrorSource(errs[i])
+			continue
+		}
+		// the multisearch response can have fewer responses than searches
+		if responses[i] == nil {
+			result.Responses[q.RefID] = backend.ErrorResponseWithErrorSource(backend.DownstreamError(errors.New("the search has no response")))
+			continue
+		}
+		targets = append(targets, q)
+		searchResponses = append(searchResponses, responses[i])
+	}
+	if len(targets) == 0 {
+		return result, nil
+	}
+
+	rp := newResponseParser(searchResponses, targets, debugInfo, h.client.GetConfiguredFields(), h.dsSettings)
+	parsed, err := rp.parseResponse()
+	if err != nil {
+		return nil, err
+	}
+	for refID, res := range parsed.Responses {
+		// a failed search of a service map query fails the whole RefID
+		if _, failed := result.Responses[refID]; !failed {
+			result.Responses[refID] = res
+		}
+	}
+	return result, nil
+}
+
+// search sends the searches of the queries that aren't paginated, in one
+// multisearch or, when asynchronous search is enabled, one after another. It
+// returns a response or an error for every search of ms. The responses can be
+// missing when the multisearch response is incomplete.
+func (h *luceneHandler) search(ctx context.Context) ([]*client.SearchResponse, []error, *client.SearchDebugInfo) {
+	searches := len(h.queries) - len(h.paginated)
+	responses := make([]*client.SearchResponse, searches)
+	errs := make([]error, searches)
+	failAll := func(err error) ([]*client.SearchResponse, []error, *client.SearchDebugInfo) {
+		if backend.IsDownstreamHTTPError(err) {
+			err = backend.DownstreamError(err)
+		}
+		for i := range errs {
+			errs[i] = err
+		}
+		return responses, errs, nil
+	}
+
 	req, err := h.ms.Build()
 	if err != nil {
-		return &backend.QueryDataResponse{
-			Responses: backend.Responses{
-				errRefID: backend.ErrorResponseWithErrorSource(backend.PluginError(err)),
-			},
-		}, nil
+		return failAll(backend.PluginError(err))
+	}
+	if asyncSearchEnabled(h.dsSettings) {
+		for i, search := range req.Requests {
+			res, err := h.client.ExecuteAsyncSearch(ctx, search)
+			if errors.Is(err, client.ErrAsyncSearchNotSupported) {
+				backend.Logger.Debug("Asynchronous search is not supported, falling back to multisearch")
+				break
+			}
+			if err != nil && backend.IsDownstreamHTTPError(err) {
+				err = backend.DownstreamError(err)
+			}
+			responses[i], errs[i] = res, err
+			if i == len(req.Requests)-1 {
+				return responses, errs, nil
+			}
+		}
 	}
 
 	res, err := h.client.ExecuteMultisearch(ctx, req)
 	if err != nil {
-		if backend.IsDownstreamHTTPError(err) {
-			err = backend.DownstreamError(err)
+		return failAll(err)
+	}
+	copy(responses, res.Responses)
+	return responses, errs, res.DebugInfo
+}
+
+// asyncSearchEnabled reads whether searches should be sent with the asynchronous
+// search API, so long searches don't hold a request open. It is opt-in with
+// jsonData.asyncSearch.
+func asyncSearchEnabled(dsSettings *backend.DataSourceInstanceSettings) bool {
+	if dsSettings == nil {
+		return false
+	}
+	jsonData, err := simplejson.NewJson(dsSettings.JSONData)
+	if err != nil {
+		return false
+	}
+	return jsonData.Get("asyncSearch").MustBool(false)
+}
+
+// fetchPages pages through the documents of a paginated search with search_after,
+// within a point in time when the cluster supports it so the pages are consistent.
+// The hits of all pages are merged into the first page's response, which also
+// holds the aggregations. When a page after the first fails, the hits fetched so
+// far are returned with a notice that they are partial.
+func (h *luceneHandler) fetchPages(ctx context.Context, p *paginatedSearch) (*client.SearchResponse, error) {
+	req, err := p.ms.Build()
+	if err != nil {
+		return nil, backend.PluginError(err)
+	}
+	search := *req.Requests[0]
+	pageSize := min(search.Size, maxPageSize)
+	if pageSize <= 0 {
+		pageSize = defaultLogsSize
+	}
+
+	pitID, err := h.client.OpenPointInTime(ctx, &search, pointInTimeKeepAlive)
+	if err != nil && !errors.Is(err, client.ErrPointInTimeNotSupported) {
+		return nil, err
+	}
+	if pitID != "" {
+		defer func() {
+			if err := h.client.ClosePointInTime(context.WithoutCancel(ctx), pitID); err != nil {
+				backend.Logger.Warn("Failed to close point in time", "error", err)
+			}
+		}()
+	} else {
+		// without a point in time every page is searched on the current segments of
+		// the shards, where _doc isn't stable, so documents could be skipped or
+		// returned twice
+		search.Sort = uniqueTiebreaker(search.Sort)
+	}
+
+	var merged *client.SearchResponse
+	fetched := 0
+	for fetched < p.limit {
+		page := search
+		page.Size = min(pageSize, p.limit-fetched)
+		if pitID != "" {
+			page.PointInTime = &client.PointInTime{ID: pitID, KeepAlive: pointInTimeKeepAlive}
+		}
+
+		res, err := h.client.ExecuteMultisearch(ctx, &client.MultiSearchRequest{Requests: []*client.SearchRequest{&page}})
+		var pageRes *client.SearchResponse
+		if err == nil {
+			if len(res.Responses) == 0 {
+				err = backend.PluginError(errors.New("multisearch response is empty"))
+			} else {
+				pageRes = res.Responses[0]
+			}
+		}
+		if merged == nil {
+			if err != nil {
+				return nil, err
+			}
+			if pageRes.Error != nil || pageRes.Hits == nil {
+				// let the response parser report the error of the first page
+				return pageRes, nil
+			}
+		} else if err != nil || pageRes.Error != nil {
+			if err == nil {
+				err = getErrorFromOpenSearchResponse(pageRes)
+			}
+			backend.Logger.Warn("Failed to fetch a page of documents", "error", err)
+			p.notices = append(p.notices, warning(fmt.Sprintf("Only the first %d documents were fetched, the next page failed: %s", fetched, err)))
+			break
+		} else if pageRes.Hits == nil {
+			break
+		}
+
+		hits := pageRes.Hits.Hits
+		if merged == nil {
+			merged = pageRes
+			// aggregations only need to be computed once
+			search.Aggs = nil
+		} else {
+			merged.Hits.Hits = append(merged.Hits.Hits, hits...)
+			merged.Took += pageRes.Took
+		}
+		fetched += len(hits)
+
+		if len(hits) < page.Size {
+			break
+		}
+		sortValues, ok := hits[len(hits)-1]["sort"].([]interface{})
+		if !ok {
+			break
+		}
+		search.SearchAfter = sortValues
+		if pageRes.PitID != "" {
+			pitID = pageRes.PitID
 		}
-		return &backend.QueryDataResponse{
-			Responses: backend.Responses{
-				errRefID: backend.ErrorResponseWithErrorSource(err),
-			},
-		}, nil
 	}
+	return merged, nil
+}
 
-	rp := newResponseParser(res.Responses, h.queries, res.DebugInfo, h.client.GetConfiguredFields(), h.dsSettings)
-	return rp.parseResponse()
+// uniqueTiebreaker returns the sort of a search with its _doc tiebreaker replaced
+// by _id, which is unique and stable across the shards and segments of an index
+func uniqueTiebreaker(sort []map[string]map[string]string) []map[string]map[string]string {
+	unique := make([]map[string]map[string]string, 0, len(sort))
+	for _, s := range sort {
+		if props, ok := s["_doc"]; ok {
+			s = map[string]map[string]string{"_id": props}
+		}
+		unique = append(unique, s)
+	}
+	return unique
 }
 
 // getParametersFromServiceMapResult extracts the lists of services and operations from the
@@ -438,7 +847,7 @@ func getParametersFromServiceMapResult(smResult *client.SearchResponse) ([]strin
 	return services, operations
 }
 
-func addDateHistogramAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg, timeFrom, timeTo int64, timeField string) client.AggBuilder {
+func addDateHistogramAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg, timeFrom, timeTo int64, timeField, timeZone string) client.AggBuilder {
 	// If no field is specified, use the time field
 	field := bucketAgg.Field
 	if field == "" {
@@ -454,6 +863,8 @@ func addDateHistogramAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg, tim
 			a.Interval = "$__interval"
 		}
 
+		a.TimeZone = histogramTimeZone(bucketAgg.Settings.Get("timeZone").MustString(), timeZone)
+
 		if offset, err := bucketAgg.Settings.Get("offset").String(); err == nil {
 			a.Offset = offset
 		}
@@ -468,6 +879,25 @@ func addDateHistogramAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg, tim
 	return aggBuilder
 }
 
+// histogramTimeZone returns the time zone date histogram buckets are aligned to, or
+// an empty string to align them to UTC. The time zone of the bucket aggregation
+// overrides the one of the query, which the frontend sends with the browser time zone
+// resolved. The browser time zone of a bucket aggregation can only be resolved by the
+// frontend, so it is the time zone of the query too.
+func histogramTimeZone(timeZone, queryTimeZone string) string {
+	if timeZone == "" || strings.EqualFold(timeZone, "browser") {
+		timeZone = queryTimeZone
+	}
+	switch strings.ToLower(timeZone) {
+	case "", "browser":
+		return ""
+	case "utc":
+		return "UTC"
+	default:
+		return timeZone
+	}
+}
+
 func addHistogramAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg) client.AggBuilder {
 	aggBuilder.Histogram(bucketAgg.ID, bucketAgg.Field, func(a *client.HistogramAgg, b client.AggBuilder) {
 		a.Interval = stringToFloatWithDefaultValue(bucketAgg.Settings.Get("interval").MustString(), 1000)
@@ -483,7 +913,7 @@ func addHistogramAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg) client.
 	return aggBuilder
 }
 
-func addTermsAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg, metrics []*MetricAgg) client.AggBuilder {
+func addTermsAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg, metrics []*MetricAgg, defaultTimeField string) client.AggBuilder {
 	aggBuilder.Terms(bucketAgg.ID, bucketAgg.Field, func(a *client.TermsAggregation, b client.AggBuilder) {
 		if size, err := bucketAgg.Settings.Get("size").Int(); err == nil {
 			a.Size = size
@@ -506,33 +936,7 @@ func addTermsAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg, metrics []*
 			a.Missing = &missing
 		}
 
-		if orderBy, err := bucketAgg.Settings.Get("orderBy").String(); err == nil {
-			if a.Order == nil {
-				a.Order = make(map[string]interface{})
-			}
-			/*
-			   The format for extended stats and percentiles is {metricId}[bucket_path]
-			   for everything else it's just {metricId}, _count, _term, or _key
-			*/
-			metricIdRegex := regexp.MustCompile(`^(\d+)`)
-			metricId := metricIdRegex.FindString(orderBy)
-
-			if len(metricId) > 0 {
-				for _, m := range metrics {
-					if m.ID == metricId {
-						if m.Type == "count" {
-							a.Order["_count"] = bucketAgg.Settings.Get("order").MustString("desc")
-						} else {
-							a.Order[orderBy] = bucketAgg.Settings.Get("order").MustString("desc")
-							b.Metric(m.ID, m.Type, m.Field, nil)
-						}
-						break
-					}
-				}
-			} else {
-				a.Order[orderBy] = bucketAgg.Settings.Get("order").MustString("desc")
-			}
-		}
+		a.Order = termsOrder(b, bucketAgg, metrics, defaultTimeField)
 
 		if executionHint, err := bucketAgg.Settings.Get("execution_hint").String(); err == nil {
 			a.ExecutionHint = &executionHint
@@ -544,6 +948,41 @@ func addTermsAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg, metrics []*
 	return aggBuilder
 }
 
+// termsOrder returns the order of a terms or multi terms aggregation, adding the
+// metric it is ordered by to the aggregation's builder b
+func termsOrder(b client.AggBuilder, bucketAgg *BucketAgg, metrics []*MetricAgg, defaultTimeField string) map[string]interface{} {
+	var order map[string]interface{}
+	if orderBy, err := bucketAgg.Settings.Get("orderBy").String(); err == nil {
+		order = make(map[string]interface{})
+		/*
+		   The format for extended stats and percentiles is {metricId}[bucket_path]
+		   for everything else it's just {metricId}, _count, _term, or _key
+		*/
+		metricIdRegex := regexp.MustCompile(`^(\d+)`)
+		metricId := metricIdRegex.FindString(orderBy)
+
+		if len(metricId) > 0 {
+			for _, m := range metrics {
+				if m.ID == metricId {
+					if m.Type == "count" {
+						order["_count"] = bucketAgg.Settings.Get("order").MustString("desc")
+					} else if m.Type == topMetricsType {
+						// top hits aren't a value terms can be ordered by
+						order[addTopMetricsOrderAgg(b, m, defaultTimeField)] = bucketAgg.Settings.Get("order").MustString("desc")
+					} else {
+						order[orderBy] = bucketAgg.Settings.Get("order").MustString("desc")
+						b.Metric(m.ID, m.Type, m.Field, nil)
+					}
+					break
+				}
+			}
+		} else {
+			order[orderBy] = bucketAgg.Settings.Get("order").MustString("desc")
+		}
+	}
+	return order
+}
+
 func addFiltersAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg) client.AggBuilder {
 	filters := make(map[string]interface{})
 	for _, filter := range bucketAgg.Settings.Get("filters").MustArray() {
@@ -575,6 +1014,80 @@ func addGeoHashGridAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg) clien
 	return aggBuilder
 }
 
+// addRangeAgg buckets documents into the ranges of the "ranges" setting of a range,
+// date_range or ip_range bucket aggregation. Every range has an optional key, which
+// labels its bucket, and from and to bounds, or a CIDR mask for ip_range.
+func addRangeAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg, timeZone string) client.AggBuilder {
+	fn := func(a *client.RangeAggregation, b client.AggBuilder) {
+		for _, r := range bucketAgg.Settings.Get("ranges").MustArray() {
+			settings := utils.NewJsonFromAny(r)
+			a.Ranges = append(a.Ranges, &client.AggregateRange{
+				Key:  settings.Get("key").MustString(),
+				From: rangeBound(bucketAgg.Type, settings.Get("from").Interface()),
+				To:   rangeBound(bucketAgg.Type, settings.Get("to").Interface()),
+				Mask: settings.Get("mask").MustString(),
+			})
+		}
+		if bucketAgg.Type == dateRangeType {
+			a.Format = bucketAgg.Settings.Get("format").MustString()
+			a.TimeZone = histogramTimeZone(bucketAgg.Settings.Get("timeZone").MustString(), timeZone)
+		}
+		aggBuilder = b
+	}
+
+	switch bucketAgg.Type {
+	case dateRangeType:
+		aggBuilder.DateRange(bucketAgg.ID, bucketAgg.Field, fn)
+	case ipRangeType:
+		aggBuilder.IPRange(bucketAgg.ID, bucketAgg.Field, fn)
+	default:
+		aggBuilder.Range(bucketAgg.ID, bucketAgg.Field, fn)
+	}
+
+	return aggBuilder
+}
+
+// rangeBound returns a bound of a range as it is sent to OpenSearch. Bounds of range
+// aggregations are numbers, which the query editor may store as strings. An empty
+// bound leaves the range open.
+func rangeBound(aggType string, bound interface{}) interface{} {
+	s, ok := bound.(string)
+	if !ok {
+		return bound
+	}
+	if s == "" {
+		return nil
+	}
+	if aggType == rangeType {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
+
+// addNestedAgg aggregates the nested documents at the path in the field of the
+// bucket aggregation, or in its path setting
+func addNestedAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg) client.AggBuilder {
+	path := bucketAgg.Settings.Get("path").MustString(bucketAgg.Field)
+	aggBuilder.Nested(bucketAgg.ID, path, func(a *client.NestedAggregation, b client.AggBuilder) {
+		aggBuilder = b
+	})
+
+	return aggBuilder
+}
+
+// addReverseNestedAgg joins nested documents back to their parent documents at the
+// path in the field of the bucket aggregation, or to the root documents without one
+func addReverseNestedAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg) client.AggBuilder {
+	path := bucketAgg.Settings.Get("path").MustString(bucketAgg.Field)
+	aggBuilder.ReverseNested(bucketAgg.ID, path, func(a *client.ReverseNestedAggregation, b client.AggBuilder) {
+		aggBuilder = b
+	})
+
+	return aggBuilder
+}
+
 func stringToFloatWithDefaultValue(valueStr string, defaultValue float64) float64 {
 	value, err := strconv.ParseFloat(valueStr, 64)
 	if err != nil {
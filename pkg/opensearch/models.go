@@ -6,6 +6,7 @@ import (
 
 	"github.com/bitly/go-simplejson"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
 )
 
@@ -23,9 +24,28 @@ type Query struct {
 	TimeRange       backend.TimeRange
 	TracesSize      string `json:"tracesSize"`
 	Index           string `json:"index"`
+	// TimeZone is the dashboard time zone, which date histogram buckets are aligned to
+	// unless their bucket aggregation sets one. The frontend resolves the browser time
+	// zone before sending it; without one the buckets are aligned to UTC.
+	TimeZone string `json:"timezone"`
+	// MaxDataPoints is the number of data points the panel of the query can show,
+	// which auto date histograms target
+	MaxDataPoints int64
 
 	// serviceMapInfo is used on the backend to pass information for service map queries
 	serviceMapInfo serviceMapInfo
+	// annotation is set for annotation queries
+	annotation *annotationSettings
+	// logContext is set for log context queries
+	logContext *logContextSettings
+	// logsVolume is set for logs volume queries, which count documents per interval and log level
+	logsVolume bool
+	// fieldTypes are the kinds of the mapped fields of the index of document queries,
+	// which their columns are typed by
+	fieldTypes fieldMapping
+	// notices are warnings about how the query was executed, such as the pages of
+	// its documents that failed to be fetched
+	notices []data.Notice
 }
 
 // queryHandler is an interface for handling queries of the same type
@@ -69,20 +89,37 @@ const (
 )
 
 var metricAggType = map[string]string{
-	"count":          "Count",
-	"avg":            "Average",
-	"sum":            "Sum",
-	"max":            "Max",
-	"min":            "Min",
-	"extended_stats": "Extended Stats",
-	"percentiles":    "Percentiles",
-	"cardinality":    "Unique Count",
-	"moving_avg":     "Moving Average",
-	"moving_fn":      "Moving Function",
-	"cumulative_sum": "Cumulative Sum",
-	"derivative":     "Derivative",
-	"bucket_script":  "Bucket Script",
-	"raw_document":   "Raw Document",
+	"count":                     "Count",
+	"avg":                       "Average",
+	"sum":                       "Sum",
+	"max":                       "Max",
+	"min":                       "Min",
+	"extended_stats":            "Extended Stats",
+	"percentiles":               "Percentiles",
+	"cardinality":               "Unique Count",
+	"moving_avg":                "Moving Average",
+	"moving_fn":                 "Moving Function",
+	"cumulative_sum":            "Cumulative Sum",
+	"derivative":                "Derivative",
+	"bucket_script":             "Bucket Script",
+	"raw_document":              "Raw Document",
+	"top_metrics":               "Top Metrics",
+	"serial_diff":               "Serial Difference",
+	"bucket_selector":           "Bucket Selector",
+	"bucket_sort":               "Bucket Sort",
+	"avg_bucket":                "Average Bucket",
+	"max_bucket":                "Max Bucket",
+	"min_bucket":                "Min Bucket",
+	"sum_bucket":                "Sum Bucket",
+	"stats_bucket":              "Stats Bucket",
+	"percentiles_bucket":        "Percentiles Bucket",
+	"geo_centroid":              "Geo Centroid",
+	"geo_bounds":                "Geo Bounds",
+	"percentile_ranks":          "Percentile Ranks",
+	"stats":                     "Stats",
+	"value_count":               "Value Count",
+	"weighted_avg":              "Weighted Average",
+	"median_absolute_deviation": "Median Absolute Deviation",
 }
 
 var extendedStats = map[string]string{
@@ -97,15 +134,18 @@ var extendedStats = map[string]string{
 }
 
 var pipelineAggType = map[string]string{
-	"moving_avg":     "moving_avg",
-	"moving_fn":      "moving_fn",
-	"cumulative_sum": "cumulative_sum",
-	"derivative":     "derivative",
-	"bucket_script":  "bucket_script",
+	"moving_avg":      "moving_avg",
+	"moving_fn":       "moving_fn",
+	"cumulative_sum":  "cumulative_sum",
+	"derivative":      "derivative",
+	"bucket_script":   "bucket_script",
+	"serial_diff":     "serial_diff",
+	"bucket_selector": "bucket_selector",
 }
 
 var pipelineAggWithMultipleBucketPathsType = map[string]string{
-	"bucket_script": "bucket_script",
+	"bucket_script":   "bucket_script",
+	"bucket_selector": "bucket_selector",
 }
 
 func isPipelineAgg(metricType string) bool {
@@ -134,9 +174,10 @@ func describeMetric(metricType, field string) string {
 const (
 	Lucene = "lucene"
 	PPL    = "PPL"
+	SQL    = "SQL"
 )
 
-// PPL date time type formats
+// PPL and SQL date time type formats
 const (
 	pplTSFormat   = "2006-01-02 15:04:05.999999"
 	pplDateFormat = "2006-01-02"
@@ -0,0 +1,191 @@
+package opensearch
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+	"github.com/grafana/opensearch-datasource/pkg/utils"
+)
+
+// multiTermsFields returns the fields of a multi terms aggregation, configured in
+// its "fields" setting or as a comma separated field
+func multiTermsFields(bucketAgg *BucketAgg) []string {
+	fields := bucketAgg.Settings.Get("fields").MustStringArray()
+	if len(fields) > 0 {
+		return fields
+	}
+	for _, field := range strings.Split(bucketAgg.Field, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// validateMultiTermsAggs checks that every multi terms aggregation of the query has
+// at least two distinct fields, which its buckets are split into labels by
+func validateMultiTermsAggs(q *Query) error {
+	for _, bucketAgg := range q.BucketAggs {
+		if bucketAgg.Type != multiTermsType {
+			continue
+		}
+		fields := multiTermsFields(bucketAgg)
+		if len(fields) < 2 {
+			return backend.DownstreamErrorf("invalid query, multi terms aggregation %s needs at least two fields", bucketAgg.ID)
+		}
+		seen := make(map[string]bool, len(fields))
+		for _, field := range fields {
+			if seen[field] {
+				return backend.DownstreamErrorf("invalid query, multi terms aggregation %s has field %s more than once", bucketAgg.ID, field)
+			}
+			seen[field] = true
+		}
+	}
+	return nil
+}
+
+func addMultiTermsAgg(aggBuilder client.AggBuilder, bucketAgg *BucketAgg, metrics []*MetricAgg, defaultTimeField string) client.AggBuilder {
+	aggBuilder.MultiTerms(bucketAgg.ID, multiTermsFields(bucketAgg), func(a *client.MultiTermsAggregation, b client.AggBuilder) {
+		a.Size = configuredTermsSize(bucketAgg)
+		if minDocCount, err := bucketAgg.Settings.Get("min_doc_count").Int(); err == nil {
+			a.MinDocCount = &minDocCount
+		}
+		if missing, err := bucketAgg.Settings.Get("missing").String(); err == nil {
+			for _, source := range a.Terms {
+				source.Missing = &missing
+			}
+		}
+		a.Order = termsOrder(b, bucketAgg, metrics, defaultTimeField)
+		aggBuilder = b
+	})
+
+	return aggBuilder
+}
+
+// expandMultiTermsAggs turns the buckets of the multi terms aggregations of a query
+// into the nested buckets of a terms aggregation per field, so every field is a label
+// or a table column like it is for nested terms aggregations. The returned query has
+// those terms aggregations instead of the multi terms ones.
+func expandMultiTermsAggs(aggs map[string]interface{}, target *Query) (map[string]interface{}, *Query) {
+	hasMultiTerms := false
+	expanded := *target
+	expanded.BucketAggs = make([]*BucketAgg, 0, len(target.BucketAggs))
+	for _, bucketAgg := range target.BucketAggs {
+		if bucketAgg.Type != multiTermsType {
+			expanded.BucketAggs = append(expanded.BucketAggs, bucketAgg)
+			continue
+		}
+		hasMultiTerms = true
+		expanded.BucketAggs = append(expanded.BucketAggs, multiTermsAsTermsAggs(bucketAgg)...)
+	}
+	if !hasMultiTerms {
+		return aggs, target
+	}
+	return expandMultiTermsBuckets(aggs, target), &expanded
+}
+
+func multiTermsAsTermsAggs(bucketAgg *BucketAgg) []*BucketAgg {
+	fields := multiTermsFields(bucketAgg)
+	termsAggs := make([]*BucketAgg, len(fields))
+	for i, field := range fields {
+		termsAggs[i] = &BucketAgg{
+			ID:       bucketAgg.ID + ":" + strconv.Itoa(i),
+			Type:     termsType,
+			Field:    field,
+			Settings: utils.NewJsonFromAny(map[string]interface{}{}),
+		}
+	}
+	return termsAggs
+}
+
+// expandMultiTermsBuckets rewrites the multi terms aggregations in aggs, and in the
+// buckets of every bucket aggregation in aggs
+func expandMultiTermsBuckets(aggs map[string]interface{}, target *Query) map[string]interface{} {
+	expanded := make(map[string]interface{}, len(aggs))
+	for k, v := range aggs {
+		expanded[k] = v
+	}
+	for aggID, v := range aggs {
+		aggDef, _ := findAgg(target, aggID)
+		agg, ok := v.(map[string]interface{})
+		if aggDef == nil || !ok {
+			continue
+		}
+		if isSingleBucketAgg(aggDef.Type) {
+			expanded[aggID] = expandMultiTermsBuckets(agg, target)
+			continue
+		}
+
+		rewritten := make(map[string]interface{}, len(agg))
+		for k, v := range agg {
+			rewritten[k] = v
+		}
+		switch buckets := agg["buckets"].(type) {
+		case []interface{}:
+			expandedBuckets := make([]interface{}, 0, len(buckets))
+			for _, b := range buckets {
+				bucket, ok := b.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				bucket = expandMultiTermsBuckets(bucket, target)
+				if aggDef.Type == multiTermsType {
+					bucket = multiTermsAsCompositeBucket(bucket, aggDef)
+				}
+				expandedBuckets = append(expandedBuckets, bucket)
+			}
+			rewritten["buckets"] = expandedBuckets
+		case map[string]interface{}:
+			expandedBuckets := make(map[string]interface{}, len(buckets))
+			for k, b := range buckets {
+				if bucket, ok := b.(map[string]interface{}); ok {
+					expandedBuckets[k] = expandMultiTermsBuckets(bucket, target)
+				}
+			}
+			rewritten["buckets"] = expandedBuckets
+		}
+
+		if aggDef.Type != multiTermsType {
+			expanded[aggID] = rewritten
+			continue
+		}
+		// keyed by an object of the values of its fields, the buckets are nested
+		// the same way as those of a composite aggregation. Every bucket is nested on
+		// its own rather than grouped by the value of the first field, so the series
+		// and rows keep the order of the buckets, e.g. by their metric.
+		termsAggs := multiTermsAsTermsAggs(aggDef)
+		buckets, _ := rewritten["buckets"].([]interface{})
+		nested := make([]interface{}, 0, len(buckets))
+		for _, bucket := range buckets {
+			nested = append(nested, nestCompositeBuckets([]interface{}{bucket}, termsAggs, 0)...)
+		}
+		delete(expanded, aggID)
+		expanded[termsAggs[0].ID] = map[string]interface{}{
+			"buckets": nested,
+		}
+	}
+	return expanded
+}
+
+// multiTermsAsCompositeBucket keys a multi terms bucket by an object of the values of
+// the fields, in place of the array of values
+func multiTermsAsCompositeBucket(bucket map[string]interface{}, aggDef *BucketAgg) map[string]interface{} {
+	values, _ := bucket["key"].([]interface{})
+	key := make(map[string]interface{}, len(values))
+	for i, field := range multiTermsFields(aggDef) {
+		if i < len(values) {
+			key[field] = values[i]
+		}
+	}
+	compositeBucket := make(map[string]interface{}, len(bucket))
+	for k, v := range bucket {
+		// the key of all the fields doesn't apply to any single one of them
+		if k != "key_as_string" {
+			compositeBucket[k] = v
+		}
+	}
+	compositeBucket["key"] = key
+	return compositeBucket
+}
@@ -0,0 +1,91 @@
+package opensearch
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+	"github.com/grafana/opensearch-datasource/pkg/utils"
+)
+
+// searchResponseNotices returns warnings about a search response whose results are
+// partial: because shards failed, the search timed out or terminated early, or,
+// for queries of documents, because more documents matched than were returned
+func searchResponseNotices(res *client.SearchResponse, documents bool) []data.Notice {
+	notices := make([]data.Notice, 0)
+	if res.Shards != nil && res.Shards.Failed > 0 {
+		text := fmt.Sprintf("%d of %d shards failed, the results are partial", res.Shards.Failed, res.Shards.Total)
+		if reasons := shardFailureReasons(res.Shards.Failures); len(reasons) > 0 {
+			text += ": " + strings.Join(reasons, "; ")
+		}
+		notices = append(notices, warning(text))
+	}
+	if res.TimedOut {
+		notices = append(notices, warning("The search timed out, the results are partial"))
+	}
+	if res.TerminatedEarly {
+		notices = append(notices, warning("The search terminated early, the results may be partial"))
+	}
+	if documents && res.Hits != nil && res.Hits.Total != nil {
+		returned := len(res.Hits.Hits)
+		switch {
+		case res.Hits.Total.Relation == "gte":
+			notices = append(notices, warning(fmt.Sprintf("Showing %d of more than %d matching documents", returned, res.Hits.Total.Value)))
+		case res.Hits.Total.Value > returned:
+			notices = append(notices, warning(fmt.Sprintf("Showing %d of %d matching documents", returned, res.Hits.Total.Value)))
+		}
+	}
+	return notices
+}
+
+// shardFailureReasons returns the distinct reasons of the failures of shards, in
+// the order they first failed for
+func shardFailureReasons(failures []map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	reasons := make([]string, 0)
+	for _, failure := range failures {
+		json := utils.NewJsonFromAny(failure)
+		reason := json.GetPath("reason", "reason").MustString()
+		if reason == "" {
+			reason = json.GetPath("reason", "type").MustString()
+		}
+		if reason == "" || seen[reason] {
+			continue
+		}
+		seen[reason] = true
+		reasons = append(reasons, reason)
+	}
+	return reasons
+}
+
+// pplResponseNotices returns a warning about a PPL response which has fewer rows
+// than its result
+func pplResponseNotices(res *client.PPLResponse) []data.Notice {
+	if res.Total > res.Size && res.Size > 0 {
+		return []data.Notice{warning(fmt.Sprintf("Showing %d of %d rows", res.Size, res.Total))}
+	}
+	return nil
+}
+
+func warning(text string) data.Notice {
+	return data.Notice{Severity: data.NoticeSeverityWarning, Text: text}
+}
+
+// addNotices adds notices to every frame, or to a new empty frame when there are
+// none, so that partial results are never shown as if they were complete
+func addNotices(frames data.Frames, notices []data.Notice) data.Frames {
+	if len(notices) == 0 {
+		return frames
+	}
+	if len(frames) == 0 {
+		frames = data.Frames{data.NewFrame("")}
+	}
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		frame.Meta.Notices = append(frame.Meta.Notices, notices...)
+	}
+	return frames
+}
@@ -0,0 +1,118 @@
+package opensearch
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_searchResponseNotices(t *testing.T) {
+	t.Run("complete response has no notices", func(t *testing.T) {
+		res := &client.SearchResponse{
+			Shards: &client.SearchResponseShards{Total: 3, Successful: 3},
+			Hits:   &client.SearchResponseHits{Hits: []map[string]interface{}{{}}, Total: &client.SearchResponseHitsTotal{Value: 1, Relation: "eq"}},
+		}
+		assert.Empty(t, searchResponseNotices(res, true))
+	})
+
+	t.Run("failed shards with their distinct reasons", func(t *testing.T) {
+		res := &client.SearchResponse{
+			Shards: &client.SearchResponseShards{Total: 5, Successful: 2, Failed: 3, Failures: []map[string]interface{}{
+				{"shard": 0, "index": "logs-1", "reason": map[string]interface{}{"type": "query_shard_exception", "reason": "failed to create query"}},
+				{"shard": 1, "index": "logs-1", "reason": map[string]interface{}{"type": "query_shard_exception", "reason": "failed to create query"}},
+				{"shard": 0, "index": "logs-2", "reason": map[string]interface{}{"type": "node_not_connected_exception"}},
+			}},
+		}
+		assert.Equal(t, []data.Notice{{
+			Severity: data.NoticeSeverityWarning,
+			Text:     "3 of 5 shards failed, the results are partial: failed to create query; node_not_connected_exception",
+		}}, searchResponseNotices(res, false))
+	})
+
+	t.Run("timed out and terminated early", func(t *testing.T) {
+		res := &client.SearchResponse{TimedOut: true, TerminatedEarly: true}
+		assert.Equal(t, []data.Notice{
+			{Severity: data.NoticeSeverityWarning, Text: "The search timed out, the results are partial"},
+			{Severity: data.NoticeSeverityWarning, Text: "The search terminated early, the results may be partial"},
+		}, searchResponseNotices(res, false))
+	})
+
+	t.Run("truncated documents", func(t *testing.T) {
+		hits := []map[string]interface{}{{}, {}}
+		res := &client.SearchResponse{Hits: &client.SearchResponseHits{Hits: hits, Total: &client.SearchResponseHitsTotal{Value: 10000, Relation: "gte"}}}
+		assert.Equal(t, []data.Notice{{Severity: data.NoticeSeverityWarning, Text: "Showing 2 of more than 10000 matching documents"}}, searchResponseNotices(res, true))
+
+		res.Hits.Total = &client.SearchResponseHitsTotal{Value: 7, Relation: "eq"}
+		assert.Equal(t, []data.Notice{{Severity: data.NoticeSeverityWarning, Text: "Showing 2 of 7 matching documents"}}, searchResponseNotices(res, true))
+
+		// the hits of aggregations are never returned
+		assert.Empty(t, searchResponseNotices(res, false))
+	})
+}
+
+func Test_pplResponseNotices(t *testing.T) {
+	assert.Empty(t, pplResponseNotices(&client.PPLResponse{Total: 3, Size: 3}))
+	assert.Equal(t, []data.Notice{{Severity: data.NoticeSeverityWarning, Text: "Showing 200 of 1000 rows"}}, pplResponseNotices(&client.PPLResponse{Total: 1000, Size: 200}))
+}
+
+func Test_parseResponse_adds_notices_to_every_frame(t *testing.T) {
+	targets := []tsdbQuery{{
+		refId: "A",
+		body: `{
+			"timeField": "@timestamp",
+			"metrics": [{ "type": "count", "id": "1" }],
+			"bucketAggs": [
+				{ "type": "terms", "field": "host", "id": "2" },
+				{ "type": "date_histogram", "field": "@timestamp", "id": "3" }
+			]
+		}`,
+	}}
+	response := `{
+		"responses": [
+			{
+				"timed_out": true,
+				"_shards": { "total": 2, "successful": 1, "failed": 1, "failures": [{ "reason": { "type": "exception", "reason": "boom" } }] },
+				"hits": { "total": { "value": 4, "relation": "eq" }, "hits": [] },
+				"aggregations": {
+					"2": {
+						"buckets": [
+							{ "key": "a", "3": { "buckets": [{ "key": 1000, "doc_count": 1 }] } },
+							{ "key": "b", "3": { "buckets": [{ "key": 1000, "doc_count": 3 }] } }
+						]
+					}
+				}
+			}
+		]
+	}`
+
+	rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+	require.NoError(t, err)
+	result, err := rp.parseResponse()
+	require.NoError(t, err)
+
+	frames := result.Responses["A"].Frames
+	require.Len(t, frames, 2)
+	for _, frame := range frames {
+		assert.Equal(t, []data.Notice{
+			{Severity: data.NoticeSeverityWarning, Text: "1 of 2 shards failed, the results are partial: boom"},
+			{Severity: data.NoticeSeverityWarning, Text: "The search timed out, the results are partial"},
+		}, frame.Meta.Notices)
+	}
+}
+
+func Test_pplResponseParser_adds_notices(t *testing.T) {
+	rp := newPPLResponseParser(&client.PPLResponse{
+		Schema:   []client.FieldSchema{{Name: "host", Type: "string"}},
+		Datarows: []client.Datarow{{"a"}, {"b"}},
+		Total:    5,
+		Size:     2,
+	})
+	res, err := rp.parseResponse(client.ConfiguredFields{}, tableType)
+	require.NoError(t, err)
+
+	require.Len(t, res.Frames, 1)
+	assert.Equal(t, []data.Notice{{Severity: data.NoticeSeverityWarning, Text: "Showing 2 of 5 rows"}}, res.Frames[0].Meta.Notices)
+}
@@ -182,8 +182,7 @@ func (ds *OpenSearchDatasource) QueryData(ctx context.Context, req *backend.Quer
 		return nil, fmt.Errorf("query contains no queries")
 	}
 
-	timeRange := req.Queries[0].TimeRange
-	osClient, err := client.NewClient(ctx, req.PluginContext.DataSourceInstanceSettings, ds.HttpClient, &timeRange)
+	osClient, err := client.NewClient(ctx, req.PluginContext.DataSourceInstanceSettings, ds.HttpClient)
 	if err != nil {
 		return nil, err
 	}
@@ -6,83 +6,102 @@ import (
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+	"github.com/grafana/opensearch-datasource/pkg/tsdb"
 )
 
 type pplHandler struct {
-	client     client.Client
-	reqQueries []backend.DataQuery
-	builders   map[string]*client.PPLRequestBuilder
-	queries    map[string]*Query
+	client   client.Client
+	limiter  concurrencyLimiter
+	builders map[string]*client.PPLRequestBuilder
+	queries  map[string]*Query
 }
 
-func newPPLHandler(openSearchClient client.Client, queries []backend.DataQuery) *pplHandler {
+func newPPLHandler(openSearchClient client.Client, limiter concurrencyLimiter) *pplHandler {
 	return &pplHandler{
-		client:     openSearchClient,
-		reqQueries: queries,
-		builders:   make(map[string]*client.PPLRequestBuilder),
-		queries:    make(map[string]*Query),
+		client:   openSearchClient,
+		limiter:  limiter,
+		builders: make(map[string]*client.PPLRequestBuilder),
+		queries:  make(map[string]*Query),
 	}
 }
 
 func (h *pplHandler) processQuery(q *Query) error {
-	from := h.reqQueries[0].TimeRange.From.UTC().Format("2006-01-02 15:04:05")
-	to := h.reqQueries[0].TimeRange.To.UTC().Format("2006-01-02 15:04:05")
+	from := q.TimeRange.From.UTC().Format("2006-01-02 15:04:05")
+	to := q.TimeRange.To.UTC().Format("2006-01-02 15:04:05")
+
+	timeField := h.client.GetConfiguredFields().TimeField
+	if q.annotation != nil {
+		timeField = q.annotation.timeField(timeField)
+	}
+
+	query := q.RawQuery
+	if q.logsVolume {
+		minInterval, err := h.client.GetMinInterval(q.Interval)
+		if err != nil {
+			return err
+		}
+		// the levels split the spans, but there are too few to need a bucket budget
+		interval, err := tsdb.CalculateInterval(&q.TimeRange, minInterval, 1, tsdb.MaxBucketsFrom(nil))
+		if err != nil {
+			return backend.DownstreamError(err)
+		}
+		query = logsVolumePPLQuery(query, h.client.GetIndex(), timeField, h.client.GetConfiguredFields().LogLevelField, interval.Value)
+	}
 
 	builder := h.client.PPL()
-	builder.AddPPLQueryString(h.client.GetConfiguredFields().TimeField, to, from, q.RawQuery)
+	builder.AddPPLQueryString(timeField, to, from, query)
 	h.builders[q.RefID] = builder
 	h.queries[q.RefID] = q
 	return nil
 }
 
 func (h *pplHandler) executeQueries(ctx context.Context) (*backend.QueryDataResponse, error) {
-	result := backend.NewQueryDataResponse()
+	refIDs := make([]string, 0, len(h.builders))
+	for refID := range h.builders {
+		refIDs = append(refIDs, refID)
+	}
+	results := executeConcurrently(ctx, h.limiter, refIDs, h.executeQuery)
+	return collectResults(results), nil
+}
 
-	for refID, builder := range h.builders {
-		req, err := builder.Build()
-		if err != nil {
-			return &backend.QueryDataResponse{
-				Responses: backend.Responses{
-					refID: backend.ErrorResponseWithErrorSource(backend.PluginError(err)),
-				},
-			}, nil
-		}
-		res, err := h.client.ExecutePPLQuery(ctx, req)
-		if err != nil {
-			if backend.IsDownstreamHTTPError(err) {
-				err = backend.DownstreamError(err)
-			}
-			return &backend.QueryDataResponse{
-				Responses: backend.Responses{
-					refID: backend.ErrorResponseWithErrorSource(err),
-				},
-			}, nil
-		}
-		if res.Status >= 400 {
-			details := "(no details)"
-			if res.Error["reason"] != "" && res.Error["details"] != "" {
-				details = fmt.Sprintf("%v, %v", res.Error["reason"], res.Error["details"])
-			}
-			err = fmt.Errorf("ExecutePPLQuery received unexpected status code %d: %s", res.Status, details)
-			if backend.ErrorSourceFromHTTPStatus(res.Status) == backend.ErrorSourceDownstream {
-				err = backend.DownstreamError(err)
-			} else {
-				err = backend.PluginError(err)
-			}
-			return &backend.QueryDataResponse{
-				Responses: backend.Responses{
-					refID: backend.ErrorResponseWithErrorSource(err),
-				},
-			}, nil
+func (h *pplHandler) executeQuery(ctx context.Context, refID string) (backend.DataResponse, error) {
+	req, err := h.builders[refID].Build()
+	if err != nil {
+		return backend.DataResponse{}, backend.PluginError(err)
+	}
+	res, err := h.client.ExecutePPLQuery(ctx, req)
+	if err != nil {
+		if backend.IsDownstreamHTTPError(err) {
+			err = backend.DownstreamError(err)
 		}
+		return backend.DataResponse{}, err
+	}
+	if res.Status >= 400 {
+		return backend.DataResponse{}, jdbcStatusError("ExecutePPLQuery", res)
+	}
 
-		query := h.queries[refID]
-		rp := newPPLResponseParser(res)
-		queryRes, err := rp.parseResponse(h.client.GetConfiguredFields(), query.Format)
-		if err != nil {
-			return nil, err
-		}
-		result.Responses[refID] = *queryRes
+	query := h.queries[refID]
+	rp := newPPLResponseParser(res)
+	rp.annotation = query.annotation
+	rp.timeRange = query.TimeRange
+	queryRes, err := rp.parseResponse(h.client.GetConfiguredFields(), query.Format)
+	if err != nil {
+		return backend.DataResponse{}, err
+	}
+	addQueryMeta(queryRes.Frames, req.Query, pplResponseStats(res))
+	return *queryRes, nil
+}
+
+// jdbcStatusError returns the error for a PPL or SQL response with an error
+// status code, attributed to the downstream or the plugin based on the status
+func jdbcStatusError(method string, res *client.PPLResponse) error {
+	details := "(no details)"
+	if res.Error["reason"] != "" && res.Error["details"] != "" {
+		details = fmt.Sprintf("%v, %v", res.Error["reason"], res.Error["details"])
+	}
+	err := fmt.Errorf("%s received unexpected status code %d: %s", method, res.Status, details)
+	if backend.ErrorSourceFromHTTPStatus(res.Status) == backend.ErrorSourceDownstream {
+		return backend.DownstreamError(err)
 	}
-	return result, nil
+	return backend.PluginError(err)
 }
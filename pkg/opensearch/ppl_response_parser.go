@@ -15,6 +15,10 @@ import (
 
 type pplResponseParser struct {
 	Response *client.PPLResponse
+	// annotation is set when parsing the response of an annotation query
+	annotation *annotationSettings
+	// timeRange is the time range of the query, logs volume frames carry it
+	timeRange backend.TimeRange
 }
 
 func newPPLResponseParser(response *client.PPLResponse) *pplResponseParser {
@@ -51,14 +55,25 @@ func (rp *pplResponseParser) parseResponse(configuredFields client.ConfiguredFie
 		Frames: data.Frames{},
 	}
 
+	var err error
 	switch format {
+	case annotationsType:
+		queryRes, err = rp.parseAnnotations(queryRes, configuredFields)
 	case logsType:
-		return rp.parseLogs(queryRes, configuredFields)
+		queryRes, err = rp.parseLogs(queryRes, configuredFields)
+	case logsVolumeType:
+		queryRes, err = rp.parseLogsVolume(queryRes, configuredFields)
 	case tableType:
-		return rp.parseTables(queryRes)
+		queryRes, err = rp.parseTables(queryRes)
 	default:
-		return rp.parseTimeSeries(queryRes)
+		queryRes, err = rp.parseTimeSeries(queryRes)
+	}
+	if err != nil || queryRes == nil || queryRes.Error != nil {
+		return queryRes, err
 	}
+
+	queryRes.Frames = addNotices(queryRes.Frames, pplResponseNotices(rp.Response))
+	return queryRes, nil
 }
 
 func (rp *pplResponseParser) parseTables(queryRes *backend.DataResponse) (*backend.DataResponse, error) {
@@ -75,27 +90,10 @@ func (rp *pplResponseParser) parsePPLResponse(queryRes *backend.DataResponse, co
 	docs := make([]map[string]interface{}, len(rp.Response.Datarows))
 
 	for rowIdx, row := range rp.Response.Datarows {
-		doc := map[string]interface{}{}
-
-		// convert every timestamp, datetime or date to the correct format
-		for fieldIdx, field := range rp.Response.Schema {
-			value := row[fieldIdx]
-			fieldType := field.Type
-
-			if fieldType == "timestamp" || fieldType == "datetime" || fieldType == "date" {
-				timestampFormat := pplTSFormat
-				if fieldType == "date" {
-					timestampFormat = pplDateFormat
-				}
-				ts, err := rp.parseTimestamp(row[fieldIdx], timestampFormat)
-				if err != nil {
-					errResp := backend.ErrorResponseWithErrorSource(backend.PluginError(err))
-					return &errResp, nil
-				}
-				value = *utils.NullFloatToNullableTime(ts)
-			}
-
-			doc[field.Name] = value
+		doc, err := rp.datarowToDoc(row)
+		if err != nil {
+			errResp := backend.ErrorResponseWithErrorSource(backend.PluginError(err))
+			return &errResp, nil
 		}
 
 		if isLogsQuery && configuredFields.LogLevelField != "" {
@@ -118,7 +116,7 @@ func (rp *pplResponseParser) parsePPLResponse(queryRes *backend.DataResponse, co
 	}
 
 	sortedPropNames := sortPropNames(propNames, []string{configuredFields.TimeField, configuredFields.LogMessageField})
-	fields := processDocsToDataFrameFields(docs, sortedPropNames, true)
+	fields := processDocsToDataFrameFields(docs, sortedPropNames, nil, true)
 
 	frame := data.NewFrame("", fields...)
 	if frame.Meta == nil {
@@ -135,6 +133,91 @@ func (rp *pplResponseParser) parsePPLResponse(queryRes *backend.DataResponse, co
 	return queryRes, nil
 }
 
+// parseAnnotations turns every datarow into an annotation event
+func (rp *pplResponseParser) parseAnnotations(queryRes *backend.DataResponse, configuredFields client.ConfiguredFields) (*backend.DataResponse, error) {
+	if rp.annotation == nil {
+		errResp := backend.ErrorResponseWithErrorSource(backend.PluginError(errors.New("missing annotation settings")))
+		return &errResp, nil
+	}
+
+	docs := make([]map[string]interface{}, len(rp.Response.Datarows))
+	for rowIdx, row := range rp.Response.Datarows {
+		doc, err := rp.datarowToDoc(row)
+		if err != nil {
+			errResp := backend.ErrorResponseWithErrorSource(backend.PluginError(err))
+			return &errResp, nil
+		}
+		docs[rowIdx] = doc
+	}
+
+	queryRes.Frames = append(queryRes.Frames, newAnnotationsFrame(docs, rp.annotation, configuredFields.TimeField))
+	return queryRes, nil
+}
+
+// parseLogsVolume turns the counts per span, and level if one is configured, of a
+// logs volume query into logs volume frames. The count is the first column of the
+// stats command, followed by the span.
+func (rp *pplResponseParser) parseLogsVolume(queryRes *backend.DataResponse, configuredFields client.ConfiguredFields) (*backend.DataResponse, error) {
+	schema := rp.Response.Schema
+	if len(schema) < 2 {
+		errResp := backend.ErrorResponseWithErrorSource(backend.PluginError(fmt.Errorf("logs volume response should have at least 2 fields but found %v", len(schema))))
+		return &errResp, nil
+	}
+	countName, spanName := schema[0].Name, schema[1].Name
+
+	volume := newLogsVolume()
+	for _, row := range rp.Response.Datarows {
+		doc, err := rp.datarowToDoc(row)
+		if err != nil {
+			errResp := backend.ErrorResponseWithErrorSource(backend.PluginError(err))
+			return &errResp, nil
+		}
+		t, ok := doc[spanName].(time.Time)
+		if !ok {
+			errResp := backend.ErrorResponseWithErrorSource(backend.PluginError(fmt.Errorf("logs volume span %q is not a time", spanName)))
+			return &errResp, nil
+		}
+		count, err := rp.parseValue(doc[countName])
+		if err != nil {
+			errResp := backend.ErrorResponseWithErrorSource(backend.PluginError(err))
+			return &errResp, nil
+		}
+		level := unknownLogLevel
+		if configuredFields.LogLevelField != "" {
+			level = normalizeLogLevel(doc[configuredFields.LogLevelField])
+		}
+		volume.add(t.UTC(), level, count.Float64)
+	}
+
+	queryRes.Frames = append(queryRes.Frames, volume.frames(rp.timeRange)...)
+	return queryRes, nil
+}
+
+// datarowToDoc maps a datarow to its schema field names, converting every
+// timestamp, datetime or date to the correct format
+func (rp *pplResponseParser) datarowToDoc(row client.Datarow) (map[string]interface{}, error) {
+	doc := map[string]interface{}{}
+	for fieldIdx, field := range rp.Response.Schema {
+		value := row[fieldIdx]
+		fieldType := field.Type
+
+		if fieldType == "timestamp" || fieldType == "datetime" || fieldType == "date" {
+			timestampFormat := pplTSFormat
+			if fieldType == "date" {
+				timestampFormat = pplDateFormat
+			}
+			ts, err := rp.parseTimestamp(row[fieldIdx], timestampFormat)
+			if err != nil {
+				return nil, err
+			}
+			value = *utils.NullFloatToNullableTime(ts)
+		}
+
+		doc[field.Name] = value
+	}
+	return doc, nil
+}
+
 func (rp *pplResponseParser) parseTimeSeries(queryRes *backend.DataResponse) (*backend.DataResponse, error) {
 	t, err := getTimeSeriesResponseMeta(rp.Response.Schema)
 	if err != nil {
@@ -816,3 +816,35 @@ func newPPLResponseParserForTest(tsdbQueries map[string]string, responseBody str
 func formatUnixMs(ms int64, format string) string {
 	return time.Unix(0, ms*int64(time.Millisecond)).UTC().Format(format)
 }
+
+func TestParseResponseWithAnnotationsFormatQuery(t *testing.T) {
+	targets := map[string]string{
+		"A": `{
+				"format": "annotations"
+			}`,
+	}
+	response := `{
+		"schema": [
+			{ "name": "@timestamp", "type": "timestamp" },
+			{ "name": "message", "type": "string" },
+			{ "name": "tags", "type": "string" }
+		],
+		"datarows": [
+			["2023-09-01 00:00:00", "restarted", "ops,db"]
+		],
+		"total": 1,
+		"size": 1
+	}`
+	rp, err := newPPLResponseParserForTest(targets, response)
+	assert.NoError(t, err)
+	rp.annotation = &annotationSettings{TextField: "message", TagsField: "tags"}
+	queryRes, err := rp.parseResponse(client.ConfiguredFields{TimeField: "@timestamp"}, annotationsType)
+	assert.NoError(t, err)
+	assert.Len(t, queryRes.Frames, 1)
+	frame := queryRes.Frames[0]
+	assert.Equal(t, data.DataTopicAnnotations, frame.Meta.DataTopic)
+	assert.Equal(t, 1, frame.Rows())
+	assert.Equal(t, time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC), frame.Fields[0].At(0))
+	assert.Equal(t, "restarted", frame.Fields[1].At(0))
+	assert.Equal(t, "ops,db", frame.Fields[2].At(0))
+}
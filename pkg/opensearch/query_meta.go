@@ -0,0 +1,45 @@
+package opensearch
+
+import (
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+)
+
+// searchResponseStats returns the time a search took, how many documents matched
+// it, and the shards it was executed on
+func searchResponseStats(res *client.SearchResponse) []data.QueryStat {
+	stats := []data.QueryStat{queryStat("Took", "ms", res.Took)}
+	if res.Hits != nil && res.Hits.Total != nil {
+		stats = append(stats, queryStat("Hits total", "", res.Hits.Total.Value))
+	}
+	if res.Shards != nil {
+		stats = append(stats,
+			queryStat("Shards total", "", res.Shards.Total),
+			queryStat("Shards successful", "", res.Shards.Successful),
+			queryStat("Shards skipped", "", res.Shards.Skipped),
+			queryStat("Shards failed", "", res.Shards.Failed),
+		)
+	}
+	return stats
+}
+
+// pplResponseStats returns the number of rows of the result of a PPL or SQL query
+func pplResponseStats(res *client.PPLResponse) []data.QueryStat {
+	return []data.QueryStat{queryStat("Rows total", "", res.Total)}
+}
+
+func queryStat(displayName, unit string, value int) data.QueryStat {
+	return data.QueryStat{FieldConfig: data.FieldConfig{DisplayName: displayName, Unit: unit}, Value: float64(value)}
+}
+
+// addQueryMeta sets the executed query and adds the stats of its response to the
+// metadata of every frame
+func addQueryMeta(frames data.Frames, executedQueryString string, stats []data.QueryStat) {
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		frame.Meta.ExecutedQueryString = executedQueryString
+		frame.Meta.Stats = append(frame.Meta.Stats, stats...)
+	}
+}
@@ -0,0 +1,148 @@
+package opensearch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_searchResponseStats(t *testing.T) {
+	t.Run("took, hits total and shards", func(t *testing.T) {
+		res := &client.SearchResponse{
+			Took:   42,
+			Hits:   &client.SearchResponseHits{Total: &client.SearchResponseHitsTotal{Value: 1000, Relation: "eq"}},
+			Shards: &client.SearchResponseShards{Total: 5, Successful: 3, Skipped: 1, Failed: 1},
+		}
+		assert.Equal(t, []data.QueryStat{
+			{FieldConfig: data.FieldConfig{DisplayName: "Took", Unit: "ms"}, Value: 42},
+			{FieldConfig: data.FieldConfig{DisplayName: "Hits total"}, Value: 1000},
+			{FieldConfig: data.FieldConfig{DisplayName: "Shards total"}, Value: 5},
+			{FieldConfig: data.FieldConfig{DisplayName: "Shards successful"}, Value: 3},
+			{FieldConfig: data.FieldConfig{DisplayName: "Shards skipped"}, Value: 1},
+			{FieldConfig: data.FieldConfig{DisplayName: "Shards failed"}, Value: 1},
+		}, searchResponseStats(res))
+	})
+
+	t.Run("only took without hits and shards", func(t *testing.T) {
+		assert.Equal(t, []data.QueryStat{
+			{FieldConfig: data.FieldConfig{DisplayName: "Took", Unit: "ms"}, Value: 7},
+		}, searchResponseStats(&client.SearchResponse{Took: 7}))
+	})
+}
+
+func Test_executed_query_string_and_stats(t *testing.T) {
+	from := time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC)
+	to := time.Date(2018, 5, 15, 17, 55, 0, 0, time.UTC)
+
+	t.Run("Lucene frames carry the search request and the stats of its response", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		c.multiSearchResponse = &client.MultiSearchResponse{Responses: []*client.SearchResponse{{
+			Took:   12,
+			Shards: &client.SearchResponseShards{Total: 2, Successful: 2},
+			Hits:   &client.SearchResponseHits{Total: &client.SearchResponseHitsTotal{Value: 3, Relation: "eq"}},
+			Aggregations: map[string]interface{}{
+				"2": map[string]interface{}{"buckets": []interface{}{
+					map[string]interface{}{"key": "a", "3": map[string]interface{}{"buckets": []interface{}{map[string]interface{}{"key": float64(1000), "doc_count": float64(1)}}}},
+					map[string]interface{}{"key": "b", "3": map[string]interface{}{"buckets": []interface{}{map[string]interface{}{"key": float64(1000), "doc_count": float64(2)}}}},
+				}},
+			},
+		}}}
+
+		res, err := executeTsdbQuery(c, `{
+			"timeField": "@timestamp",
+			"metrics": [{ "type": "count", "id": "1" }],
+			"bucketAggs": [
+				{ "type": "terms", "field": "host", "id": "2" },
+				{ "type": "date_histogram", "field": "@timestamp", "id": "3" }
+			]
+		}`, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		sent := encodeSearchRequest(c.multisearchRequests[0].Requests[0])
+
+		frames := res.Responses["A"].Frames
+		require.Len(t, frames, 2)
+		for _, frame := range frames {
+			assert.Equal(t, sent, frame.Meta.ExecutedQueryString)
+			assert.Equal(t, []data.QueryStat{
+				{FieldConfig: data.FieldConfig{DisplayName: "Took", Unit: "ms"}, Value: 12},
+				{FieldConfig: data.FieldConfig{DisplayName: "Hits total"}, Value: 3},
+				{FieldConfig: data.FieldConfig{DisplayName: "Shards total"}, Value: 2},
+				{FieldConfig: data.FieldConfig{DisplayName: "Shards successful"}, Value: 2},
+				{FieldConfig: data.FieldConfig{DisplayName: "Shards skipped"}, Value: 0},
+				{FieldConfig: data.FieldConfig{DisplayName: "Shards failed"}, Value: 0},
+			}, frame.Meta.Stats)
+		}
+	})
+
+	t.Run("Lucene error responses carry the search request", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		c.multiSearchResponse = &client.MultiSearchResponse{Responses: []*client.SearchResponse{{
+			Error: map[string]interface{}{"reason": "bad query"},
+		}}}
+
+		res, err := executeTsdbQuery(c, `{
+			"timeField": "@timestamp",
+			"metrics": [{ "type": "count", "id": "1" }],
+			"bucketAggs": [{ "type": "date_histogram", "field": "@timestamp", "id": "2" }]
+		}`, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		queryRes := res.Responses["A"]
+		require.Error(t, queryRes.Error)
+		require.Len(t, queryRes.Frames, 1)
+		assert.Contains(t, queryRes.Frames[0].Meta.ExecutedQueryString, `"date_histogram"`)
+	})
+
+	t.Run("PPL frames carry the PPL query and the rows of its result", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.pplResponse = &client.PPLResponse{
+			Schema:   []client.FieldSchema{{Name: "host", Type: "string"}},
+			Datarows: []client.Datarow{{"a"}, {"b"}},
+			Total:    2,
+			Size:     2,
+		}
+		queries := []backend.DataQuery{{
+			RefID:     "A",
+			JSON:      []byte(`{ "query": "source = logs", "queryType": "PPL", "format": "table" }`),
+			TimeRange: backend.TimeRange{From: from, To: to},
+		}}
+		res, err := newQueryRequest(c, queries, &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, c.pplRequest, 1)
+		frames := res.Responses["A"].Frames
+		require.Len(t, frames, 1)
+		assert.Equal(t, c.pplRequest[0].Query, frames[0].Meta.ExecutedQueryString)
+		assert.Equal(t, []data.QueryStat{{FieldConfig: data.FieldConfig{DisplayName: "Rows total"}, Value: 2}}, frames[0].Meta.Stats)
+	})
+
+	t.Run("SQL frames carry the SQL query and the rows of its result", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.sqlResponse = &client.SQLResponse{
+			Schema:   []client.FieldSchema{{Name: "host", Type: "string"}},
+			Datarows: []client.Datarow{{"a"}, {"b"}, {"c"}},
+			Total:    3,
+			Size:     3,
+		}
+		queries := []backend.DataQuery{{
+			RefID:     "A",
+			JSON:      []byte(`{ "query": "SELECT host FROM logs", "queryType": "SQL", "format": "table" }`),
+			TimeRange: backend.TimeRange{From: from, To: to},
+		}}
+		res, err := newQueryRequest(c, queries, &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, c.sqlRequest, 1)
+		frames := res.Responses["A"].Frames
+		require.Len(t, frames, 1)
+		assert.Equal(t, c.sqlRequest[0].Query, frames[0].Meta.ExecutedQueryString)
+		assert.Equal(t, []data.QueryStat{{FieldConfig: data.FieldConfig{DisplayName: "Rows total"}, Value: 3}}, frames[0].Meta.Stats)
+	})
+}
@@ -3,6 +3,7 @@ package opensearch
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/bitly/go-simplejson"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
@@ -24,148 +25,216 @@ func newQueryRequest(client client.Client, queries []backend.DataQuery, dsSettin
 	}
 }
 
+// handlerTypes lists the query types, and log context which has its own handler,
+// in the order their responses are merged
+var handlerTypes = []string{Lucene, PPL, SQL, logContext}
+
 func (e *queryRequest) execute(ctx context.Context) (*backend.QueryDataResponse, error) {
 	handlers := make(map[string]queryHandler)
 
-	handlers[Lucene] = newLuceneHandler(e.client, e.queries, e.dsSettings)
-	handlers[PPL] = newPPLHandler(e.client, e.queries)
+	// the handlers run concurrently, but share a limit on the requests they send
+	limiter := newConcurrencyLimiter(maxConcurrentQueriesFrom(e.dsSettings))
+	handlers[Lucene] = newLuceneHandler(e.client, e.dsSettings, limiter)
+	handlers[PPL] = newPPLHandler(e.client, limiter)
+	handlers[SQL] = newSQLHandler(e.client, limiter)
+	handlers[logContext] = newLogContextHandler(e.client, e.dsSettings, limiter)
 
-	queries, err := parse(e.queries)
-	if err != nil {
-		return &backend.QueryDataResponse{
-			Responses: backend.Responses{
-				e.queries[0].RefID: backend.ErrorResponseWithErrorSource(backend.DownstreamError(err)),
-			},
-		}, nil
+	// queries that fail to parse or process get an error response, the others
+	// are still executed
+	invalid := backend.NewQueryDataResponse()
+	// refIDs holds the RefIDs of the queries of every handler
+	refIDs := make(map[string][]string)
+	for _, dataQuery := range e.queries {
+		queries, err := parseQuery(dataQuery)
+		if err != nil {
+			invalid.Responses[dataQuery.RefID] = backend.ErrorResponseWithErrorSource(backend.DownstreamError(err))
+			continue
+		}
+		for _, q := range queries {
+			handlerType := q.QueryType
+			if q.logContext != nil {
+				handlerType = logContext
+			}
+			if err := handlers[handlerType].processQuery(q); err != nil {
+				invalid.Responses[q.RefID] = backend.ErrorResponseWithErrorSource(backend.DownstreamError(err))
+				break
+			}
+			refIDs[handlerType] = append(refIDs[handlerType], q.RefID)
+		}
 	}
 
-	for _, q := range queries {
-		if err := handlers[q.QueryType].processQuery(q); err != nil {
-			return &backend.QueryDataResponse{
-				Responses: backend.Responses{
-					q.RefID: backend.ErrorResponseWithErrorSource(backend.DownstreamError(err)),
-				},
-			}, nil
-		}
+	handlerResponses := make([]*backend.QueryDataResponse, len(handlerTypes))
+	handlerErrors := make([]error, len(handlerTypes))
+	var wg sync.WaitGroup
+	for i, handlerType := range handlerTypes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handlerResponses[i], handlerErrors[i] = handlers[handlerType].executeQueries(ctx)
+		}()
 	}
+	wg.Wait()
 
 	responses := make([]*backend.QueryDataResponse, 0)
-
-	for _, handler := range handlers {
-		response, err := handler.executeQueries(ctx)
-		if err != nil {
-			return nil, err
-		}
-		if response != nil {
+	for i, response := range handlerResponses {
+		if response := handlerResponse(response, handlerErrors[i], refIDs[handlerTypes[i]]); response != nil {
 			responses = append(responses, response)
 		}
 	}
+	// merged last, so the error wins when a service map query fails to process
+	// after another query with the same RefID was added to a handler
+	responses = append(responses, invalid)
 
 	return mergeResponses(responses...), nil
 }
 
+// handlerResponse returns the response of a handler or, when the handler failed, an
+// error response for each of its queries, so the queries of other handlers keep
+// their data
+func handlerResponse(response *backend.QueryDataResponse, err error, refIDs []string) *backend.QueryDataResponse {
+	if err == nil {
+		return response
+	}
+	result := backend.NewQueryDataResponse()
+	for _, refID := range refIDs {
+		result.Responses[refID] = backend.ErrorResponseWithErrorSource(err)
+	}
+	return result
+}
+
 type invalidQueryTypeError struct {
 	refId     string
 	queryType string
 }
 
 func (e invalidQueryTypeError) Error() string {
-	return fmt.Sprintf("invalid queryType: %q, expected Lucene or PPL", e.queryType)
+	return fmt.Sprintf("invalid queryType: %q, expected Lucene, PPL or SQL", e.queryType)
 }
 
 func parse(reqQueries []backend.DataQuery) ([]*Query, error) {
 	queries := make([]*Query, 0)
 	for _, q := range reqQueries {
-		model, _ := simplejson.NewJson(q.JSON)
-		// we had a string-field named `timeField` in the past. we do not use it anymore.
-		// please do not create a new field with that name, to avoid potential problems with old, persisted queries.
-		rawQuery := model.Get("query").MustString()
-		queryType := model.Get("queryType").MustString("lucene")
-		if queryType != Lucene && queryType != PPL {
-			return nil, invalidQueryTypeError{refId: q.RefID, queryType: queryType}
-		}
-		luceneQueryType := model.Get("luceneQueryType").MustString()
-		bucketAggs, err := parseBucketAggs(model)
+		parsed, err := parseQuery(q)
 		if err != nil {
 			return nil, err
 		}
-		metrics, err := parseMetrics(model)
-		if err != nil {
-			return nil, err
+		queries = append(queries, parsed...)
+	}
+	return queries, nil
+}
+
+// parseQuery parses a single data query. Service map queries result in several
+// queries sharing the data query's RefID.
+func parseQuery(q backend.DataQuery) ([]*Query, error) {
+	queries := make([]*Query, 0)
+	model, _ := simplejson.NewJson(q.JSON)
+	// we had a string-field named `timeField` in the past. we do not use it anymore.
+	// please do not create a new field with that name, to avoid potential problems with old, persisted queries.
+	rawQuery := model.Get("query").MustString()
+	queryType := model.Get("queryType").MustString("lucene")
+	if queryType != Lucene && queryType != PPL && queryType != SQL {
+		return nil, invalidQueryTypeError{refId: q.RefID, queryType: queryType}
+	}
+	luceneQueryType := model.Get("luceneQueryType").MustString()
+	bucketAggs, err := parseBucketAggs(model)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := parseMetrics(model)
+	if err != nil {
+		return nil, err
+	}
+	alias := model.Get("alias").MustString("")
+	format := model.Get("format").MustString("")
+
+	TracesSize := model.Get("tracesSize").MustString()
+	index := model.Get("index").MustString("")
+	timeZone := model.Get("timezone").MustString("")
+
+	var logContextSettings *logContextSettings
+	if _, ok := model.CheckGet("logContext"); ok {
+		logContextSettings = parseLogContextSettings(model)
+	}
+
+	var annotation *annotationSettings
+	if (queryType == Lucene && luceneQueryType == luceneQueryTypeAnnotations) || ((queryType == PPL || queryType == SQL) && format == annotationsType) {
+		annotation = parseAnnotationSettings(model)
+	}
+
+	// For queries requesting the service map, we inject extra queries to handle retrieving
+	// the required information
+	hasServiceMap := model.Get("serviceMap").MustBool(false)
+	if luceneQueryType == luceneQueryTypeTraces && hasServiceMap {
+		// The Prefetch request is used by itself for internal use, to get the parameters
+		// necessary for the Stats request. In this case there's no original query to
+		// pass along, so we return early.
+		if model.Get("serviceMapPrefetch").MustBool() {
+			queries = append(queries, &Query{
+				RawQuery:        rawQuery,
+				QueryType:       queryType,
+				luceneQueryType: luceneQueryType,
+				RefID:           q.RefID,
+				Index:           index,
+				serviceMapInfo: serviceMapInfo{
+					Type: Prefetch,
+				},
+				TimeRange: q.TimeRange,
+			})
+			//don't append the original query in this case
+			return queries, nil
 		}
-		alias := model.Get("alias").MustString("")
-		format := model.Get("format").MustString("")
-
-		TracesSize := model.Get("tracesSize").MustString()
-		index := model.Get("index").MustString("")
-
-		// For queries requesting the service map, we inject extra queries to handle retrieving
-		// the required information
-		hasServiceMap := model.Get("serviceMap").MustBool(false)
-		if luceneQueryType == luceneQueryTypeTraces && hasServiceMap {
-			// The Prefetch request is used by itself for internal use, to get the parameters
-			// necessary for the Stats request. In this case there's no original query to
-			// pass along, so we continue below.
-			if model.Get("serviceMapPrefetch").MustBool() {
-				queries = append(queries, &Query{
-					RawQuery:        rawQuery,
-					QueryType:       queryType,
-					luceneQueryType: luceneQueryType,
-					RefID:           q.RefID,
-					Index:           index,
-					serviceMapInfo: serviceMapInfo{
-						Type: Prefetch,
+		// For service map requests that are not prefetch, we add extra queries - one
+		// for the service map and one for the associated stats. We also add the
+		// original query below.
+		queries = append(queries,
+			&Query{
+				RawQuery:        rawQuery,
+				QueryType:       queryType,
+				luceneQueryType: luceneQueryType,
+				RefID:           q.RefID,
+				Index:           index,
+				serviceMapInfo: serviceMapInfo{
+					Type: Stats,
+					Parameters: client.StatsParameters{
+						ServiceNames: model.Get("services").MustStringArray(),
+						Operations:   model.Get("operations").MustStringArray(),
 					},
-				})
-				//don't append the original query in this case
-				continue
-			}
-			// For service map requests that are not prefetch, we add extra queries - one
-			// for the service map and one for the associated stats. We also add the
-			// original query below.
-			queries = append(queries,
-				&Query{
-					RawQuery:        rawQuery,
-					QueryType:       queryType,
-					luceneQueryType: luceneQueryType,
-					RefID:           q.RefID,
-					Index:           index,
-					serviceMapInfo: serviceMapInfo{
-						Type: Stats,
-						Parameters: client.StatsParameters{
-							ServiceNames: model.Get("services").MustStringArray(),
-							Operations:   model.Get("operations").MustStringArray(),
-						},
-					},
-					TimeRange: q.TimeRange,
-				},
-				&Query{
-					RawQuery:        rawQuery,
-					QueryType:       queryType,
-					luceneQueryType: luceneQueryType,
-					RefID:           q.RefID,
-					Index:           index,
-					serviceMapInfo:  serviceMapInfo{Type: ServiceMap},
 				},
-			)
-			TracesSize = ""
-		}
-
-		queries = append(queries, &Query{
-			RawQuery:        rawQuery,
-			QueryType:       queryType,
-			luceneQueryType: luceneQueryType,
-			BucketAggs:      bucketAggs,
-			Metrics:         metrics,
-			Alias:           alias,
-			Interval:        q.Interval,
-			RefID:           q.RefID,
-			Format:          format,
-			TracesSize:      TracesSize,
-			Index:           index,
-		})
+				TimeRange: q.TimeRange,
+			},
+			&Query{
+				RawQuery:        rawQuery,
+				QueryType:       queryType,
+				luceneQueryType: luceneQueryType,
+				RefID:           q.RefID,
+				Index:           index,
+				serviceMapInfo:  serviceMapInfo{Type: ServiceMap},
+				TimeRange:       q.TimeRange,
+			},
+		)
+		TracesSize = ""
 	}
 
+	queries = append(queries, &Query{
+		RawQuery:        rawQuery,
+		QueryType:       queryType,
+		luceneQueryType: luceneQueryType,
+		BucketAggs:      bucketAggs,
+		Metrics:         metrics,
+		Alias:           alias,
+		Interval:        q.Interval,
+		MaxDataPoints:   q.MaxDataPoints,
+		RefID:           q.RefID,
+		Format:          format,
+		TimeRange:       q.TimeRange,
+		TracesSize:      TracesSize,
+		Index:           index,
+		TimeZone:        timeZone,
+		annotation:      annotation,
+		logContext:      logContextSettings,
+		logsVolume:      (queryType == Lucene && luceneQueryType == luceneQueryTypeLogsVolume) || (queryType == PPL && format == logsVolumeType),
+	})
+
 	return queries, nil
 }
 
@@ -2,13 +2,20 @@ package opensearch
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/Masterminds/semver"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+	"github.com/grafana/opensearch-datasource/pkg/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -510,10 +517,69 @@ func TestExecuteTimeSeriesQuery(t *testing.T) {
 			assert.Equal(t, "date_histogram", firstLevel.Aggregation.Type)
 			hAgg := firstLevel.Aggregation.Aggregation.(*client.DateHistogramAgg)
 			assert.Equal(t, "@timestamp", hAgg.Field)
-			assert.Equal(t, "$__interval", hAgg.Interval)
+			assert.Equal(t, "$__fixed_interval", hAgg.FixedInterval)
 			assert.Equal(t, 2, hAgg.MinDocCount)
 		})
 
+		t.Run("With date histogram agg aligned to a time zone", func(t *testing.T) {
+			c := newFakeClient(client.OpenSearch, "2.11.0")
+			_, err := executeTsdbQuery(c, `{
+				"timezone": "Europe/Berlin",
+				"bucketAggs": [
+					{ "type": "date_histogram", "field": "@timestamp", "id": "2", "settings": { "interval": "1d" } },
+					{ "type": "date_histogram", "field": "@timestamp", "id": "3", "settings": { "interval": "2w", "timeZone": "utc" } },
+					{ "type": "date_histogram", "field": "@timestamp", "id": "4", "settings": { "interval": "3M", "timeZone": "browser" } }
+				],
+				"metrics": [{"type": "count", "id": "1" }]
+			}`, from, to, 15*time.Second)
+			require.NoError(t, err)
+			sr := c.multisearchRequests[0].Requests[0]
+
+			daily := sr.Aggs[0].Aggregation.Aggregation.(*client.DateHistogramAgg)
+			assert.Equal(t, "1d", daily.CalendarInterval)
+			assert.Empty(t, daily.Interval)
+			assert.Equal(t, "Europe/Berlin", daily.TimeZone)
+
+			biweekly := sr.Aggs[0].Aggregation.Aggs[0].Aggregation.Aggregation.(*client.DateHistogramAgg)
+			assert.Equal(t, "14d", biweekly.FixedInterval)
+			assert.Equal(t, "UTC", biweekly.TimeZone)
+
+			// the browser time zone is the one the frontend resolved for the query
+			quarterly := sr.Aggs[0].Aggregation.Aggs[0].Aggregation.Aggs[0].Aggregation.Aggregation.(*client.DateHistogramAgg)
+			assert.Equal(t, "3M", quarterly.Interval)
+			assert.Equal(t, "Europe/Berlin", quarterly.TimeZone)
+
+			// the time zone is sent as the time_zone of the date histogram
+			assert.Contains(t, encodeSearchRequest(sr), `"date_histogram":{"field":"@timestamp","calendar_interval":"1d","time_zone":"Europe/Berlin"`)
+		})
+
+		t.Run("With date histogram agg without a time zone", func(t *testing.T) {
+			c := newFakeClient(client.OpenSearch, "2.11.0")
+			_, err := executeTsdbQuery(c, `{
+				"bucketAggs": [{ "type": "date_histogram", "field": "@timestamp", "id": "2", "settings": { "interval": "1d", "timeZone": "browser" } }],
+				"metrics": [{"type": "count", "id": "1" }]
+			}`, from, to, 15*time.Second)
+			require.NoError(t, err)
+
+			hAgg := c.multisearchRequests[0].Requests[0].Aggs[0].Aggregation.Aggregation.(*client.DateHistogramAgg)
+			assert.Empty(t, hAgg.TimeZone)
+		})
+
+		t.Run("With date histogram agg on Elasticsearch before 7.2", func(t *testing.T) {
+			c := newFakeClient(client.Elasticsearch, "7.1.0")
+			_, err := executeTsdbQuery(c, `{
+				"timezone": "Europe/Berlin",
+				"bucketAggs": [{ "type": "date_histogram", "field": "@timestamp", "id": "2", "settings": { "interval": "1d" } }],
+				"metrics": [{"type": "count", "id": "1" }]
+			}`, from, to, 15*time.Second)
+			require.NoError(t, err)
+
+			hAgg := c.multisearchRequests[0].Requests[0].Aggs[0].Aggregation.Aggregation.(*client.DateHistogramAgg)
+			assert.Equal(t, "1d", hAgg.Interval)
+			assert.Empty(t, hAgg.CalendarInterval)
+			assert.Equal(t, "Europe/Berlin", hAgg.TimeZone)
+		})
+
 		t.Run("With histogram agg", func(t *testing.T) {
 			c := newFakeClient(client.OpenSearch, "1.0.0")
 			_, err := executeTsdbQuery(c, `{
@@ -566,6 +632,283 @@ func TestExecuteTimeSeriesQuery(t *testing.T) {
 			assert.Equal(t, "3", ghGridAgg.Precision)
 		})
 
+		t.Run("With geotile grid agg and geo metrics", func(t *testing.T) {
+			c := newFakeClient(client.OpenSearch, "1.0.0")
+			_, err := executeTsdbQuery(c, `{
+				"bucketAggs": [{ "id": "2", "type": "geotile_grid", "field": "location", "settings": { "precision": "10", "size": 500 } }],
+				"metrics": [
+					{ "type": "geo_centroid", "field": "location", "id": "3" },
+					{ "type": "geo_bounds", "field": "location", "id": "4", "settings": { "wrap_longitude": true } }
+				]
+			}`, from, to, 15*time.Second)
+			require.NoError(t, err)
+			sr := c.multisearchRequests[0].Requests[0]
+
+			gridAgg := sr.Aggs[0]
+			assert.Equal(t, "geotile_grid", gridAgg.Aggregation.Type)
+			body, err := json.Marshal(gridAgg.Aggregation.Aggregation)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{ "field": "location", "precision": 10, "size": 500 }`, string(body))
+
+			require.Len(t, gridAgg.Aggregation.Aggs, 2)
+			assert.Equal(t, "geo_centroid", gridAgg.Aggregation.Aggs[0].Aggregation.Type)
+			body, err = json.Marshal(gridAgg.Aggregation.Aggs[1].Aggregation.Aggregation)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{ "field": "location", "wrap_longitude": true }`, string(body))
+		})
+
+		t.Run("With auto date histogram agg", func(t *testing.T) {
+			c := newFakeClient(client.OpenSearch, "2.11.0")
+			_, err := newQueryRequest(c, []backend.DataQuery{{
+				RefID:         "A",
+				MaxDataPoints: 640,
+				TimeRange:     backend.TimeRange{From: from, To: to},
+				JSON: []byte(`{
+					"timeField": "@timestamp",
+					"timezone": "Europe/Berlin",
+					"bucketAggs": [
+						{ "id": "2", "type": "terms", "field": "host" },
+						{ "id": "3", "type": "auto_date_histogram", "settings": { "minimumInterval": "minute" } }
+					],
+					"metrics": [{ "type": "count", "id": "1" }]
+				}`),
+			}}, &backend.DataSourceInstanceSettings{}).execute(context.Background())
+			require.NoError(t, err)
+			sr := c.multisearchRequests[0].Requests[0]
+
+			histogramAgg := sr.Aggs[0].Aggregation.Aggs[0]
+			assert.Equal(t, "3", histogramAgg.Key)
+			assert.Equal(t, "auto_date_histogram", histogramAgg.Aggregation.Type)
+			body, err := json.Marshal(histogramAgg.Aggregation.Aggregation)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{
+				"field": "@timestamp",
+				"buckets": 640,
+				"minimum_interval": "minute",
+				"time_zone": "Europe/Berlin",
+				"format": "epoch_millis"
+			}`, string(body))
+		})
+
+		t.Run("With auto date histogram agg with a number of buckets", func(t *testing.T) {
+			c := newFakeClient(client.OpenSearch, "2.11.0")
+			_, err := executeTsdbQuery(c, `{
+				"timeField": "@timestamp",
+				"bucketAggs": [{ "id": "2", "type": "auto_date_histogram", "field": "created_at", "settings": { "buckets": "50" } }],
+				"metrics": [{ "type": "count", "id": "1" }]
+			}`, from, to, 15*time.Second)
+			require.NoError(t, err)
+			sr := c.multisearchRequests[0].Requests[0]
+
+			histogramAgg := sr.Aggs[0].Aggregation.Aggregation.(*client.AutoDateHistogramAgg)
+			assert.Equal(t, "created_at", histogramAgg.Field)
+			assert.Equal(t, 50, histogramAgg.Buckets)
+		})
+
+		t.Run("With sibling pipeline aggs", func(t *testing.T) {
+			c := newFakeClient(client.OpenSearch, "1.0.0")
+			_, err := executeTsdbQuery(c, `{
+				"bucketAggs": [
+					{ "id": "2", "type": "terms", "field": "host" },
+					{ "id": "3", "type": "date_histogram", "field": "@timestamp" }
+				],
+				"metrics": [
+					{ "id": "1", "type": "avg", "field": "cpu" },
+					{ "id": "4", "type": "max_bucket", "field": "1" },
+					{ "id": "5", "type": "percentiles_bucket", "field": "4", "settings": { "percents": [50, 99] } },
+					{ "id": "6", "type": "count" },
+					{ "id": "7", "type": "sum_bucket", "field": "6" }
+				]
+			}`, from, to, 15*time.Second)
+			require.NoError(t, err)
+			sr := c.multisearchRequests[0].Requests[0]
+
+			termsAggs := sr.Aggs[0].Aggregation.Aggs
+			require.Len(t, termsAggs, 3)
+			assert.Equal(t, "3", termsAggs[0].Key)
+			assert.Equal(t, "4", termsAggs[1].Key)
+			body, err := json.Marshal(termsAggs[1].Aggregation)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{ "max_bucket": { "buckets_path": "3>1" } }`, string(body))
+			assert.Equal(t, "7", termsAggs[2].Key)
+			body, err = json.Marshal(termsAggs[2].Aggregation)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{ "sum_bucket": { "buckets_path": "3>_count" } }`, string(body))
+			// percentiles_bucket refers to a sibling pipeline, which isn't in the buckets
+			for _, agg := range termsAggs[0].Aggregation.Aggs {
+				assert.NotEqual(t, "5", agg.Key)
+			}
+		})
+
+		t.Run("With bucket selector, bucket sort and serial diff", func(t *testing.T) {
+			c := newFakeClient(client.OpenSearch, "1.0.0")
+			_, err := executeTsdbQuery(c, `{
+				"bucketAggs": [{ "id": "2", "type": "terms", "field": "host" }],
+				"metrics": [
+					{ "id": "1", "type": "avg", "field": "cpu" },
+					{ "id": "3", "type": "count" },
+					{ "id": "4", "type": "bucket_selector", "pipelineVariables": [{ "name": "cpu", "pipelineAgg": "1" }, { "name": "docs", "pipelineAgg": "3" }], "settings": { "script": "params.cpu > 0.5 && params.docs > 10" } },
+					{ "id": "5", "type": "bucket_sort", "field": "1", "settings": { "size": "5", "order": "desc" } },
+					{ "id": "6", "type": "serial_diff", "field": "1", "settings": { "lag": 7 } }
+				]
+			}`, from, to, 15*time.Second)
+			require.NoError(t, err)
+			sr := c.multisearchRequests[0].Requests[0]
+
+			aggs := map[string]string{}
+			for _, agg := range sr.Aggs[0].Aggregation.Aggs {
+				body, err := json.Marshal(agg.Aggregation)
+				require.NoError(t, err)
+				aggs[agg.Key] = string(body)
+			}
+			assert.JSONEq(t, `{ "bucket_selector": { "buckets_path": { "cpu": "1", "docs": "_count" }, "script": "params.cpu > 0.5 && params.docs > 10" } }`, aggs["4"])
+			assert.JSONEq(t, `{ "bucket_sort": { "size": 5, "sort": [{ "1": { "order": "desc" } }] } }`, aggs["5"])
+			assert.JSONEq(t, `{ "serial_diff": { "buckets_path": "1", "lag": 7 } }`, aggs["6"])
+		})
+
+		t.Run("With top metrics ordering terms", func(t *testing.T) {
+			c := newFakeClient(client.OpenSearch, "1.0.0")
+			_, err := executeTsdbQuery(c, `{
+				"bucketAggs": [
+					{ "id": "2", "type": "terms", "field": "host", "settings": { "size": "10", "order": "desc", "orderBy": "1" } },
+					{ "id": "3", "type": "date_histogram", "field": "@timestamp" }
+				],
+				"metrics": [{ "id": "1", "type": "top_metrics", "settings": { "metrics": ["status", "cpu"] } }]
+			}`, from, to, 15*time.Second)
+			require.NoError(t, err)
+			sr := c.multisearchRequests[0].Requests[0]
+
+			termsAgg := sr.Aggs[0]
+			assert.Equal(t, map[string]interface{}{"1_sort": "desc"}, termsAgg.Aggregation.Aggregation.(*client.TermsAggregation).Order)
+			require.Len(t, termsAgg.Aggregation.Aggs, 2)
+			orderAgg := termsAgg.Aggregation.Aggs[0]
+			assert.Equal(t, "1_sort", orderAgg.Key)
+			assert.Equal(t, "max", orderAgg.Aggregation.Type)
+			assert.Equal(t, "@timestamp", orderAgg.Aggregation.Aggregation.(*client.MetricAggregation).Field)
+
+			topHitsAgg := termsAgg.Aggregation.Aggs[1].Aggregation.Aggs[0]
+			assert.Equal(t, "1", topHitsAgg.Key)
+			assert.Equal(t, "top_hits", topHitsAgg.Aggregation.Type)
+			body, err := json.Marshal(topHitsAgg.Aggregation.Aggregation)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{
+				"size": 1,
+				"sort": [{ "@timestamp": { "order": "desc", "unmapped_type": "boolean" } }],
+				"_source": { "includes": ["status", "cpu"] }
+			}`, string(body))
+		})
+
+		t.Run("With range aggs", func(t *testing.T) {
+			c := newFakeClient(client.OpenSearch, "1.0.0")
+			_, err := executeTsdbQuery(c, `{
+				"timezone": "Europe/Berlin",
+				"bucketAggs": [
+					{ "id": "2", "type": "range", "field": "latency", "settings": { "ranges": [
+						{ "key": "fast", "to": "100" },
+						{ "key": "ok", "from": 100, "to": 500 },
+						{ "from": "500", "to": "" }
+					] } },
+					{ "id": "3", "type": "ip_range", "field": "client.ip", "settings": { "ranges": [{ "mask": "10.0.0.0/8" }, { "from": "192.168.0.0", "to": "192.168.255.255" }] } },
+					{ "id": "4", "type": "date_range", "field": "@timestamp", "settings": { "format": "yyyy-MM-dd", "ranges": [{ "key": "today", "from": "now/d" }] } }
+				],
+				"metrics": [{"type": "count", "id": "1" }]
+			}`, from, to, 15*time.Second)
+			require.NoError(t, err)
+			sr := c.multisearchRequests[0].Requests[0]
+
+			rangeAgg := sr.Aggs[0]
+			assert.Equal(t, "range", rangeAgg.Aggregation.Type)
+			ranges := rangeAgg.Aggregation.Aggregation.(*client.RangeAggregation)
+			assert.Equal(t, "latency", ranges.Field)
+			body, err := json.Marshal(ranges.Ranges)
+			require.NoError(t, err)
+			assert.JSONEq(t, `[{ "key": "fast", "to": 100 }, { "key": "ok", "from": 100, "to": 500 }, { "from": 500 }]`, string(body))
+			assert.Empty(t, ranges.TimeZone)
+
+			ipRangeAgg := rangeAgg.Aggregation.Aggs[0]
+			assert.Equal(t, "ip_range", ipRangeAgg.Aggregation.Type)
+			body, err = json.Marshal(ipRangeAgg.Aggregation.Aggregation)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{ "field": "client.ip", "ranges": [{ "mask": "10.0.0.0/8" }, { "from": "192.168.0.0", "to": "192.168.255.255" }] }`, string(body))
+
+			dateRangeAgg := ipRangeAgg.Aggregation.Aggs[0]
+			assert.Equal(t, "date_range", dateRangeAgg.Aggregation.Type)
+			body, err = json.Marshal(dateRangeAgg.Aggregation.Aggregation)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{ "field": "@timestamp", "format": "yyyy-MM-dd", "time_zone": "Europe/Berlin", "ranges": [{ "key": "today", "from": "now/d" }] }`, string(body))
+		})
+
+		t.Run("With multi terms agg ordered by a metric", func(t *testing.T) {
+			c := newFakeClient(client.OpenSearch, "2.1.0")
+			_, err := executeTsdbQuery(c, `{
+				"timeField": "@timestamp",
+				"bucketAggs": [
+					{ "id": "2", "type": "multi_terms", "settings": { "fields": ["host", "service"], "size": "5", "min_doc_count": 1, "missing": "n/a", "orderBy": "1", "order": "asc" } },
+					{ "id": "3", "type": "date_histogram", "field": "@timestamp" }
+				],
+				"metrics": [{ "type": "avg", "field": "duration", "id": "1" }]
+			}`, from, to, 15*time.Second)
+			require.NoError(t, err)
+			sr := c.multisearchRequests[0].Requests[0]
+
+			multiTermsAgg := sr.Aggs[0]
+			assert.Equal(t, "multi_terms", multiTermsAgg.Aggregation.Type)
+			body, err := json.Marshal(multiTermsAgg.Aggregation.Aggregation)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{
+				"terms": [{ "field": "host", "missing": "n/a" }, { "field": "service", "missing": "n/a" }],
+				"size": 5,
+				"min_doc_count": 1,
+				"order": { "1": "asc" }
+			}`, string(body))
+			require.Len(t, multiTermsAgg.Aggregation.Aggs, 2)
+			assert.Equal(t, "1", multiTermsAgg.Aggregation.Aggs[0].Key)
+			assert.Equal(t, "date_histogram", multiTermsAgg.Aggregation.Aggs[1].Aggregation.Type)
+		})
+
+		t.Run("With multi terms agg of a single field", func(t *testing.T) {
+			c := newFakeClient(client.OpenSearch, "2.1.0")
+			_, err := executeTsdbQuery(c, `{
+				"bucketAggs": [{ "id": "2", "type": "multi_terms", "field": "host" }],
+				"metrics": [{ "type": "count", "id": "1" }]
+			}`, from, to, 15*time.Second)
+			require.NoError(t, err)
+			assert.Empty(t, c.multisearchRequests)
+		})
+
+		t.Run("With nested and reverse nested aggs", func(t *testing.T) {
+			c := newFakeClient(client.OpenSearch, "1.0.0")
+			_, err := executeTsdbQuery(c, `{
+				"timeField": "@timestamp",
+				"bucketAggs": [
+					{ "id": "2", "type": "nested", "field": "attributes" },
+					{ "id": "3", "type": "terms", "field": "attributes.name" },
+					{ "id": "4", "type": "reverse_nested" },
+					{ "id": "5", "type": "date_histogram", "field": "@timestamp" }
+				],
+				"metrics": [{"type": "avg", "field": "duration", "id": "1" }]
+			}`, from, to, 15*time.Second)
+			require.NoError(t, err)
+			sr := c.multisearchRequests[0].Requests[0]
+
+			nestedAgg := sr.Aggs[0]
+			assert.Equal(t, "2", nestedAgg.Key)
+			assert.Equal(t, "nested", nestedAgg.Aggregation.Type)
+			assert.Equal(t, "attributes", nestedAgg.Aggregation.Aggregation.(*client.NestedAggregation).Path)
+
+			termsAgg := nestedAgg.Aggregation.Aggs[0]
+			assert.Equal(t, "terms", termsAgg.Aggregation.Type)
+
+			reverseNestedAgg := termsAgg.Aggregation.Aggs[0]
+			assert.Equal(t, "4", reverseNestedAgg.Key)
+			assert.Equal(t, "reverse_nested", reverseNestedAgg.Aggregation.Type)
+			assert.Empty(t, reverseNestedAgg.Aggregation.Aggregation.(*client.ReverseNestedAggregation).Path)
+
+			histogramAgg := reverseNestedAgg.Aggregation.Aggs[0]
+			assert.Equal(t, "date_histogram", histogramAgg.Aggregation.Type)
+			assert.Equal(t, "avg", histogramAgg.Aggregation.Aggs[0].Aggregation.Type)
+		})
+
 		t.Run("With moving average", func(t *testing.T) {
 			c := newFakeClient(client.OpenSearch, "1.0.0")
 			_, err := executeTsdbQuery(c, `{
@@ -1021,20 +1364,45 @@ func Test_timeSeriesQuery_execute_processTimeSeriesQuery_size_in_search_request(
 }
 
 type fakeClient struct {
+	// mu guards the recorded requests, which handlers send concurrently
+	mu                  sync.Mutex
 	flavor              client.Flavor
 	version             *semver.Version
 	timeField           string
+	logLevelField       string
+	logMessageField     string
 	index               string
 	multiSearchResponse *client.MultiSearchResponse
-	multiSearchError    error
+	// multiSearchResponses, when set, are returned in order instead of multiSearchResponse
+	multiSearchResponses []*client.MultiSearchResponse
+	multiSearchError     error
+	// multiSearchExecute, when set, is called instead of returning multiSearchResponse
+	multiSearchExecute  func(r *client.MultiSearchRequest) (*client.MultiSearchResponse, error)
 	builder             *client.MultiSearchRequestBuilder
 	pplbuilder          *client.PPLRequestBuilder
 	multisearchRequests []*client.MultiSearchRequest
 	pplRequest          []*client.PPLRequest
 	pplResponse         *client.PPLResponse
+	// pplExecute, when set, is called instead of returning pplResponse
+	pplExecute   func(r *client.PPLRequest) (*client.PPLResponse, error)
+	sqlRequest   []*client.SQLRequest
+	sqlResponse  *client.SQLResponse
+	pitID        string
+	pitError     error
+	closedPitIDs []string
+	// openPointInTime, when set, is called instead of returning pitID and pitError
+	openPointInTime func(r *client.SearchRequest) (string, error)
+	// asyncSearch, when set, is called for every asynchronous search, which is
+	// otherwise not supported
+	asyncSearch         func(r *client.SearchRequest) (*client.SearchResponse, error)
+	asyncSearchRequests []*client.SearchRequest
 	// numberOfShards is returned by GetNumberOfShards; 0 means "default to 1".
 	numberOfShards      int
 	numberOfShardsError error
+	// fieldTypes is returned by GetFieldTypes, which fails when it is nil
+	fieldTypes         map[string][]string
+	fieldTypesRequests int
+	fieldTypesIndices  []string
 }
 
 func newFakeClient(flavor client.Flavor, versionString string) *fakeClient {
@@ -1049,6 +1417,8 @@ func newFakeClient(flavor client.Flavor, versionString string) *fakeClient {
 		multiSearchResponse: &client.MultiSearchResponse{},
 		pplRequest:          make([]*client.PPLRequest, 0),
 		pplResponse:         &client.PPLResponse{},
+		sqlRequest:          make([]*client.SQLRequest, 0),
+		sqlResponse:         &client.SQLResponse{},
 	}
 }
 
@@ -1063,7 +1433,7 @@ func (c *fakeClient) GetVersion() *semver.Version {
 }
 
 func (c *fakeClient) GetConfiguredFields() client.ConfiguredFields {
-	return client.ConfiguredFields{TimeField: c.timeField}
+	return client.ConfiguredFields{TimeField: c.timeField, LogLevelField: c.logLevelField, LogMessageField: c.logMessageField}
 }
 
 func (c *fakeClient) GetIndex() string {
@@ -1080,13 +1450,92 @@ func (c *fakeClient) GetNumberOfShards(index string) (int, error) {
 	return c.numberOfShards, nil
 }
 
+func (c *fakeClient) GetFieldTypes(ctx context.Context, index string) (map[string][]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fieldTypesRequests++
+	c.fieldTypesIndices = append(c.fieldTypesIndices, index)
+	if c.fieldTypes == nil {
+		return nil, errors.New("no field types")
+	}
+	return c.fieldTypes, nil
+}
+
+// SearchIndex resolves the index pattern, which is a prefix, to the index of the
+// day the time range starts
+func (c *fakeClient) SearchIndex(index string, timeRange backend.TimeRange) string {
+	if index != "" {
+		return index
+	}
+	return c.index + timeRange.From.UTC().Format("2006.01.02")
+}
+
 func (c *fakeClient) GetMinInterval(queryInterval time.Duration) (time.Duration, error) {
 	return 15 * time.Second, nil
 }
 
 func (c *fakeClient) ExecuteMultisearch(ctx context.Context, r *client.MultiSearchRequest) (*client.MultiSearchResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.multisearchRequests = append(c.multisearchRequests, r)
-	return c.multiSearchResponse, c.multiSearchError
+	if c.multiSearchExecute != nil {
+		return c.multiSearchExecute(r)
+	}
+	res := c.multiSearchResponse
+	if len(c.multiSearchResponses) > 0 {
+		res = c.multiSearchResponses[0]
+		c.multiSearchResponses = c.multiSearchResponses[1:]
+	}
+	return withExecutedRequests(res, r), c.multiSearchError
+}
+
+// withExecutedRequests returns a copy of the responses with the searches of r they
+// answer, as the client sets them
+func withExecutedRequests(res *client.MultiSearchResponse, r *client.MultiSearchRequest) *client.MultiSearchResponse {
+	if res == nil {
+		return nil
+	}
+	executed := *res
+	executed.Responses = make([]*client.SearchResponse, len(res.Responses))
+	for i, searchRes := range res.Responses {
+		if searchRes != nil && i < len(r.Requests) {
+			copied := *searchRes
+			copied.ExecutedRequest = encodeSearchRequest(r.Requests[i])
+			searchRes = &copied
+		}
+		executed.Responses[i] = searchRes
+	}
+	return &executed
+}
+
+func (c *fakeClient) OpenPointInTime(ctx context.Context, r *client.SearchRequest, keepAlive string) (string, error) {
+	if c.openPointInTime != nil {
+		return c.openPointInTime(r)
+	}
+	return c.pitID, c.pitError
+}
+
+func (c *fakeClient) ClosePointInTime(ctx context.Context, id string) error {
+	c.closedPitIDs = append(c.closedPitIDs, id)
+	return nil
+}
+
+func (c *fakeClient) ExecuteAsyncSearch(ctx context.Context, r *client.SearchRequest) (*client.SearchResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.asyncSearch == nil {
+		return nil, client.ErrAsyncSearchNotSupported
+	}
+	c.asyncSearchRequests = append(c.asyncSearchRequests, r)
+	return c.asyncSearch(r)
+}
+
+// encodeSearchRequest returns the lines the fake client sends for a search: its index
+// and its body
+func encodeSearchRequest(r *client.SearchRequest) string {
+	header, _ := json.Marshal(map[string]interface{}{"index": r.IndexOverride})
+	body, _ := json.Marshal(r)
+	return string(header) + "\n" + string(body)
 }
 
 func (c *fakeClient) MultiSearch() *client.MultiSearchRequestBuilder {
@@ -1095,7 +1544,12 @@ func (c *fakeClient) MultiSearch() *client.MultiSearchRequestBuilder {
 }
 
 func (c *fakeClient) ExecutePPLQuery(ctx context.Context, r *client.PPLRequest) (*client.PPLResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.pplRequest = append(c.pplRequest, r)
+	if c.pplExecute != nil {
+		return c.pplExecute(r)
+	}
 	return c.pplResponse, c.multiSearchError
 }
 
@@ -1104,6 +1558,17 @@ func (c *fakeClient) PPL() *client.PPLRequestBuilder {
 	return c.pplbuilder
 }
 
+func (c *fakeClient) ExecuteSQLQuery(ctx context.Context, r *client.SQLRequest) (*client.SQLResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sqlRequest = append(c.sqlRequest, r)
+	return c.sqlResponse, c.multiSearchError
+}
+
+func (c *fakeClient) SQL() *client.SQLRequestBuilder {
+	return client.NewSQLRequestBuilder(c.GetIndex())
+}
+
 func newTsdbQueries(body string) ([]backend.DataQuery, error) {
 	return []backend.DataQuery{
 		{
@@ -1333,7 +1798,7 @@ func Test_parse_queryType(t *testing.T) {
 		assert.Empty(t, c.pplRequest, 0)
 
 		assert.Equal(t, backend.ErrorSourceDownstream, queryRes.Responses["A"].ErrorSource)
-		assert.Equal(t, `invalid queryType: "randomWalk", expected Lucene or PPL`, queryRes.Responses["A"].Error.Error())
+		assert.Equal(t, `invalid queryType: "randomWalk", expected Lucene, PPL or SQL`, queryRes.Responses["A"].Error.Error())
 		var unwrappedError invalidQueryTypeError
 		assert.True(t, errors.As(queryRes.Responses["A"].Error, &unwrappedError))
 	})
@@ -1354,7 +1819,7 @@ func Test_parse_queryType(t *testing.T) {
 		assert.Empty(t, c.multisearchRequests, 0) // multisearchRequests is a Lucene query
 		assert.Empty(t, c.pplRequest, 0)
 		assert.Equal(t, backend.ErrorSourceDownstream, queryRes.Responses["A"].ErrorSource)
-		assert.Equal(t, `invalid queryType: "", expected Lucene or PPL`, queryRes.Responses["A"].Error.Error())
+		assert.Equal(t, `invalid queryType: "", expected Lucene, PPL or SQL`, queryRes.Responses["A"].Error.Error())
 		var unwrappedError invalidQueryTypeError
 		assert.True(t, errors.As(queryRes.Responses["A"].Error, &unwrappedError))
 	})
@@ -1472,7 +1937,7 @@ func TestSettingsCasting_luceneHandler_processQuery_processLogsQuery_ignores_any
 
 	assert.Equal(t, &client.DateHistogramAgg{
 		Field:          "@timestamp",
-		Interval:       "$__interval",
+		FixedInterval:  "$__fixed_interval",
 		MinDocCount:    0,
 		Missing:        nil,
 		ExtendedBounds: &client.ExtendedBounds{Min: from.UnixMilli(), Max: to.UnixMilli()},
@@ -1481,6 +1946,56 @@ func TestSettingsCasting_luceneHandler_processQuery_processLogsQuery_ignores_any
 	}, sr.Aggs[0].Aggregation.Aggregation.(*client.DateHistogramAgg))
 }
 
+func Test_logs_query_highlighting(t *testing.T) {
+	from := time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC)
+	to := time.Date(2018, 5, 15, 17, 55, 0, 0, time.UTC)
+
+	t.Run("highlights the terms matching the query in the message field", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		c.logMessageField = "message"
+		_, err := executeTsdbQuery(c, `{
+			"timeField": "@timestamp",
+			"query": "level:error",
+			"metrics": [{ "id": "1", "type": "logs" }]
+		}`, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		assert.Equal(t, &client.Highlight{
+			Fields:       map[string]interface{}{"message": map[string]interface{}{}},
+			PreTags:      []string{"@HIGHLIGHT@"},
+			PostTags:     []string{"@/HIGHLIGHT@"},
+			FragmentSize: 2147483647,
+		}, c.multisearchRequests[0].Requests[0].Highlight)
+	})
+
+	t.Run("highlights all fields when the message is the whole source", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		c.logMessageField = "_source"
+		_, err := executeTsdbQuery(c, `{
+			"timeField": "@timestamp",
+			"query": "level:error",
+			"metrics": [{ "id": "1", "type": "logs" }]
+		}`, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		highlight := c.multisearchRequests[0].Requests[0].Highlight
+		require.NotNil(t, highlight)
+		assert.Equal(t, map[string]interface{}{"*": map[string]interface{}{}}, highlight.Fields)
+	})
+
+	t.Run("doesn't highlight without a query", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		c.logMessageField = "message"
+		_, err := executeTsdbQuery(c, `{
+			"timeField": "@timestamp",
+			"metrics": [{ "id": "1", "type": "logs" }]
+		}`, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		assert.Nil(t, c.multisearchRequests[0].Requests[0].Highlight)
+	})
+}
+
 func Test_trace_list(t *testing.T) {
 	// When luceneQueryType = Traces, then the request to OpenSearch includes certain aggs and passes query string and time range
 	from := time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC)
@@ -1612,3 +2127,1025 @@ func Test_trace_list(t *testing.T) {
 		},
 	}, actualRequest.Aggs[0].Aggregation.Aggs[3])
 }
+
+func Test_annotations_query(t *testing.T) {
+	from := time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC)
+	to := time.Date(2018, 5, 15, 17, 55, 0, 0, time.UTC)
+	fromMs := from.UnixMilli()
+	toMs := to.UnixMilli()
+
+	t.Run("Lucene annotation query filters on the annotation time field", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		_, err := executeTsdbQuery(c, `{
+				"query": "tags:deploy",
+				"luceneQueryType": "Annotations",
+				"annotation": { "timeField": "start", "textField": "message" }
+			}`, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		sr := c.multisearchRequests[0].Requests[0]
+		assert.Equal(t, defaultAnnotationsSize, sr.Size)
+		require.Len(t, sr.Query.Bool.Filters, 2)
+		rangeFilter := sr.Query.Bool.Filters[0].(*client.RangeFilter)
+		assert.Equal(t, "start", rangeFilter.Key)
+		assert.Equal(t, toMs, rangeFilter.Lte)
+		assert.Equal(t, fromMs, rangeFilter.Gte)
+		assert.Equal(t, "tags:deploy", sr.Query.Bool.Filters[1].(*client.QueryStringFilter).Query)
+		assert.Empty(t, sr.Aggs)
+		require.Len(t, sr.Sort, 1)
+		assert.Equal(t, map[string]map[string]string{"start": {"order": "desc", "unmapped_type": "boolean"}}, sr.Sort[0])
+	})
+
+	t.Run("Lucene annotation query with an end time field matches regions overlapping the range", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		_, err := executeTsdbQuery(c, `{
+				"luceneQueryType": "Annotations",
+				"annotation": { "timeEndField": "end" }
+			}`, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		sr := c.multisearchRequests[0].Requests[0]
+		require.Len(t, sr.Query.Bool.Filters, 1)
+		filter, err := json.Marshal(sr.Query.Bool.Filters[0])
+		require.NoError(t, err)
+		assert.JSONEq(t, fmt.Sprintf(`{"bool": {"should": [
+			{"bool": {"filter": [
+				{"range": {"@timestamp": {"lte": %[2]d, "format": "epoch_millis"}}},
+				{"range": {"end": {"gte": %[1]d, "format": "epoch_millis"}}}
+			]}},
+			{"range": {"@timestamp": {"gte": %[1]d, "lte": %[2]d, "format": "epoch_millis"}}}
+		]}}`, fromMs, toMs), string(filter))
+
+		for name, tc := range map[string]struct {
+			doc     map[string]int64
+			matches bool
+		}{
+			"region spanning the whole range": {map[string]int64{"@timestamp": fromMs - 60000, "end": toMs + 60000}, true},
+			"region starting in the range":    {map[string]int64{"@timestamp": fromMs + 1000, "end": toMs + 60000}, true},
+			"region ending in the range":      {map[string]int64{"@timestamp": fromMs - 60000, "end": toMs - 1000}, true},
+			"region before the range":         {map[string]int64{"@timestamp": fromMs - 60000, "end": fromMs - 1000}, false},
+			"region after the range":          {map[string]int64{"@timestamp": toMs + 1000, "end": toMs + 60000}, false},
+			"event without an end":            {map[string]int64{"@timestamp": fromMs + 1000}, true},
+		} {
+			assert.Equal(t, tc.matches, matchesRangeFilters(sr.Query.Bool.Filters[0], tc.doc), name)
+		}
+	})
+
+	t.Run("PPL annotation query filters on the annotation time field", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		_, err := executeTsdbQuery(c, `{
+				"query": "source = events",
+				"queryType": "PPL",
+				"format": "annotations",
+				"annotation": { "timeField": "start" }
+			}`, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		require.Len(t, c.pplRequest, 1)
+		assert.Equal(t, "source = events | where `start` >= timestamp('2018-05-15 17:50:00') and `start` <= timestamp('2018-05-15 17:55:00')", c.pplRequest[0].Query)
+	})
+}
+
+// matchesRangeFilters evaluates the range filters of a query against the time fields
+// of a document, missing fields matching no range
+func matchesRangeFilters(filter client.Filter, doc map[string]int64) bool {
+	switch f := filter.(type) {
+	case client.Query:
+		return matchesRangeFilters(f.Bool, doc)
+	case *client.BoolQuery:
+		for _, filter := range f.Filters {
+			if !matchesRangeFilters(filter, doc) {
+				return false
+			}
+		}
+		if len(f.ShouldFilters) == 0 {
+			return true
+		}
+		for _, filter := range f.ShouldFilters {
+			if matchesRangeFilters(filter, doc) {
+				return true
+			}
+		}
+		return false
+	case *client.RangeFilter:
+		value, ok := doc[f.Key]
+		return ok && value >= f.Gte && value <= f.Lte
+	case *client.RangeBoundFilter:
+		value, ok := doc[f.Key]
+		switch f.Operator {
+		case "gt":
+			return ok && value > f.Value
+		case "gte":
+			return ok && value >= f.Value
+		case "lt":
+			return ok && value < f.Value
+		default:
+			return ok && value <= f.Value
+		}
+	}
+	return false
+}
+
+func Test_per_query_time_ranges(t *testing.T) {
+	from := time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC)
+	to := time.Date(2018, 5, 15, 17, 55, 0, 0, time.UTC)
+	// B is time shifted by one day
+	shiftedFrom := from.Add(-24 * time.Hour)
+	shiftedTo := to.Add(-24 * time.Hour)
+
+	newQueries := func(json string) []backend.DataQuery {
+		return []backend.DataQuery{
+			{RefID: "A", JSON: []byte(json), TimeRange: backend.TimeRange{From: from, To: to}},
+			{RefID: "B", JSON: []byte(json), TimeRange: backend.TimeRange{From: shiftedFrom, To: shiftedTo}},
+		}
+	}
+
+	t.Run("Lucene queries use their own time range", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		queries := newQueries(`{
+			"metrics": [{ "type": "count", "id": "1" }],
+			"bucketAggs": [{ "type": "date_histogram", "field": "@timestamp", "id": "2" }]
+		}`)
+		_, err := newQueryRequest(c, queries, &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, c.multisearchRequests, 1)
+		requests := c.multisearchRequests[0].Requests
+		require.Len(t, requests, 2)
+		for i, q := range queries {
+			sr := requests[i]
+			assert.Equal(t, q.TimeRange, sr.TimeRange)
+			rangeFilter := sr.Query.Bool.Filters[0].(*client.RangeFilter)
+			assert.Equal(t, q.TimeRange.From.UnixMilli(), rangeFilter.Gte)
+			assert.Equal(t, q.TimeRange.To.UnixMilli(), rangeFilter.Lte)
+			dateHistogramAgg := sr.Aggs[0].Aggregation.Aggregation.(*client.DateHistogramAgg)
+			assert.Equal(t, q.TimeRange.From.UnixMilli(), dateHistogramAgg.ExtendedBounds.Min)
+			assert.Equal(t, q.TimeRange.To.UnixMilli(), dateHistogramAgg.ExtendedBounds.Max)
+		}
+	})
+
+	t.Run("PPL queries use their own time range", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		queries := newQueries(`{ "query": "source = logs", "queryType": "PPL", "format": "table" }`)
+		_, err := newQueryRequest(c, queries, &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, c.pplRequest, 2)
+		queriesSent := []string{c.pplRequest[0].Query, c.pplRequest[1].Query}
+		assert.ElementsMatch(t, []string{
+			"source = logs | where `@timestamp` >= timestamp('2018-05-15 17:50:00') and `@timestamp` <= timestamp('2018-05-15 17:55:00')",
+			"source = logs | where `@timestamp` >= timestamp('2018-05-14 17:50:00') and `@timestamp` <= timestamp('2018-05-14 17:55:00')",
+		}, queriesSent)
+	})
+}
+
+func Test_sql_query(t *testing.T) {
+	from := time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC)
+	to := time.Date(2018, 5, 15, 17, 55, 0, 0, time.UTC)
+
+	t.Run("SQL query expands the time filter macro", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		_, err := executeTsdbQuery(c, `{
+				"query": "SELECT * FROM logs WHERE $__timeFilter",
+				"queryType": "SQL",
+				"format": "table"
+			}`, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		require.Len(t, c.sqlRequest, 1)
+		assert.Equal(t, "SELECT * FROM logs WHERE `@timestamp` >= timestamp('2018-05-15 17:50:00') and `@timestamp` <= timestamp('2018-05-15 17:55:00')", c.sqlRequest[0].Query)
+		assert.Empty(t, c.pplRequest)
+		assert.Empty(t, c.multisearchRequests)
+	})
+
+	t.Run("SQL time series response is parsed into a time series frame", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		c.sqlResponse = &client.SQLResponse{
+			Schema: []client.FieldSchema{{Name: "count(*)", Type: "integer"}, {Name: "ts", Type: "timestamp"}},
+			Datarows: []client.Datarow{
+				{float64(3), "2018-05-15 17:50:00"},
+				{float64(5), "2018-05-15 17:51:00"},
+			},
+		}
+		res, err := executeTsdbQuery(c, `{
+				"query": "SELECT count(*), ts FROM logs WHERE $__timeFilter GROUP BY ts",
+				"queryType": "SQL"
+			}`, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		queryRes := res.Responses["A"]
+		require.NoError(t, queryRes.Error)
+		require.Len(t, queryRes.Frames, 1)
+		frame := queryRes.Frames[0]
+		assert.Equal(t, "count(*)", frame.Name)
+		require.Len(t, frame.Fields, 2)
+		assert.Equal(t, 2, frame.Fields[0].Len())
+		assert.Equal(t, from, *frame.Fields[0].At(0).(*time.Time))
+		assert.Equal(t, float64(5), *frame.Fields[1].At(1).(*float64))
+	})
+
+	t.Run("SQL error status returns a downstream error", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		c.sqlResponse = &client.SQLResponse{
+			Status: 400,
+			Error:  map[string]interface{}{"reason": "Invalid SQL query", "details": "unknown field"},
+		}
+		res, err := executeTsdbQuery(c, `{ "query": "SELECT nope FROM logs", "queryType": "SQL", "format": "table" }`, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		queryRes := res.Responses["A"]
+		require.Error(t, queryRes.Error)
+		assert.Equal(t, "ExecuteSQLQuery received unexpected status code 400: Invalid SQL query, unknown field", queryRes.Error.Error())
+		assert.Equal(t, backend.ErrorSourceDownstream, queryRes.ErrorSource)
+	})
+}
+
+func Test_paginated_documents_query(t *testing.T) {
+	from := time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC)
+	to := time.Date(2018, 5, 15, 17, 55, 0, 0, time.UTC)
+	query := `{
+		"metrics": [{ "id": "1", "type": "raw_data", "settings": { "size": "2", "limit": "5" } }]
+	}`
+
+	page := func(ids ...int) *client.MultiSearchResponse {
+		hits := make([]map[string]interface{}, 0, len(ids))
+		for _, id := range ids {
+			hits = append(hits, map[string]interface{}{
+				"_id":     strconv.Itoa(id),
+				"_source": map[string]interface{}{"@timestamp": "2018-05-15T17:50:00Z", "id": float64(id)},
+				"sort":    []interface{}{float64(1526406600000 - id), float64(id)},
+			})
+		}
+		return &client.MultiSearchResponse{Responses: []*client.SearchResponse{{Hits: &client.SearchResponseHits{Hits: hits}}}}
+	}
+
+	t.Run("pages through the documents within a point in time", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.pitID = "pit-1"
+		c.multiSearchResponses = []*client.MultiSearchResponse{page(1, 2), page(3, 4), page(5)}
+
+		res, err := executeTsdbQuery(c, query, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		require.Len(t, c.multisearchRequests, 3)
+		sizes := []int{}
+		for i, r := range c.multisearchRequests {
+			require.Len(t, r.Requests, 1)
+			sr := r.Requests[0]
+			sizes = append(sizes, sr.Size)
+			assert.Equal(t, &client.PointInTime{ID: "pit-1", KeepAlive: pointInTimeKeepAlive}, sr.PointInTime)
+			if i == 0 {
+				assert.Empty(t, sr.SearchAfter)
+			}
+		}
+		assert.Equal(t, []int{2, 2, 1}, sizes)
+		assert.Equal(t, []interface{}{float64(1526406600000 - 2), float64(2)}, c.multisearchRequests[1].Requests[0].SearchAfter)
+		assert.Equal(t, []interface{}{float64(1526406600000 - 4), float64(4)}, c.multisearchRequests[2].Requests[0].SearchAfter)
+		assert.Equal(t, []string{"pit-1"}, c.closedPitIDs)
+
+		queryRes := res.Responses["A"]
+		require.NoError(t, queryRes.Error)
+		require.Len(t, queryRes.Frames, 1)
+		assert.Equal(t, 5, queryRes.Frames[0].Rows())
+		// the frame carries the search of the first page
+		assert.Equal(t, encodeSearchRequest(c.multisearchRequests[0].Requests[0]), queryRes.Frames[0].Meta.ExecutedQueryString)
+	})
+
+	t.Run("stops when a page is not full", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.pitID = "pit-1"
+		c.multiSearchResponses = []*client.MultiSearchResponse{page(1, 2), page(3)}
+
+		res, err := executeTsdbQuery(c, query, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		assert.Len(t, c.multisearchRequests, 2)
+		assert.Equal(t, 3, res.Responses["A"].Frames[0].Rows())
+	})
+
+	t.Run("pages with search_after alone when points in time are not supported", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "1.3.0")
+		c.pitError = client.ErrPointInTimeNotSupported
+		c.multiSearchResponses = []*client.MultiSearchResponse{page(1, 2), page(3, 4), page(5)}
+
+		res, err := executeTsdbQuery(c, query, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		require.Len(t, c.multisearchRequests, 3)
+		assert.Nil(t, c.multisearchRequests[1].Requests[0].PointInTime)
+		assert.Equal(t, []interface{}{float64(1526406600000 - 2), float64(2)}, c.multisearchRequests[1].Requests[0].SearchAfter)
+		assert.Empty(t, c.closedPitIDs)
+		assert.Equal(t, 5, res.Responses["A"].Frames[0].Rows())
+
+		// _doc isn't stable between searches, so _id breaks the ties of timestamps
+		for _, r := range c.multisearchRequests {
+			require.Len(t, r.Requests[0].Sort, 2)
+			assert.Equal(t, map[string]map[string]string{"_id": {"order": "desc"}}, r.Requests[0].Sort[1])
+		}
+	})
+
+	t.Run("returns the documents fetched before a page failed with a notice", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.pitID = "pit-1"
+		failed := &client.MultiSearchResponse{Responses: []*client.SearchResponse{{
+			Error: map[string]interface{}{"reason": "point in time expired"},
+		}}}
+		c.multiSearchResponses = []*client.MultiSearchResponse{page(1, 2), page(3, 4), failed}
+
+		res, err := executeTsdbQuery(c, query, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		require.Len(t, c.multisearchRequests, 3)
+		queryRes := res.Responses["A"]
+		require.NoError(t, queryRes.Error)
+		require.Len(t, queryRes.Frames, 1)
+		assert.Equal(t, 4, queryRes.Frames[0].Rows())
+		assert.Contains(t, queryRes.Frames[0].Meta.Notices, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     "Only the first 4 documents were fetched, the next page failed: point in time expired",
+		})
+		assert.Equal(t, []string{"pit-1"}, c.closedPitIDs)
+	})
+
+	t.Run("reports the error of the first page", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.pitID = "pit-1"
+		c.multiSearchResponses = []*client.MultiSearchResponse{{Responses: []*client.SearchResponse{{
+			Error: map[string]interface{}{"reason": "index not found"},
+		}}}}
+
+		res, err := executeTsdbQuery(c, query, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		require.Len(t, c.multisearchRequests, 1)
+		assert.EqualError(t, res.Responses["A"].Error, "index not found")
+	})
+
+	t.Run("returns an error when the point in time can't be created", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.pitError = errors.New("index not found")
+
+		res, err := executeTsdbQuery(c, query, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		assert.Empty(t, c.multisearchRequests)
+		assert.EqualError(t, res.Responses["A"].Error, "index not found")
+	})
+
+	t.Run("logs queries add a _doc tiebreaker and only aggregate on the first page", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.pitID = "pit-1"
+		c.multiSearchResponses = []*client.MultiSearchResponse{page(1, 2), page(3)}
+
+		_, err := executeTsdbQuery(c, `{
+			"metrics": [{ "id": "1", "type": "logs", "settings": { "size": "2", "limit": "4" } }]
+		}`, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		require.Len(t, c.multisearchRequests, 2)
+		first := c.multisearchRequests[0].Requests[0]
+		assert.Equal(t, map[string]map[string]string{"_doc": {"order": "desc"}}, first.Sort[1])
+		assert.Len(t, first.Aggs, 1)
+		assert.Empty(t, c.multisearchRequests[1].Requests[0].Aggs)
+	})
+
+	t.Run("paginated searches are paged through concurrently", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.multiSearchResponse = page(1)
+		var arrived sync.WaitGroup
+		arrived.Add(2)
+		c.openPointInTime = func(r *client.SearchRequest) (string, error) {
+			arrived.Done()
+			concurrent := make(chan struct{})
+			go func() {
+				arrived.Wait()
+				close(concurrent)
+			}()
+			select {
+			case <-concurrent:
+				return "", client.ErrPointInTimeNotSupported
+			case <-time.After(time.Second):
+				return "", errors.New("paginated searches are not concurrent")
+			}
+		}
+		queries := []backend.DataQuery{
+			{RefID: "A", JSON: []byte(query), TimeRange: backend.TimeRange{From: from, To: to}},
+			{RefID: "B", JSON: []byte(query), TimeRange: backend.TimeRange{From: from, To: to}},
+		}
+
+		res, err := newQueryRequest(c, queries, &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, res.Responses, 2)
+		for refID, queryRes := range res.Responses {
+			require.NoError(t, queryRes.Error, refID)
+			assert.Equal(t, 1, queryRes.Frames[0].Rows(), refID)
+		}
+	})
+
+	t.Run("is not used when the limit fits in one page", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.pitID = "pit-1"
+
+		_, err := executeTsdbQuery(c, `{
+			"metrics": [{ "id": "1", "type": "raw_data", "settings": { "size": "500", "limit": "100" } }]
+		}`, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		require.Len(t, c.multisearchRequests, 1)
+		assert.Nil(t, c.multisearchRequests[0].Requests[0].PointInTime)
+		assert.Equal(t, 500, c.multisearchRequests[0].Requests[0].Size)
+	})
+}
+
+func Test_per_query_error_isolation(t *testing.T) {
+	from := time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC)
+	to := time.Date(2018, 5, 15, 17, 55, 0, 0, time.UTC)
+	rawDataQuery := `{ "metrics": [{ "id": "1", "type": "raw_data" }] }`
+	pplQuery := `{ "query": "source = logs", "queryType": "PPL", "format": "table" }`
+	newQueries := func(jsons ...string) []backend.DataQuery {
+		queries := make([]backend.DataQuery, 0, len(jsons))
+		for i, json := range jsons {
+			queries = append(queries, backend.DataQuery{
+				RefID:     string(rune('A' + i)),
+				JSON:      []byte(json),
+				TimeRange: backend.TimeRange{From: from, To: to},
+			})
+		}
+		return queries
+	}
+	hitsResponse := &client.MultiSearchResponse{Responses: []*client.SearchResponse{
+		{Hits: &client.SearchResponseHits{Hits: []map[string]interface{}{{"_id": "1", "_source": map[string]interface{}{"message": "hello"}}}}},
+	}}
+	pplResponse := func(r *client.PPLRequest) (*client.PPLResponse, error) {
+		return &client.PPLResponse{Schema: []client.FieldSchema{{Name: "message", Type: "string"}}, Datarows: []client.Datarow{{"hello"}}}, nil
+	}
+
+	t.Run("a query that fails to parse does not drop the other queries", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		c.multiSearchResponse = hitsResponse
+		res, err := newQueryRequest(c, newQueries(`{ "queryType": "randomWalk" }`, rawDataQuery), &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, res.Responses, 2)
+		assert.EqualError(t, res.Responses["A"].Error, `invalid queryType: "randomWalk", expected Lucene, PPL or SQL`)
+		assert.Equal(t, backend.ErrorSourceDownstream, res.Responses["A"].ErrorSource)
+		assert.NoError(t, res.Responses["B"].Error)
+		assert.Len(t, res.Responses["B"].Frames, 1)
+	})
+
+	t.Run("a query that fails to process does not drop the other queries", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		c.multiSearchResponse = hitsResponse
+		res, err := newQueryRequest(c, newQueries(`{ "metrics": [] }`, rawDataQuery), &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, res.Responses, 2)
+		assert.EqualError(t, res.Responses["A"].Error, "invalid query, missing metrics and aggregations")
+		assert.NoError(t, res.Responses["B"].Error)
+		require.Len(t, c.multisearchRequests, 1)
+		assert.Len(t, c.multisearchRequests[0].Requests, 1)
+	})
+
+	t.Run("a multisearch error is reported for every Lucene query", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		c.multiSearchResponse = nil
+		c.multiSearchError = backend.DownstreamError(errors.New("connection refused"))
+		c.pplExecute = pplResponse
+		res, err := newQueryRequest(c, newQueries(rawDataQuery, rawDataQuery, pplQuery), &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, res.Responses, 3)
+		for _, refID := range []string{"A", "B"} {
+			assert.EqualError(t, res.Responses[refID].Error, "connection refused")
+			assert.Equal(t, backend.ErrorSourceDownstream, res.Responses[refID].ErrorSource)
+		}
+		assert.NoError(t, res.Responses["C"].Error)
+		assert.Len(t, res.Responses["C"].Frames, 1)
+	})
+
+	t.Run("a search missing from the multisearch response fails its own query", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		c.multiSearchResponse = hitsResponse
+		res, err := newQueryRequest(c, newQueries(rawDataQuery, rawDataQuery), &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, res.Responses, 2)
+		assert.NoError(t, res.Responses["A"].Error)
+		assert.Len(t, res.Responses["A"].Frames, 1)
+		assert.EqualError(t, res.Responses["B"].Error, "the search has no response")
+		assert.Equal(t, backend.ErrorSourceDownstream, res.Responses["B"].ErrorSource)
+	})
+
+	t.Run("a failed handler only fails its own queries", func(t *testing.T) {
+		response := backend.NewQueryDataResponse()
+		response.Responses["A"] = backend.DataResponse{Frames: data.Frames{data.NewFrame("a")}}
+		assert.Same(t, response, handlerResponse(response, nil, []string{"A"}))
+
+		failed := handlerResponse(nil, backend.PluginError(errors.New("parse failed")), []string{"B", "C"})
+		require.Len(t, failed.Responses, 2)
+		for _, refID := range []string{"B", "C"} {
+			assert.EqualError(t, failed.Responses[refID].Error, "parse failed")
+			assert.Equal(t, backend.ErrorSourcePlugin, failed.Responses[refID].ErrorSource)
+		}
+	})
+
+	t.Run("a failed PPL query does not abort the other PPL queries", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.3.0")
+		c.pplExecute = func(r *client.PPLRequest) (*client.PPLResponse, error) {
+			if strings.HasPrefix(r.Query, "source = broken") {
+				return &client.PPLResponse{Status: 400, Error: map[string]interface{}{"reason": "Invalid Query", "details": "index broken not found"}}, nil
+			}
+			return pplResponse(r)
+		}
+		res, err := newQueryRequest(c, newQueries(
+			pplQuery,
+			`{ "query": "source = broken", "queryType": "PPL", "format": "table" }`,
+			pplQuery,
+		), &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, res.Responses, 3)
+		assert.NoError(t, res.Responses["A"].Error)
+		assert.EqualError(t, res.Responses["B"].Error, "ExecutePPLQuery received unexpected status code 400: Invalid Query, index broken not found")
+		assert.Equal(t, backend.ErrorSourceDownstream, res.Responses["B"].ErrorSource)
+		assert.NoError(t, res.Responses["C"].Error)
+	})
+}
+
+func Test_async_search(t *testing.T) {
+	from := time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC)
+	to := time.Date(2018, 5, 15, 17, 55, 0, 0, time.UTC)
+	queries := []backend.DataQuery{
+		{RefID: "A", JSON: []byte(`{ "metrics": [{ "id": "1", "type": "raw_data" }] }`), TimeRange: backend.TimeRange{From: from, To: to}},
+		{RefID: "B", JSON: []byte(`{ "metrics": [{ "id": "1", "type": "raw_data" }], "index": "expired-*" }`), TimeRange: backend.TimeRange{From: from, To: to}},
+	}
+	asyncSettings := &backend.DataSourceInstanceSettings{JSONData: []byte(`{"asyncSearch": true}`)}
+	hits := &client.SearchResponseHits{Hits: []map[string]interface{}{{"_id": "1", "_source": map[string]interface{}{"message": "hello"}}}}
+
+	t.Run("sends every search asynchronously when enabled", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.asyncSearch = func(r *client.SearchRequest) (*client.SearchResponse, error) {
+			if r.IndexOverride == "expired-*" {
+				return nil, backend.DownstreamError(errors.New("search expired"))
+			}
+			return &client.SearchResponse{Hits: hits}, nil
+		}
+		res, err := newQueryRequest(c, queries, asyncSettings).execute(context.Background())
+		require.NoError(t, err)
+
+		assert.Empty(t, c.multisearchRequests)
+		assert.Len(t, c.asyncSearchRequests, 2)
+		require.Len(t, res.Responses, 2)
+		assert.NoError(t, res.Responses["A"].Error)
+		assert.Len(t, res.Responses["A"].Frames, 1)
+		assert.EqualError(t, res.Responses["B"].Error, "search expired")
+		assert.Equal(t, backend.ErrorSourceDownstream, res.Responses["B"].ErrorSource)
+	})
+
+	t.Run("falls back to a multisearch when not supported", func(t *testing.T) {
+		c := newFakeClient(client.Elasticsearch, "7.10.0")
+		c.multiSearchResponse = &client.MultiSearchResponse{Responses: []*client.SearchResponse{{Hits: hits}, {Hits: hits}}}
+		res, err := newQueryRequest(c, queries, asyncSettings).execute(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, c.multisearchRequests, 1)
+		assert.Len(t, c.multisearchRequests[0].Requests, 2)
+		assert.NoError(t, res.Responses["A"].Error)
+		assert.NoError(t, res.Responses["B"].Error)
+	})
+
+	t.Run("is not used unless enabled", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.asyncSearch = func(r *client.SearchRequest) (*client.SearchResponse, error) {
+			return &client.SearchResponse{Hits: hits}, nil
+		}
+		_, err := newQueryRequest(c, queries, &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		assert.Empty(t, c.asyncSearchRequests)
+		assert.Len(t, c.multisearchRequests, 1)
+	})
+}
+
+func Test_log_context_query(t *testing.T) {
+	from := time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC)
+	to := time.Date(2018, 5, 15, 17, 55, 0, 0, time.UTC)
+	newQuery := func(json string) []backend.DataQuery {
+		return []backend.DataQuery{{RefID: "A", JSON: []byte(json), TimeRange: backend.TimeRange{From: from, To: to}}}
+	}
+	hit := func(id string, ts int64) map[string]interface{} {
+		return map[string]interface{}{
+			"_id":     id,
+			"_index":  "logs-2018.05.15",
+			"_source": map[string]interface{}{"@timestamp": time.UnixMilli(ts).UTC().Format(time.RFC3339Nano), "message": id},
+			"sort":    []interface{}{float64(ts), id},
+		}
+	}
+	contextResponse := &client.MultiSearchResponse{Responses: []*client.SearchResponse{
+		// newer documents, oldest first
+		{Hits: &client.SearchResponseHits{Hits: []map[string]interface{}{hit("after-1", 1526406601001), hit("after-2", 1526406601002)}}},
+		// older documents, newest first
+		{Hits: &client.SearchResponseHits{Hits: []map[string]interface{}{hit("before-1", 1526406600999)}}},
+	}}
+
+	t.Run("searches before and after a Lucene logs row in its index", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.multiSearchResponse = contextResponse
+		res, err := newQueryRequest(c, newQuery(`{
+			"query": "level:error",
+			"metrics": [{ "id": "1", "type": "logs" }],
+			"logContext": { "timestamp": 1526406601000, "id": "row", "sort": [1526406601000, 4], "index": "logs-2018.05.15", "limit": 2 }
+		}`), &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, c.multisearchRequests, 1)
+		searches := c.multisearchRequests[0].Requests
+		require.Len(t, searches, 2)
+		for i, order := range []string{"asc", "desc"} {
+			assert.Equal(t, "logs-2018.05.15", searches[i].IndexOverride)
+			assert.Equal(t, 2, searches[i].Size)
+			assert.Equal(t, []interface{}{json.Number("1526406601000"), "row"}, searches[i].SearchAfter)
+			assert.Equal(t, []map[string]map[string]string{
+				{"@timestamp": {"order": order, "unmapped_type": "boolean"}},
+				{"_id": {"order": order}},
+			}, searches[i].Sort)
+		}
+
+		require.NoError(t, res.Responses["A"].Error)
+		require.Len(t, res.Responses["A"].Frames, 1)
+		frame := res.Responses["A"].Frames[0]
+		assert.Equal(t, "A", frame.RefID)
+		assert.Equal(t, data.VisTypeLogs, string(frame.Meta.PreferredVisualization))
+		idField, _ := frame.FieldByName("_id")
+		require.NotNil(t, idField)
+		ids := make([]string, 0, idField.Len())
+		for i := 0; i < idField.Len(); i++ {
+			ids = append(ids, *idField.At(i).(*string))
+		}
+		assert.Equal(t, []string{"after-2", "after-1", "before-1"}, ids)
+	})
+
+	t.Run("serves PPL logs queries with a single direction", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.multiSearchResponse = &client.MultiSearchResponse{Responses: contextResponse.Responses[1:]}
+		res, err := newQueryRequest(c, newQuery(`{
+			"query": "source = logs",
+			"queryType": "PPL",
+			"format": "logs",
+			"logContext": { "timestamp": 1526406601000, "direction": "BACKWARD" }
+		}`), &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		assert.Empty(t, c.pplRequest)
+		require.Len(t, c.multisearchRequests, 1)
+		search := c.multisearchRequests[0].Requests[0]
+		assert.Equal(t, defaultLogContextLimit, search.Size)
+		// without an ID the row is only located by its timestamp
+		assert.Equal(t, []interface{}{int64(1526406601000)}, search.SearchAfter)
+		assert.Equal(t, []map[string]map[string]string{{"@timestamp": {"order": "desc", "unmapped_type": "boolean"}}}, search.Sort)
+		require.NoError(t, res.Responses["A"].Error)
+		assert.Equal(t, 1, res.Responses["A"].Frames[0].Rows())
+	})
+
+	t.Run("PPL rows are not returned as their own context", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.multiSearchResponse = contextResponse
+		_, err := newQueryRequest(c, newQuery(`{
+			"query": "source = logs",
+			"queryType": "PPL",
+			"format": "logs",
+			"logContext": { "timestamp": 1526406601000 }
+		}`), &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, c.multisearchRequests, 1)
+		for i, order := range []string{"asc", "desc"} {
+			search := c.multisearchRequests[0].Requests[i]
+			// the search starts after every document with the row's timestamp
+			assert.Equal(t, []interface{}{int64(1526406601000)}, search.SearchAfter)
+			assert.Equal(t, []map[string]map[string]string{{"@timestamp": {"order": order, "unmapped_type": "boolean"}}}, search.Sort)
+		}
+	})
+
+	t.Run("types the documents by the mapping of the row's index", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.fieldTypes = map[string][]string{"message": {"keyword"}, "code": {"long"}}
+		c.multiSearchResponse = &client.MultiSearchResponse{Responses: []*client.SearchResponse{
+			{Hits: &client.SearchResponseHits{Hits: []map[string]interface{}{{
+				"_id":     "after-1",
+				"_source": map[string]interface{}{"@timestamp": "2018-05-15T17:50:01.001Z", "message": "after", "code": "500"},
+				"sort":    []interface{}{float64(1526406601001), "after-1"},
+			}}}},
+			{Hits: &client.SearchResponseHits{Hits: []map[string]interface{}{}}},
+		}}
+		res, err := newQueryRequest(c, newQuery(`{
+			"metrics": [{ "id": "1", "type": "logs" }],
+			"logContext": { "timestamp": 1526406601000, "id": "row", "index": "context-mapping-2018.05.15" }
+		}`), &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"context-mapping-2018.05.15"}, c.fieldTypesIndices)
+		require.NoError(t, res.Responses["A"].Error)
+		code, _ := res.Responses["A"].Frames[0].FieldByName("code")
+		require.NotNil(t, code)
+		assert.Equal(t, data.FieldTypeNullableFloat64, code.Type())
+	})
+
+	t.Run("rejects queries that are not logs queries", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		res, err := newQueryRequest(c, newQuery(`{
+			"queryType": "PPL",
+			"format": "table",
+			"logContext": { "timestamp": 1526406601000 }
+		}`), &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		assert.EqualError(t, res.Responses["A"].Error, "log context is only supported for Lucene and PPL logs queries")
+		assert.Empty(t, c.multisearchRequests)
+	})
+}
+
+func Test_logs_volume_query(t *testing.T) {
+	from := time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC)
+	to := time.Date(2018, 5, 15, 17, 55, 0, 0, time.UTC)
+	newQuery := func(json string) []backend.DataQuery {
+		return []backend.DataQuery{{RefID: "A", JSON: []byte(json), TimeRange: backend.TimeRange{From: from, To: to}, Interval: time.Minute}}
+	}
+	assertVolume := func(t *testing.T, frames data.Frames, expected map[string][]float64) {
+		t.Helper()
+		require.Len(t, frames, len(expected))
+		for _, frame := range frames {
+			require.Len(t, frame.Fields, 2)
+			level := frame.Fields[1].Labels["level"]
+			assert.Equal(t, level, frame.Fields[1].Config.DisplayNameFromDS)
+			assert.Equal(t, data.FrameTypeTimeSeriesMulti, frame.Meta.Type)
+			custom := frame.Meta.Custom.(map[string]interface{})
+			assert.Equal(t, "FullRange", custom["logsVolumeType"])
+			assert.Equal(t, map[string]int64{"from": from.UnixMilli(), "to": to.UnixMilli()}, custom["absoluteRange"])
+			values := make([]float64, frame.Rows())
+			for i := range values {
+				values[i] = frame.Fields[1].At(i).(float64)
+			}
+			assert.Equal(t, expected[level], values, level)
+		}
+	}
+
+	t.Run("Lucene counts documents per interval split by normalized level", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.multiSearchResponse = &client.MultiSearchResponse{Responses: []*client.SearchResponse{{Aggregations: map[string]interface{}{
+			"1": map[string]interface{}{"buckets": []interface{}{
+				map[string]interface{}{"key": float64(from.UnixMilli()), "doc_count": float64(6), "2": map[string]interface{}{"buckets": []interface{}{
+					map[string]interface{}{"key": "WARN", "doc_count": float64(2)},
+					map[string]interface{}{"key": "warning", "doc_count": float64(1)},
+					map[string]interface{}{"key": "error", "doc_count": float64(3)},
+				}}},
+				map[string]interface{}{"key": float64(from.Add(time.Minute).UnixMilli()), "doc_count": float64(0), "2": map[string]interface{}{"buckets": []interface{}{}}},
+				map[string]interface{}{"key": float64(from.Add(2 * time.Minute).UnixMilli()), "doc_count": float64(4), "2": map[string]interface{}{"buckets": []interface{}{
+					map[string]interface{}{"key": "unknown", "doc_count": float64(4)},
+				}}},
+			}},
+		}}}}
+		c.logLevelField = "level"
+		res, err := newQueryRequest(c, newQuery(`{ "query": "service:api", "luceneQueryType": "LogsVolume", "metrics": [{ "id": "1", "type": "logs" }] }`), &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, c.multisearchRequests, 1)
+		search := c.multisearchRequests[0].Requests[0]
+		assert.Equal(t, 0, search.Size)
+		histogram := search.Aggs[0]
+		assert.Equal(t, "date_histogram", histogram.Aggregation.Type)
+		levels := histogram.Aggregation.Aggs[0].Aggregation.Aggregation.(*client.TermsAggregation)
+		assert.Equal(t, "level", levels.Field)
+		assert.Equal(t, "unknown", *levels.Missing)
+
+		require.NoError(t, res.Responses["A"].Error)
+		assertVolume(t, res.Responses["A"].Frames, map[string][]float64{
+			"error":   {3, 0, 0},
+			"unknown": {0, 0, 4},
+			"warning": {3, 0, 0},
+		})
+	})
+
+	t.Run("PPL counts documents per span split by normalized level", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.logLevelField = "severity"
+		c.pplResponse = &client.PPLResponse{
+			Schema: []client.FieldSchema{{Name: "count()", Type: "integer"}, {Name: "span(`@timestamp`,15s)", Type: "timestamp"}, {Name: "severity", Type: "string"}},
+			Datarows: []client.Datarow{
+				{float64(2), "2018-05-15 17:50:00", "ERROR"},
+				{float64(5), "2018-05-15 17:51:00", "info"},
+			},
+		}
+		res, err := newQueryRequest(c, newQuery(`{ "query": "source = logs", "queryType": "PPL", "format": "logs_volume" }`), &backend.DataSourceInstanceSettings{}).execute(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, c.pplRequest, 1)
+		assert.Equal(t, "source = logs | where `@timestamp` >= timestamp('2018-05-15 17:50:00') and `@timestamp` <= timestamp('2018-05-15 17:55:00') | stats count() by span(`@timestamp`, 15s), `severity`", c.pplRequest[0].Query)
+		require.NoError(t, res.Responses["A"].Error)
+		assertVolume(t, res.Responses["A"].Frames, map[string][]float64{
+			"error": {2, 0},
+			"info":  {0, 5},
+		})
+	})
+}
+
+func Test_composite_aggregation(t *testing.T) {
+	from := time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC)
+	to := time.Date(2018, 5, 15, 17, 55, 0, 0, time.UTC)
+	page := func(afterKey map[string]interface{}, buckets ...interface{}) *client.MultiSearchResponse {
+		agg := map[string]interface{}{"buckets": buckets}
+		if afterKey != nil {
+			agg["after_key"] = afterKey
+		}
+		return &client.MultiSearchResponse{Responses: []*client.SearchResponse{{Aggregations: map[string]interface{}{"2": agg}}}}
+	}
+	bucket := func(user string, ts int64, count float64) map[string]interface{} {
+		return map[string]interface{}{
+			"key":       map[string]interface{}{"user.id": user, "@timestamp": float64(ts)},
+			"doc_count": count,
+			"1":         map[string]interface{}{"value": count * 10},
+		}
+	}
+	query := `{
+		"bucketAggs": [{
+			"id": "2",
+			"type": "composite",
+			"settings": {
+				"size": 2,
+				"limit": %d,
+				"sources": [
+					{ "type": "date_histogram", "field": "@timestamp", "interval": "1m" },
+					{ "type": "terms", "field": "user.id" }
+				]
+			}
+		}],
+		"metrics": [{ "type": "count", "id": "3" }, { "type": "sum", "field": "bytes", "id": "1" }]
+	}`
+
+	t.Run("follows after_key until the buckets are exhausted", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		pages := []*client.MultiSearchResponse{
+			page(map[string]interface{}{"@timestamp": 1000.0, "user.id": "b"}, bucket("a", 1000, 1), bucket("b", 1000, 2)),
+			page(map[string]interface{}{"@timestamp": 2000.0, "user.id": "b"}, bucket("a", 2000, 3), bucket("b", 2000, 4)),
+			page(nil),
+		}
+		var afters []map[string]interface{}
+		c.multiSearchExecute = func(r *client.MultiSearchRequest) (*client.MultiSearchResponse, error) {
+			composite := r.Requests[0].Aggs[0].Aggregation.Aggregation.(*client.CompositeAggregation)
+			afters = append(afters, composite.After)
+			res := pages[0]
+			pages = pages[1:]
+			return res, nil
+		}
+
+		res, err := executeTsdbQuery(c, fmt.Sprintf(query, 0), from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		require.Len(t, c.multisearchRequests, 3)
+		assert.Equal(t, []map[string]interface{}{nil, {"@timestamp": 1000.0, "user.id": "b"}, {"@timestamp": 2000.0, "user.id": "b"}}, afters)
+		composite := c.multisearchRequests[0].Requests[0].Aggs[0].Aggregation.Aggregation.(*client.CompositeAggregation)
+		assert.Equal(t, 2, composite.Size)
+		require.Len(t, composite.Sources, 2)
+		assert.Equal(t, "1m", composite.Sources[0].FixedInterval)
+		assert.Equal(t, "user.id", composite.Sources[1].Field)
+
+		// the frames are the same as for a terms aggregation with a date histogram
+		frames := res.Responses["A"].Frames
+		require.Len(t, frames, 4)
+		names := make([]string, 0, len(frames))
+		for _, frame := range frames {
+			names = append(names, frame.Fields[1].Config.DisplayNameFromDS)
+		}
+		assert.Equal(t, []string{"a Count", "a Sum bytes", "b Count", "b Sum bytes"}, names)
+		require.Equal(t, 2, frames[3].Rows())
+		assert.EqualValues(t, 20, *frames[3].Fields[1].At(0).(*float64))
+		assert.EqualValues(t, 40, *frames[3].Fields[1].At(1).(*float64))
+	})
+
+	t.Run("stops at the limit", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.multiSearchResponses = []*client.MultiSearchResponse{
+			page(map[string]interface{}{"@timestamp": 1000.0, "user.id": "b"}, bucket("a", 1000, 1), bucket("b", 1000, 2)),
+			page(map[string]interface{}{"@timestamp": 2000.0, "user.id": "b"}, bucket("a", 2000, 3), bucket("b", 2000, 4)),
+		}
+
+		res, err := executeTsdbQuery(c, fmt.Sprintf(query, 3), from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		require.Len(t, c.multisearchRequests, 2)
+		frames := res.Responses["A"].Frames
+		require.Len(t, frames, 4)
+		assert.Equal(t, 2, frames[0].Rows())
+		assert.Equal(t, 1, frames[2].Rows())
+		// the buckets past the limit are left out with a warning
+		for _, frame := range frames {
+			require.NotNil(t, frame.Meta)
+			assert.Equal(t, []data.Notice{{Severity: data.NoticeSeverityWarning, Text: "Showing the first 3 buckets, the composite aggregation has more than its limit"}}, frame.Meta.Notices)
+		}
+	})
+
+	t.Run("reaching the last bucket at the limit has no warning", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.multiSearchResponses = []*client.MultiSearchResponse{
+			page(nil, bucket("a", 1000, 1), bucket("b", 1000, 2)),
+		}
+
+		res, err := executeTsdbQuery(c, fmt.Sprintf(query, 2), from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		for _, frame := range res.Responses["A"].Frames {
+			if frame.Meta != nil {
+				assert.Empty(t, frame.Meta.Notices)
+			}
+		}
+	})
+
+	t.Run("a missing, invalid or non-positive size is the default size", func(t *testing.T) {
+		for _, size := range []interface{}{nil, "", "many", 0, "0", -1, "-5"} {
+			settings := map[string]interface{}{}
+			if size != nil {
+				settings["size"] = size
+			}
+			bucketAgg := &BucketAgg{Type: compositeType, Settings: utils.NewJsonFromAny(settings)}
+			assert.Equal(t, defaultCompositeSize, compositeSize(bucketAgg), "size %v", size)
+		}
+		assert.Equal(t, 5, compositeSize(&BucketAgg{Type: compositeType, Settings: utils.NewJsonFromAny(map[string]interface{}{"size": 5})}))
+	})
+
+	t.Run("a missing, invalid or non-positive limit is the default limit", func(t *testing.T) {
+		for _, limit := range []interface{}{nil, "", "many", 0, "0", -1, "-5"} {
+			settings := map[string]interface{}{}
+			if limit != nil {
+				settings["limit"] = limit
+			}
+			bucketAgg := &BucketAgg{Type: compositeType, Settings: utils.NewJsonFromAny(settings)}
+			assert.Equal(t, defaultCompositeLimit, compositeLimit(bucketAgg), "limit %v", limit)
+		}
+		assert.Equal(t, 3, compositeLimit(&BucketAgg{Type: compositeType, Settings: utils.NewJsonFromAny(map[string]interface{}{"limit": "3"})}))
+	})
+
+	t.Run("in a table", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		c.multiSearchResponse = page(nil, map[string]interface{}{
+			"key":       map[string]interface{}{"user.id": "a", "bytes": 1000.0},
+			"doc_count": 5.0,
+		}, map[string]interface{}{
+			"key":       map[string]interface{}{"user.id": nil, "bytes": 2000.0},
+			"doc_count": 1.0,
+		})
+
+		res, err := executeTsdbQuery(c, `{
+			"bucketAggs": [{
+				"id": "2",
+				"type": "composite",
+				"settings": { "sources": [
+					{ "type": "terms", "field": "user.id", "missingBucket": true },
+					{ "type": "histogram", "field": "bytes", "interval": 1000 }
+				] }
+			}],
+			"metrics": [{ "type": "count", "id": "1" }]
+		}`, from, to, 15*time.Second)
+		require.NoError(t, err)
+
+		composite := c.multisearchRequests[0].Requests[0].Aggs[0].Aggregation.Aggregation.(*client.CompositeAggregation)
+		assert.Equal(t, defaultCompositeSize, composite.Size)
+		assert.True(t, composite.Sources[0].MissingBucket)
+		assert.Equal(t, 1000.0, composite.Sources[1].Interval)
+
+		require.Len(t, res.Responses["A"].Frames, 1)
+		frame := res.Responses["A"].Frames[0]
+		require.Len(t, frame.Fields, 3)
+		assert.Equal(t, "user.id", frame.Fields[0].Name)
+		assert.Equal(t, "", *frame.Fields[0].At(1).(*string))
+		assert.Equal(t, "bytes", frame.Fields[1].Name)
+		assert.EqualValues(t, 2000, *frame.Fields[1].At(1).(*float64))
+		assert.EqualValues(t, 1, *frame.Fields[2].At(1).(*float64))
+	})
+
+	t.Run("can't be combined with other bucket aggregations", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		res, err := executeTsdbQuery(c, `{
+			"bucketAggs": [
+				{ "id": "2", "type": "composite", "settings": { "sources": [{ "type": "terms", "field": "user.id" }] } },
+				{ "id": "3", "type": "date_histogram", "field": "@timestamp" }
+			],
+			"metrics": [{ "type": "count", "id": "1" }]
+		}`, from, to, 15*time.Second)
+		require.NoError(t, err)
+		assert.ErrorContains(t, res.Responses["A"].Error, "can't be combined")
+		assert.Empty(t, c.multisearchRequests)
+	})
+
+	t.Run("can't be used with sibling pipeline aggregations", func(t *testing.T) {
+		c := newFakeClient(client.OpenSearch, "2.11.0")
+		res, err := executeTsdbQuery(c, `{
+			"bucketAggs": [{ "id": "2", "type": "composite", "settings": { "sources": [{ "type": "terms", "field": "user.id" }] } }],
+			"metrics": [{ "type": "count", "id": "1" }, { "type": "avg_bucket", "field": "1", "id": "3" }]
+		}`, from, to, 15*time.Second)
+		require.NoError(t, err)
+		assert.ErrorContains(t, res.Responses["A"].Error, "sibling pipeline aggregation avg_bucket can't be used with a composite aggregation")
+		assert.True(t, backend.IsDownstreamError(res.Responses["A"].Error))
+		assert.Empty(t, c.multisearchRequests)
+	})
+}
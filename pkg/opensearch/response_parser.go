@@ -18,23 +18,42 @@ import (
 )
 
 const (
-	luceneQueryTypeTraces = "Traces"
+	luceneQueryTypeTraces      = "Traces"
+	luceneQueryTypeAnnotations = "Annotations"
+	luceneQueryTypeLogsVolume  = "LogsVolume"
 	// Metric types
 	countType         = "count"
 	percentilesType   = "percentiles"
 	extendedStatsType = "extended_stats"
+	statsType         = "stats"
+	// percentileRanksType is the percentage of values below each of the values of
+	// its "values" setting, the inverse of percentiles
+	percentileRanksType = "percentile_ranks"
+	topMetricsType      = "top_metrics"
 	// Bucket types
 	dateHistType    = "date_histogram"
 	histogramType   = "histogram"
 	filtersType     = "filters"
 	termsType       = "terms"
+	multiTermsType  = "multi_terms"
 	geohashGridType = "geohash_grid"
-	logsType        = "logs"
-	tableType       = "table"
-	timeSeriesType  = "time_series"
-	rawDataType     = "raw_data"
-	rawDocumentType = "raw_document"
-	descending      = "desc"
+	rangeType       = "range"
+	dateRangeType   = "date_range"
+	ipRangeType     = "ip_range"
+	// nestedType and reverseNestedType are single bucket aggregations, which the
+	// response parser steps through without adding a property
+	nestedType        = "nested"
+	reverseNestedType = "reverse_nested"
+	compositeType     = "composite"
+	logsType          = "logs"
+	annotationsType   = "annotations"
+	logsVolumeType    = "logs_volume"
+	tableType         = "table"
+	timeSeriesType    = "time_series"
+	rawDataType       = "raw_data"
+	rawDocumentType   = "raw_document"
+	descending        = "desc"
+	ascending         = "asc"
 	// maxFlattenDepth represents the maximum depth of a multi-level object which will be joined using dot notation to
 	// a single level objects by the flatten function.
 	// On frontend maxDepth wasn't used but as we are processing on backend let's put a limit to avoid infinite loop.
@@ -93,6 +112,10 @@ func (rp *responseParser) parseResponse() (*backend.QueryDataResponse, error) {
 		var queryType string
 		if target.luceneQueryType == luceneQueryTypeTraces {
 			queryType = luceneQueryTypeTraces
+		} else if target.annotation != nil {
+			queryType = annotationsType
+		} else if target.logsVolume {
+			queryType = logsVolumeType
 		} else {
 			queryType = target.Metrics[0].Type
 		}
@@ -110,7 +133,8 @@ func (rp *responseParser) parseResponse() (*backend.QueryDataResponse, error) {
 			errResp.Frames = []*data.Frame{
 				{
 					Meta: &data.FrameMeta{
-						Custom: debugInfo,
+						Custom:              debugInfo,
+						ExecutedQueryString: res.ExecutedRequest,
 					},
 				}}
 			result.Responses[target.RefID] = errResp
@@ -124,11 +148,15 @@ func (rp *responseParser) parseResponse() (*backend.QueryDataResponse, error) {
 
 		switch queryType {
 		case rawDataType:
-			queryRes = processRawDataResponse(res, rp.ConfiguredFields, queryRes)
+			queryRes = processRawDataResponse(res, rp.ConfiguredFields, target.fieldTypes, queryRes)
 		case rawDocumentType:
 			queryRes = processRawDocumentResponse(res, target.RefID, queryRes)
 		case logsType:
-			queryRes = processLogsResponse(res, rp.ConfiguredFields, queryRes)
+			queryRes = processLogsResponse(res, rp.ConfiguredFields, target.fieldTypes, queryRes)
+		case annotationsType:
+			queryRes = processAnnotationsResponse(res, target, rp.ConfiguredFields, queryRes)
+		case logsVolumeType:
+			queryRes = processLogsVolumeResponse(res, target, rp.ConfiguredFields, queryRes)
 		case luceneQueryTypeTraces:
 			switch target.serviceMapInfo.Type {
 			case Prefetch:
@@ -143,31 +171,32 @@ func (rp *responseParser) parseResponse() (*backend.QueryDataResponse, error) {
 				nodeGraphTargetRefId = target.RefID
 			case Not:
 				if strings.HasPrefix(target.RawQuery, "traceId:") {
-					queryRes = processTraceSpansResponse(res, queryRes)
+					queryRes = processTraceSpansResponse(res, target.fieldTypes, queryRes)
 				} else {
 					queryRes = processTraceListResponse(res, rp.DSSettings.UID, rp.DSSettings.Name, queryRes)
 				}
 			default:
-				return &backend.QueryDataResponse{
-					Responses: backend.Responses{
-						target.RefID: backend.ErrorResponseWithErrorSource(backend.PluginError(fmt.Errorf("unrecognized service map query type: %d", target.serviceMapInfo.Type))),
-					},
-				}, nil
+				result.Responses[target.RefID] = backend.ErrorResponseWithErrorSource(backend.PluginError(fmt.Errorf("unrecognized service map query type: %d", target.serviceMapInfo.Type)))
+				continue
 			}
 		default:
 			props := make(map[string]string)
-			err := rp.processBuckets(res.Aggregations, target, &queryRes, props, 0)
+			aggregations, expanded := expandCompositeAgg(res.Aggregations, target)
+			aggregations, expanded = expandMultiTermsAggs(aggregations, expanded)
+			err := rp.processBuckets(aggregations, expanded, &queryRes, props, 0)
 			if err != nil {
-				return &backend.QueryDataResponse{
-					Responses: backend.Responses{
-						target.RefID: backend.ErrorResponseWithErrorSource(backend.PluginError(err)),
-					},
-				}, nil
+				result.Responses[target.RefID] = backend.ErrorResponseWithErrorSource(backend.PluginError(err))
+				continue
 			}
-			rp.nameFields(&queryRes.Frames, target)
-			rp.trimDatapoints(&queryRes.Frames, target)
+			rp.nameFields(&queryRes.Frames, expanded)
+			rp.trimDatapoints(&queryRes.Frames, expanded)
+			queryRes.Frames = append(queryRes.Frames, rp.processSiblingPipelines(res.Aggregations, target, props)...)
 		}
 
+		documents := queryType == rawDataType || queryType == rawDocumentType || queryType == logsType
+		queryRes.Frames = addNotices(queryRes.Frames, append(searchResponseNotices(res, documents), target.notices...))
+		addQueryMeta(queryRes.Frames, res.ExecutedRequest, searchResponseStats(res))
+
 		result.Responses[target.RefID] = queryRes
 	}
 
@@ -191,7 +220,7 @@ func processPrefetchResponse(res *client.SearchResponse, queryRes backend.DataRe
 	return queryRes
 }
 
-func processTraceSpansResponse(res *client.SearchResponse, queryRes backend.DataResponse) backend.DataResponse {
+func processTraceSpansResponse(res *client.SearchResponse, mapping fieldMapping, queryRes backend.DataResponse) backend.DataResponse {
 	propNames := make(map[string]bool)
 	docs := make([]map[string]interface{}, len(res.Hits.Hits))
 
@@ -318,7 +347,9 @@ func processTraceSpansResponse(res *client.SearchResponse, queryRes backend.Data
 
 	sortedPropNames := sortPropNames(propNames, []string{})
 
-	fields := processDocsToDataFrameFields(docs, sortedPropNames, false)
+	// The span fields the trace view needs are remapped above and keep the types they were remapped to
+	mapping = mapping.without("startTime", "duration", "parentSpanID", "spanID", "operationName", "serviceTags", "traceID", "tags", "logs", "stackTraces")
+	fields := processDocsToDataFrameFields(docs, sortedPropNames, mapping, false)
 
 	frame := data.NewFrame("", fields...)
 	if frame.Meta == nil {
@@ -483,16 +514,21 @@ func processTraceListResponse(res *client.SearchResponse, dsUID string, dsName s
 	return queryRes
 }
 
-func processLogsResponse(res *client.SearchResponse, configuredFields client.ConfiguredFields, queryRes backend.DataResponse) backend.DataResponse {
+func processLogsResponse(res *client.SearchResponse, configuredFields client.ConfiguredFields, mapping fieldMapping, queryRes backend.DataResponse) backend.DataResponse {
 	propNames := make(map[string]bool)
 	docs := make([]map[string]interface{}, len(res.Hits.Hits))
+	searchWords := make(map[string]bool)
+	// sortValues are the sort values of every row, kept in the frame metadata rather
+	// than in a column of the logs
+	var sortValues []interface{}
 
 	for hitIdx, hit := range res.Hits.Hits {
-		var flattened map[string]interface{}
+		// The flattened source is the document, so that its values aren't copied again
+		doc := make(map[string]interface{})
 		var sourceString string
 		if hit["_source"] != nil {
-			flattened = flatten(hit["_source"].(map[string]interface{}), maxFlattenDepth)
-			sourceMarshalled, err := json.Marshal(flattened)
+			doc = flatten(hit["_source"].(map[string]interface{}), maxFlattenDepth)
+			sourceMarshalled, err := json.Marshal(doc)
 			if err != nil {
 				errResp := backend.ErrorResponseWithErrorSource(backend.PluginError(err))
 				return errResp
@@ -500,20 +536,30 @@ func processLogsResponse(res *client.SearchResponse, configuredFields client.Con
 			sourceString = string(sourceMarshalled)
 		}
 
-		doc := map[string]interface{}{
-			"_id":    hit["_id"],
-			"_type":  hit["_type"],
-			"_index": hit["_index"],
-			// In case of logs query we want to have the raw source as a string field so it can be visualized in logs panel
-			"_source": sourceString,
+		if configuredFields.LogLevelField != "" {
+			if level, ok := doc[configuredFields.LogLevelField]; ok {
+				delete(doc, configuredFields.LogLevelField)
+				doc["level"] = level
+			}
 		}
 
-		for k, v := range flattened {
-			if configuredFields.LogLevelField != "" && k == configuredFields.LogLevelField {
-				doc["level"] = v
-			} else {
-				doc[k] = v
+		doc["_id"] = hit["_id"]
+		doc["_type"] = hit["_type"]
+		doc["_index"] = hit["_index"]
+		// In case of logs query we want to have the raw source as a string field so it can be visualized in logs panel
+		doc["_source"] = sourceString
+		// the sort values locate the document for log context queries
+		if values, ok := hit["sort"]; ok {
+			if sortValues == nil {
+				sortValues = make([]interface{}, len(res.Hits.Hits))
 			}
+			sortValues[hitIdx] = values
+		}
+		// the highlighted values of the document are kept next to it, and the terms
+		// they highlight are the search words of the frame
+		if highlight, ok := hit["highlight"].(map[string]interface{}); ok {
+			doc["highlight"] = highlight
+			highlightedWords(highlight, searchWords)
 		}
 
 		if hit["fields"] != nil {
@@ -537,7 +583,7 @@ func processLogsResponse(res *client.SearchResponse, configuredFields client.Con
 	}
 
 	sortedPropNames := sortPropNames(propNames, []string{configuredFields.TimeField, configuredFields.LogMessageField})
-	fields := processDocsToDataFrameFields(docs, sortedPropNames, true)
+	fields := processDocsToDataFrameFields(docs, sortedPropNames, mapping, true)
 
 	frame := data.NewFrame("", fields...)
 
@@ -551,12 +597,20 @@ func processLogsResponse(res *client.SearchResponse, configuredFields client.Con
 	}
 	frame.Meta.PreferredVisualization = data.VisTypeLogs
 
-	if totalHits > 0 {
+	if totalHits > 0 || len(searchWords) > 0 || sortValues != nil {
 		if frame.Meta.Custom == nil {
 			frame.Meta.Custom = make(map[string]interface{})
 		}
 		if customMeta, ok := frame.Meta.Custom.(map[string]interface{}); ok {
-			customMeta["total"] = totalHits
+			if totalHits > 0 {
+				customMeta["total"] = totalHits
+			}
+			if len(searchWords) > 0 {
+				customMeta["searchWords"] = sortedSearchWords(searchWords)
+			}
+			if sortValues != nil {
+				customMeta["sort"] = sortValues
+			}
 		}
 	}
 
@@ -564,24 +618,18 @@ func processLogsResponse(res *client.SearchResponse, configuredFields client.Con
 	return queryRes
 }
 
-func processRawDataResponse(res *client.SearchResponse, configuredFields client.ConfiguredFields, queryRes backend.DataResponse) backend.DataResponse {
+func processRawDataResponse(res *client.SearchResponse, configuredFields client.ConfiguredFields, mapping fieldMapping, queryRes backend.DataResponse) backend.DataResponse {
 	propNames := make(map[string]bool)
 	documents := make([]map[string]interface{}, len(res.Hits.Hits))
 	for hitIdx, hit := range res.Hits.Hits {
-		doc := map[string]interface{}{
-			"_id":    hit["_id"],
-			"_type":  hit["_type"],
-			"_index": hit["_index"],
-		}
-
-		if hit["_source"] != nil {
-			source, ok := hit["_source"].(map[string]interface{})
-			if ok {
-				for k, v := range flatten(source, maxFlattenDepth) {
-					doc[k] = v
-				}
-			}
+		// The flattened source is the document, so that its values aren't copied again
+		doc := make(map[string]interface{})
+		if source, ok := hit["_source"].(map[string]interface{}); ok {
+			doc = flatten(source, maxFlattenDepth)
 		}
+		doc["_id"] = hit["_id"]
+		doc["_type"] = hit["_type"]
+		doc["_index"] = hit["_index"]
 
 		if timestamp, ok := getTimestamp(hit, configuredFields.TimeField); ok {
 			doc[configuredFields.TimeField] = timestamp
@@ -595,7 +643,7 @@ func processRawDataResponse(res *client.SearchResponse, configuredFields client.
 	}
 
 	sortedPropNames := sortPropNames(propNames, []string{configuredFields.TimeField})
-	fields := processDocsToDataFrameFields(documents, sortedPropNames, true)
+	fields := processDocsToDataFrameFields(documents, sortedPropNames, mapping, true)
 
 	queryRes.Frames = data.Frames{data.NewFrame("", fields...)}
 	return queryRes
@@ -620,6 +668,31 @@ func sortPropNames(propNames map[string]bool, fieldsToGoInFront []string) []stri
 }
 
 func processRawDocumentResponse(res *client.SearchResponse, refID string, queryRes backend.DataResponse) backend.DataResponse {
+	documents := rawDocuments(res)
+
+	fieldVector := make([]*json.RawMessage, len(res.Hits.Hits))
+	for i, doc := range documents {
+		bytes, err := json.Marshal(doc)
+		if err != nil {
+			// We skip docs that can't be marshalled
+			// should not happen
+			continue
+		}
+		value := json.RawMessage(bytes)
+		fieldVector[i] = &value
+	}
+
+	isFilterable := true
+	field := data.NewField(refID, nil, fieldVector)
+	field.Config = &data.FieldConfig{Filterable: &isFilterable}
+
+	queryRes.Frames = data.Frames{data.NewFrame(refID, field)}
+	return queryRes
+}
+
+// rawDocuments merges the _source and fields of each hit into a single document,
+// along with the hit's metadata
+func rawDocuments(res *client.SearchResponse) []map[string]interface{} {
 	documents := make([]map[string]interface{}, len(res.Hits.Hits))
 	for hitIdx, hit := range res.Hits.Hits {
 		doc := map[string]interface{}{
@@ -648,24 +721,12 @@ func processRawDocumentResponse(res *client.SearchResponse, refID string, queryR
 
 		documents[hitIdx] = doc
 	}
+	return documents
+}
 
-	fieldVector := make([]*json.RawMessage, len(res.Hits.Hits))
-	for i, doc := range documents {
-		bytes, err := json.Marshal(doc)
-		if err != nil {
-			// We skip docs that can't be marshalled
-			// should not happen
-			continue
-		}
-		value := json.RawMessage(bytes)
-		fieldVector[i] = &value
-	}
-
-	isFilterable := true
-	field := data.NewField(refID, nil, fieldVector)
-	field.Config = &data.FieldConfig{Filterable: &isFilterable}
-
-	queryRes.Frames = data.Frames{data.NewFrame(refID, field)}
+func processAnnotationsResponse(res *client.SearchResponse, target *Query, configuredFields client.ConfiguredFields, queryRes backend.DataResponse) backend.DataResponse {
+	documents := rawDocuments(res)
+	queryRes.Frames = data.Frames{newAnnotationsFrame(documents, target.annotation, configuredFields.TimeField)}
 	return queryRes
 }
 
@@ -718,7 +779,7 @@ func lookForTimeFieldInSource(hit map[string]interface{}, timeField string) (tim
 }
 
 func flatten(target map[string]interface{}, maxDepth int) map[string]interface{} {
-	output := make(map[string]interface{})
+	output := make(map[string]interface{}, len(target))
 	step(0, maxDepth, target, "", output)
 	return output
 }
@@ -726,7 +787,11 @@ func flatten(target map[string]interface{}, maxDepth int) map[string]interface{}
 func step(currentDepth, maxDepth int, target map[string]interface{}, prev string, output map[string]interface{}) {
 	nextDepth := currentDepth + 1
 	for key, value := range target {
-		newKey := strings.Trim(prev+"."+key, ".")
+		// top level keys are trimmed without building a new one for every key of every document
+		newKey := strings.Trim(key, ".")
+		if prev != "" {
+			newKey = strings.Trim(prev+"."+key, ".")
+		}
 
 		v, ok := value.(map[string]interface{})
 		if ok && len(v) > 0 && currentDepth < maxDepth {
@@ -737,9 +802,25 @@ func step(currentDepth, maxDepth int, target map[string]interface{}, prev string
 	}
 }
 
-func processDocsToDataFrameFields(docs []map[string]interface{}, propNames []string, isFilterable bool) []*data.Field {
+// processDocsToDataFrameFields returns a column for every property of the documents.
+// Properties of fields in the mapping are typed by it, others by their first value.
+func processDocsToDataFrameFields(docs []map[string]interface{}, propNames []string, mapping fieldMapping, isFilterable bool) []*data.Field {
 	allFields := make([]*data.Field, 0, len(propNames))
+	geoPoints := make(map[string]bool)
 	for _, propName := range propNames {
+		if geoPoint, ok := mapping.geoPointOf(propName); ok {
+			// A point and its flattened latitude and longitude are the same two columns
+			if !geoPoints[geoPoint] {
+				geoPoints[geoPoint] = true
+				allFields = append(allFields, geoPointFields(docs, geoPoint, isFilterable)...)
+			}
+			continue
+		}
+		if kind, ok := mapping[propName]; ok {
+			allFields = append(allFields, mappedField(docs, propName, kind, isFilterable))
+			continue
+		}
+
 		propNameValue := findTheFirstNonNilDocValueForPropName(docs, propName)
 
 		switch propNameValue.(type) {
@@ -817,10 +898,26 @@ func (rp *responseParser) processBuckets(aggs map[string]interface{}, target *Qu
 			continue
 		}
 
+		if isSingleBucketAgg(aggDef.Type) {
+			if depth < maxDepth {
+				err = rp.processBuckets(esAgg.MustMap(), target, queryResult, props, depth+1)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			// The metrics are in the single bucket, which is shown as a row keyed
+			// by the path of the aggregation
+			esAgg = singleBucketAsBuckets(esAgg, aggDef)
+		}
+
 		if depth == maxDepth {
-			if aggDef.Type == dateHistType {
+			switch aggDef.Type {
+			case dateHistType:
 				err = rp.processMetrics(esAgg, target, &queryResult.Frames, props)
-			} else {
+			case autoDateHistType:
+				err = rp.processAutoDateHistogram(esAgg, target, &queryResult.Frames, props)
+			default:
 				err = rp.processAggregationDocs(esAgg, aggDef, target, queryResult, props)
 			}
 			if err != nil {
@@ -877,9 +974,19 @@ func (rp *responseParser) processBuckets(aggs map[string]interface{}, target *Qu
 	return nil
 }
 
+func isSingleBucketAgg(aggType string) bool {
+	return aggType == nestedType || aggType == reverseNestedType
+}
+
+func singleBucketAsBuckets(esAgg *simplejson.Json, aggDef *BucketAgg) *simplejson.Json {
+	bucket := esAgg.MustMap()
+	bucket["key"] = aggDef.Settings.Get("path").MustString(aggDef.Field)
+	return utils.NewJsonFromAny(map[string]interface{}{"buckets": []interface{}{bucket}})
+}
+
 func (rp *responseParser) processMetrics(esAgg *simplejson.Json, target *Query, frames *data.Frames, props map[string]string) error {
 	for _, metric := range target.Metrics {
-		if metric.Hide {
+		if metric.Hide || !hasBucketValues(metric.Type) {
 			continue
 		}
 
@@ -907,7 +1014,7 @@ func (rp *responseParser) processMetrics(esAgg *simplejson.Json, target *Query,
 			labels["metric"] = countType
 			*frames = append(*frames, data.Frames{newTimeSeriesFrame(timeVector, labels, values)}...)
 
-		case percentilesType:
+		case percentilesType, percentileRanksType:
 			buckets := esAgg.Get("buckets").MustArray()
 			if len(buckets) == 0 {
 				break
@@ -929,7 +1036,7 @@ func (rp *responseParser) processMetrics(esAgg *simplejson.Json, target *Query,
 				for k, v := range props {
 					labels[k] = v
 				}
-				labels["metric"] = "p" + percentileName
+				labels["metric"] = percentileLabel(metric.Type, percentileName)
 				labels["field"] = metric.Field
 
 				for _, v := range buckets {
@@ -943,20 +1050,9 @@ func (rp *responseParser) processMetrics(esAgg *simplejson.Json, target *Query,
 				}
 				*frames = append(*frames, data.Frames{newTimeSeriesFrame(timeVector, labels, values)}...)
 			}
-		case extendedStatsType:
+		case extendedStatsType, statsType:
 			buckets := esAgg.Get("buckets").MustArray()
-			metaKeys := make([]string, 0)
-			meta := metric.Meta.MustMap()
-			for k := range meta {
-				metaKeys = append(metaKeys, k)
-			}
-			sort.Strings(metaKeys)
-			for _, statName := range metaKeys {
-				v := meta[statName]
-				if enabled, ok := v.(bool); !ok || !enabled {
-					continue
-				}
-
+			for _, statName := range statNames(metric) {
 				labels := make(map[string]string, len(props))
 				timeVector := make([]*time.Time, 0, len(buckets))
 				values := make([]*float64, 0, len(buckets))
@@ -987,6 +1083,58 @@ func (rp *responseParser) processMetrics(esAgg *simplejson.Json, target *Query,
 				}
 				*frames = append(*frames, data.Frames{newTimeSeriesFrame(timeVector, labels, values)}...)
 			}
+		case topMetricsType:
+			buckets := esAgg.Get("buckets").MustArray()
+			fields, _, _ := topMetricsSettings(metric, rp.ConfiguredFields.TimeField)
+			for _, field := range fields {
+				labels := make(map[string]string, len(props))
+				timeVector := make([]*time.Time, 0, len(buckets))
+				values := make([]interface{}, 0, len(buckets))
+
+				for k, v := range props {
+					labels[k] = v
+				}
+				labels["metric"] = topMetricsType
+				labels["field"] = field
+
+				for _, v := range buckets {
+					bucket := utils.NewJsonFromAny(v)
+					timeValue, err := getAsTime(bucket.Get("key"))
+					if err != nil {
+						return err
+					}
+					timeVector = append(timeVector, &timeValue)
+					values = append(values, topMetricValue(bucket, metric.ID, field))
+				}
+				*frames = append(*frames, data.Frames{newTopMetricsFrame(timeVector, labels, values)}...)
+			}
+		case geoCentroidType, geoBoundsType:
+			buckets := esAgg.Get("buckets").MustArray()
+			timeVector := make([]*time.Time, 0, len(buckets))
+			series := make(map[string][]*float64)
+			var names []string
+			for _, v := range buckets {
+				bucket := utils.NewJsonFromAny(v)
+				timeValue, err := getAsTime(bucket.Get("key"))
+				if err != nil {
+					return err
+				}
+				timeVector = append(timeVector, &timeValue)
+				names = names[:0]
+				for _, coord := range geoMetricValues(bucket, metric) {
+					names = append(names, coord.name)
+					series[coord.name] = append(series[coord.name], coord.value)
+				}
+			}
+			for _, name := range names {
+				labels := make(map[string]string, len(props))
+				for k, v := range props {
+					labels[k] = v
+				}
+				labels["metric"] = metric.Type
+				labels["field"] = name
+				*frames = append(*frames, data.Frames{newTimeSeriesFrame(timeVector, labels, series[name])}...)
+			}
 		default:
 			buckets := esAgg.Get("buckets").MustArray()
 			tags := make(map[string]string, len(props))
@@ -1025,6 +1173,32 @@ func (rp *responseParser) processMetrics(esAgg *simplejson.Json, target *Query,
 	return nil
 }
 
+// statNames returns the stats of a stats metric, or the stats enabled in the meta of
+// an extended stats metric
+func statNames(metric *MetricAgg) []string {
+	if metric.Type == statsType {
+		return []string{"count", "min", "max", "avg", "sum"}
+	}
+	meta := metric.Meta.MustMap()
+	names := make([]string, 0, len(meta))
+	for k, v := range meta {
+		if enabled, ok := v.(bool); ok && enabled {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// percentileLabel names a value of a percentiles or percentile ranks metric: the
+// percentile, or the value the percentage of values below is ranked
+func percentileLabel(metricType, key string) string {
+	if metricType == percentileRanksType {
+		return "Percentile Rank " + key
+	}
+	return "p" + key
+}
+
 func newTimeSeriesFrame(timeData []*time.Time, labels map[string]string, values []*float64) *data.Frame {
 	frame := data.NewFrame("",
 		data.NewField(data.TimeSeriesTimeFieldName, nil, timeData),
@@ -1102,23 +1276,21 @@ func (rp *responseParser) processAggregationDocs(esAgg *simplejson.Json, aggDef
 			fields = append(fields, aggDefField)
 		}
 
+		if isGeoGridAgg(aggDef.Type) {
+			lat, lon := geoGridCellCenter(aggDef.Type, bucket.Get("key").MustString())
+			fields = addMetricValue(fields, latitudeField, lat)
+			fields = addMetricValue(fields, longitudeField, lon)
+		}
+
 		for _, metric := range target.Metrics {
+			if !hasBucketValues(metric.Type) {
+				continue
+			}
 			switch metric.Type {
 			case countType:
 				fields = addMetricValue(fields, rp.getMetricName(metric.Type), castToFloat(bucket.Get("doc_count")))
-			case extendedStatsType:
-				metaKeys := make([]string, 0)
-				meta := metric.Meta.MustMap()
-				for k := range meta {
-					metaKeys = append(metaKeys, k)
-				}
-				sort.Strings(metaKeys)
-				for _, statName := range metaKeys {
-					v := meta[statName]
-					if enabled, ok := v.(bool); !ok || !enabled {
-						continue
-					}
-
+			case extendedStatsType, statsType:
+				for _, statName := range statNames(metric) {
 					var value *float64
 					switch statName {
 					case "std_deviation_bounds_upper":
@@ -1132,7 +1304,7 @@ func (rp *responseParser) processAggregationDocs(esAgg *simplejson.Json, aggDef
 					fieldName := fmt.Sprintf("%v %v", rp.getMetricName(metric.Type), rp.getMetricName(statName))
 					fields = addMetricValue(fields, fieldName, value)
 				}
-			case percentilesType:
+			case percentilesType, percentileRanksType:
 				percentiles := bucket.GetPath(metric.ID, "values")
 				percentileKeys := make([]string, 0, len(percentiles.MustMap()))
 				for k := range percentiles.MustMap() {
@@ -1141,9 +1313,20 @@ func (rp *responseParser) processAggregationDocs(esAgg *simplejson.Json, aggDef
 				sort.Strings(percentileKeys)
 				for _, percentileName := range percentileKeys {
 					percentileValue := percentiles.Get(percentileName).MustFloat64()
-					fieldName := fmt.Sprintf("p%v %v", percentileName, metric.Field)
+					fieldName := fmt.Sprintf("%v %v", percentileLabel(metric.Type, percentileName), metric.Field)
 					fields = addMetricValue(fields, fieldName, &percentileValue)
 				}
+			case topMetricsType:
+				topFields, _, _ := topMetricsSettings(metric, rp.ConfiguredFields.TimeField)
+				for _, field := range topFields {
+					fieldName := fmt.Sprintf("%v %v", rp.getMetricName(metric.Type), field)
+					fields = addTopMetricsValue(fields, fieldName, topMetricValue(bucket, metric.ID, field))
+				}
+			case geoCentroidType, geoBoundsType:
+				for _, coord := range geoMetricValues(bucket, metric) {
+					fieldName := fmt.Sprintf("%v %v", rp.getMetricName(metric.Type), coord.name)
+					fields = addMetricValue(fields, fieldName, coord.value)
+				}
 			default:
 				metricName := rp.getMetricName(metric.Type)
 				otherMetrics := make([]*MetricAgg, 0)
@@ -5,6 +5,7 @@ package opensearch
 import (
 	"encoding/json"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -227,7 +228,7 @@ func Test_ResponseParser_test(t *testing.T) {
 				nil,
 				[]*float64{utils.Pointer(6.34), utils.Pointer(6.13)},
 			).SetConfig(&data.FieldConfig{DisplayNameFromDS: "Average rating"}),
-		).SetMeta(&data.FrameMeta{Type: "timeseries-multi"})
+		).SetMeta(&data.FrameMeta{Type: "timeseries-multi", Stats: []data.QueryStat{queryStat("Took", "ms", 0)}})
 		if diff := cmp.Diff(expectedFrame1, responseForA.Frames[0], data.FrameTestCompareOptions()...); diff != "" {
 			t.Errorf("Result mismatch (-want +got):\n%s", diff)
 		}
@@ -239,7 +240,7 @@ func Test_ResponseParser_test(t *testing.T) {
 				nil,
 				[]*float64{utils.Pointer(-0.21)},
 			).SetConfig(&data.FieldConfig{DisplayNameFromDS: "Derivative Average rating"}),
-		).SetMeta(&data.FrameMeta{Type: "timeseries-multi"})
+		).SetMeta(&data.FrameMeta{Type: "timeseries-multi", Stats: []data.QueryStat{queryStat("Took", "ms", 0)}})
 		if diff := cmp.Diff(expectedFrame2, responseForA.Frames[1], data.FrameTestCompareOptions()...); diff != "" {
 			t.Errorf("Result mismatch (-want +got):\n%s", diff)
 		}
@@ -1462,6 +1463,838 @@ func Test_ResponseParser_test(t *testing.T) {
 		assert.EqualValues(t, 24, *frames.Fields[4].At(0).(*float64))
 		assert.EqualValues(t, 48, *frames.Fields[4].At(1).(*float64))
 	})
+
+	t.Run("Sibling pipeline aggregations", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [
+					{ "type": "avg", "field": "cpu", "id": "1" },
+					{ "type": "max_bucket", "field": "1", "id": "4" },
+					{ "type": "stats_bucket", "field": "1", "id": "5" },
+					{ "type": "bucket_selector", "id": "6", "pipelineVariables": [{ "name": "cpu", "pipelineAgg": "1" }], "settings": { "script": "params.cpu > 0" } }
+				],
+				"bucketAggs": [
+					{ "type": "terms", "field": "host", "id": "2" },
+					{ "type": "date_histogram", "field": "@timestamp", "id": "3" }
+				]
+			}`,
+		}}
+		response := `{
+			"responses": [{
+				"aggregations": {
+					"2": {
+						"buckets": [{
+							"key": "a",
+							"doc_count": 2,
+							"3": { "buckets": [{ "key": 1000, "doc_count": 1, "1": { "value": 0.25 } }, { "key": 2000, "doc_count": 1, "1": { "value": 0.75 } }] },
+							"4": { "value": 0.75, "keys": ["2000"] },
+							"5": { "count": 2, "min": 0.25, "max": 0.75, "avg": 0.5, "sum": 1 }
+						}]
+					}
+				}
+			}]
+		}`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		frames := result.Responses["A"].Frames
+		require.Len(t, frames, 7)
+		assert.Equal(t, "a", frames[0].Fields[1].Config.DisplayNameFromDS)
+		assert.Equal(t, 2, frames[0].Rows())
+
+		names := make([]string, 0, 6)
+		for _, frame := range frames[1:] {
+			require.Len(t, frame.Fields, 1)
+			assert.Equal(t, data.FrameTypeNumericMulti, frame.Meta.Type)
+			assert.Equal(t, data.Labels{"host": "a"}, frame.Fields[0].Labels)
+			names = append(names, frame.Fields[0].Config.DisplayNameFromDS)
+		}
+		assert.Equal(t, []string{
+			"a Max Bucket Average cpu",
+			"a Stats Bucket Average cpu Count",
+			"a Stats Bucket Average cpu Min",
+			"a Stats Bucket Average cpu Max",
+			"a Stats Bucket Average cpu Avg",
+			"a Stats Bucket Average cpu Sum",
+		}, names)
+		assert.EqualValues(t, 0.75, *frames[1].Fields[0].At(0).(*float64))
+		assert.EqualValues(t, 1, *frames[6].Fields[0].At(0).(*float64))
+	})
+
+	t.Run("Sibling pipeline aggregation of a date histogram", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "count", "id": "1" }, { "type": "percentiles_bucket", "field": "1", "id": "4" }],
+				"bucketAggs": [{ "type": "date_histogram", "field": "@timestamp", "id": "3" }]
+			}`,
+		}}
+		response := `{
+			"responses": [{
+				"aggregations": {
+					"3": { "buckets": [{ "key": 1000, "doc_count": 4 }] },
+					"4": { "values": { "50.0": 4, "99.0": 4 } }
+				}
+			}]
+		}`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		frames := result.Responses["A"].Frames
+		require.Len(t, frames, 3)
+		assert.Equal(t, "Percentiles Bucket Count p50.0", frames[1].Fields[0].Config.DisplayNameFromDS)
+		assert.Equal(t, "Percentiles Bucket Count p99.0", frames[2].Fields[0].Config.DisplayNameFromDS)
+		assert.EqualValues(t, 4, *frames[2].Fields[0].At(0).(*float64))
+	})
+
+	t.Run("Sibling pipeline aggregation in multi terms buckets", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "avg", "field": "cpu", "id": "1" }, { "type": "max_bucket", "field": "1", "id": "4" }],
+				"bucketAggs": [
+					{ "type": "multi_terms", "id": "2", "settings": { "fields": ["region", "zone"] } },
+					{ "type": "date_histogram", "field": "@timestamp", "id": "3" }
+				]
+			}`,
+		}}
+		response := `{
+			"responses": [{
+				"aggregations": {
+					"2": {
+						"buckets": [
+							{
+								"key": ["eu", 1],
+								"key_as_string": "eu|1",
+								"doc_count": 2,
+								"3": { "buckets": [{ "key": 1000, "doc_count": 1, "1": { "value": 0.25 } }, { "key": 2000, "doc_count": 1, "1": { "value": 0.75 } }] },
+								"4": { "value": 0.75, "keys": ["2000"] }
+							},
+							{
+								"key": ["us", 2],
+								"key_as_string": "us|2",
+								"doc_count": 1,
+								"3": { "buckets": [{ "key": 1000, "doc_count": 1, "1": { "value": 0.5 } }] },
+								"4": { "value": 0.5, "keys": ["1000"] }
+							}
+						]
+					}
+				}
+			}]
+		}`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		frames := result.Responses["A"].Frames
+		require.Len(t, frames, 4)
+		assert.Equal(t, data.FrameTypeNumericMulti, frames[2].Meta.Type)
+		assert.Equal(t, data.Labels{"region": "eu", "zone": "1"}, frames[2].Fields[0].Labels)
+		assert.Equal(t, "eu 1 Max Bucket Average cpu", frames[2].Fields[0].Config.DisplayNameFromDS)
+		assert.EqualValues(t, 0.75, *frames[2].Fields[0].At(0).(*float64))
+		assert.Equal(t, data.Labels{"region": "us", "zone": "2"}, frames[3].Fields[0].Labels)
+		assert.EqualValues(t, 0.5, *frames[3].Fields[0].At(0).(*float64))
+	})
+
+	t.Run("Sibling pipeline aggregation of a multi terms aggregation", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "count", "id": "1" }, { "type": "sum_bucket", "field": "1", "id": "4" }],
+				"bucketAggs": [{ "type": "multi_terms", "id": "2", "settings": { "fields": ["region", "zone"] } }]
+			}`,
+		}}
+		response := `{
+			"responses": [{
+				"aggregations": {
+					"2": { "buckets": [{ "key": ["eu", 1], "doc_count": 2 }, { "key": ["us", 2], "doc_count": 1 }] },
+					"4": { "value": 3 }
+				}
+			}]
+		}`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		frames := result.Responses["A"].Frames
+		require.Len(t, frames, 2)
+		assert.Equal(t, "Sum Bucket Count", frames[1].Fields[0].Config.DisplayNameFromDS)
+		assert.EqualValues(t, 3, *frames[1].Fields[0].At(0).(*float64))
+	})
+
+	t.Run("Top metrics in time series", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "top_metrics", "id": "1", "settings": { "metrics": ["status", "host.cpu"], "orderBy": "@timestamp", "order": "desc" } }],
+				"bucketAggs": [{ "type": "date_histogram", "field": "@timestamp", "id": "2" }]
+			}`,
+		}}
+		response := `{
+			"responses": [{
+				"aggregations": {
+					"2": {
+						"buckets": [
+							{ "key": 1000, "doc_count": 2, "1": { "hits": { "hits": [{ "_source": { "status": "up", "host": { "cpu": 0.5 } } }] } } },
+							{ "key": 2000, "doc_count": 0, "1": { "hits": { "hits": [] } } },
+							{ "key": 3000, "doc_count": 1, "1": { "hits": { "hits": [{ "_source": { "status": "down", "host": { "cpu": 0.75 } } }] } } }
+						]
+					}
+				}
+			}]
+		}`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		frames := result.Responses["A"].Frames
+		require.Len(t, frames, 2)
+		status := frames[0].Fields[1]
+		assert.Equal(t, "Top Metrics status", status.Config.DisplayNameFromDS)
+		assert.Equal(t, data.FieldTypeNullableString, status.Type())
+		assert.Equal(t, "up", *status.At(0).(*string))
+		assert.Nil(t, status.At(1))
+		assert.Equal(t, "down", *status.At(2).(*string))
+		cpu := frames[1].Fields[1]
+		assert.Equal(t, "Top Metrics host.cpu", cpu.Config.DisplayNameFromDS)
+		assert.Equal(t, data.FieldTypeNullableFloat64, cpu.Type())
+		assert.EqualValues(t, 0.5, *cpu.At(0).(*float64))
+		assert.EqualValues(t, 0.75, *cpu.At(2).(*float64))
+	})
+
+	t.Run("Top metrics in a table", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "top_metrics", "id": "1", "settings": { "metrics": ["version"] } }],
+				"bucketAggs": [{ "type": "terms", "field": "host", "id": "2", "settings": { "orderBy": "1" } }]
+			}`,
+		}}
+		response := `{
+			"responses": [{
+				"aggregations": {
+					"2": {
+						"buckets": [
+							{ "key": "a", "doc_count": 2, "1_sort": { "value": 3000 }, "1": { "hits": { "hits": [{ "_source": { "version": 2 } }] } } },
+							{ "key": "b", "doc_count": 1, "1_sort": { "value": 2000 }, "1": { "hits": { "hits": [{ "_source": { "version": "2.1-beta" } }] } } },
+							{ "key": "c", "doc_count": 1, "1_sort": { "value": 1000 }, "1": { "hits": { "hits": [{ "_source": {} }] } } }
+						]
+					}
+				}
+			}]
+		}`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		require.Len(t, result.Responses["A"].Frames, 1)
+		frame := result.Responses["A"].Frames[0]
+		require.Len(t, frame.Fields, 2)
+		assert.Equal(t, "host", frame.Fields[0].Name)
+		version := frame.Fields[1]
+		assert.Equal(t, "Top Metrics version", version.Name)
+		require.Equal(t, 3, version.Len())
+		assert.Equal(t, "2", *version.At(0).(*string))
+		assert.Equal(t, "2.1-beta", *version.At(1).(*string))
+		assert.Nil(t, version.At(2))
+	})
+
+	t.Run("Range aggregation with date histogram", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "count", "id": "1" }],
+				"bucketAggs": [
+					{ "type": "range", "field": "latency", "id": "2", "settings": { "ranges": [{ "key": "fast", "to": 100 }, { "from": 100 }] } },
+					{ "type": "date_histogram", "field": "@timestamp", "id": "3" }
+				]
+			}`,
+		}}
+		response := `{
+			"responses": [{
+				"aggregations": {
+					"2": {
+						"buckets": [
+							{ "key": "fast", "to": 100, "doc_count": 3, "3": { "buckets": [{ "doc_count": 3, "key": 1000 }] } },
+							{ "key": "100.0-*", "from": 100, "doc_count": 1, "3": { "buckets": [{ "doc_count": 1, "key": 1000 }] } }
+						]
+					}
+				}
+			}]
+		}`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		frames := result.Responses["A"].Frames
+		require.Len(t, frames, 2)
+		assert.Equal(t, "fast", frames[0].Fields[1].Config.DisplayNameFromDS)
+		assert.Equal(t, data.Labels{"latency": "fast"}, frames[0].Fields[1].Labels)
+		assert.EqualValues(t, 3, *frames[0].Fields[1].At(0).(*float64))
+		assert.Equal(t, "100.0-*", frames[1].Fields[1].Config.DisplayNameFromDS)
+		assert.EqualValues(t, 1, *frames[1].Fields[1].At(0).(*float64))
+	})
+
+	t.Run("IP range aggregation in a table", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "count", "id": "1" }],
+				"bucketAggs": [{ "type": "ip_range", "field": "client.ip", "id": "2", "settings": { "ranges": [{ "mask": "10.0.0.0/8" }, { "key": "office", "mask": "192.168.0.0/16" }] } }]
+			}`,
+		}}
+		response := `{
+			"responses": [{
+				"aggregations": {
+					"2": {
+						"buckets": [
+							{ "key": "10.0.0.0/8", "from": "10.0.0.0", "to": "11.0.0.0", "doc_count": 7 },
+							{ "key": "office", "from": "192.168.0.0", "to": "192.169.0.0", "doc_count": 2 }
+						]
+					}
+				}
+			}]
+		}`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		require.Len(t, result.Responses["A"].Frames, 1)
+		frame := result.Responses["A"].Frames[0]
+		require.Len(t, frame.Fields, 2)
+		assert.Equal(t, "client.ip", frame.Fields[0].Name)
+		assert.Equal(t, "10.0.0.0/8", *frame.Fields[0].At(0).(*string))
+		assert.Equal(t, "office", *frame.Fields[0].At(1).(*string))
+		assert.EqualValues(t, 7, *frame.Fields[1].At(0).(*float64))
+		assert.EqualValues(t, 2, *frame.Fields[1].At(1).(*float64))
+	})
+
+	t.Run("Multi terms look the same as nested terms", func(t *testing.T) {
+		nestedTerms := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "count", "id": "1" }],
+				"bucketAggs": [
+					{ "type": "terms", "field": "host", "id": "2" },
+					{ "type": "terms", "field": "service", "id": "3" },
+					{ "type": "date_histogram", "field": "@timestamp", "id": "4" }
+				]
+			}`,
+		}}
+		nestedTermsResponse := `{
+			"responses": [{
+				"aggregations": {
+					"2": {
+						"buckets": [
+							{ "key": "a", "doc_count": 3, "3": { "buckets": [
+								{ "key": "api", "doc_count": 2, "4": { "buckets": [{ "key": 1000, "doc_count": 2 }] } },
+								{ "key": "web", "doc_count": 1, "4": { "buckets": [{ "key": 1000, "doc_count": 1 }] } }
+							] } },
+							{ "key": "b", "doc_count": 4, "3": { "buckets": [
+								{ "key": "api", "doc_count": 4, "4": { "buckets": [{ "key": 1000, "doc_count": 4 }] } }
+							] } }
+						]
+					}
+				}
+			}]
+		}`
+		multiTerms := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "count", "id": "1" }],
+				"bucketAggs": [
+					{ "type": "multi_terms", "id": "2", "settings": { "fields": ["host", "service"] } },
+					{ "type": "date_histogram", "field": "@timestamp", "id": "4" }
+				]
+			}`,
+		}}
+		multiTermsResponse := `{
+			"responses": [{
+				"aggregations": {
+					"2": {
+						"buckets": [
+							{ "key": ["b", "api"], "key_as_string": "b|api", "doc_count": 4, "4": { "buckets": [{ "key": 1000, "doc_count": 4 }] } },
+							{ "key": ["a", "api"], "key_as_string": "a|api", "doc_count": 2, "4": { "buckets": [{ "key": 1000, "doc_count": 2 }] } },
+							{ "key": ["a", "web"], "key_as_string": "a|web", "doc_count": 1, "4": { "buckets": [{ "key": 1000, "doc_count": 1 }] } }
+						]
+					}
+				}
+			}]
+		}`
+
+		series := func(targets []tsdbQuery, response string) map[string]*data.Field {
+			rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+			require.NoError(t, err)
+			result, err := rp.parseResponse()
+			require.NoError(t, err)
+			fields := make(map[string]*data.Field)
+			for _, frame := range result.Responses["A"].Frames {
+				fields[frame.Fields[1].Labels.String()] = frame.Fields[1]
+			}
+			return fields
+		}
+		expected := series(nestedTerms, nestedTermsResponse)
+		actual := series(multiTerms, multiTermsResponse)
+		require.Len(t, expected, 3)
+		require.Len(t, actual, 3)
+		for labels, field := range expected {
+			require.Contains(t, actual, labels)
+			assert.ElementsMatch(t, strings.Fields(field.Config.DisplayNameFromDS), strings.Fields(actual[labels].Config.DisplayNameFromDS))
+			assert.Equal(t, field.At(0), actual[labels].At(0))
+		}
+		assert.Contains(t, actual, data.Labels{"host": "a", "service": "web"}.String())
+	})
+
+	t.Run("Multi terms keep the order of their buckets", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "sum", "field": "bytes", "id": "1" }],
+				"bucketAggs": [
+					{ "type": "multi_terms", "id": "2", "settings": { "fields": ["host", "service"], "orderBy": "1", "order": "desc" } },
+					{ "type": "date_histogram", "field": "@timestamp", "id": "3" }
+				]
+			}`,
+		}}
+		response := `{
+			"responses": [{
+				"aggregations": {
+					"2": {
+						"buckets": [
+							{ "key": ["a", "x"], "doc_count": 1, "1": { "value": 30 }, "3": { "buckets": [{ "key": 1000, "doc_count": 1, "1": { "value": 30 } }] } },
+							{ "key": ["b", "y"], "doc_count": 1, "1": { "value": 20 }, "3": { "buckets": [{ "key": 1000, "doc_count": 1, "1": { "value": 20 } }] } },
+							{ "key": ["a", "z"], "doc_count": 1, "1": { "value": 10 }, "3": { "buckets": [{ "key": 1000, "doc_count": 1, "1": { "value": 10 } }] } }
+						]
+					}
+				}
+			}]
+		}`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		frames := result.Responses["A"].Frames
+		require.Len(t, frames, 3)
+		labels := make([]data.Labels, 0, len(frames))
+		for _, frame := range frames {
+			labels = append(labels, frame.Fields[1].Labels)
+		}
+		assert.Equal(t, []data.Labels{
+			{"host": "a", "service": "x"},
+			{"host": "b", "service": "y"},
+			{"host": "a", "service": "z"},
+		}, labels)
+	})
+
+	t.Run("Multi terms in a table", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "avg", "field": "duration", "id": "1" }],
+				"bucketAggs": [{ "type": "multi_terms", "field": "host, status", "id": "2" }]
+			}`,
+		}}
+		response := `{
+			"responses": [{
+				"aggregations": {
+					"2": {
+						"buckets": [
+							{ "key": ["a", 200], "key_as_string": "a|200", "doc_count": 3, "1": { "value": 10 } },
+							{ "key": ["a", 500], "key_as_string": "a|500", "doc_count": 1, "1": { "value": 30 } },
+							{ "key": ["b", 200], "key_as_string": "b|200", "doc_count": 2, "1": { "value": 20 } }
+						]
+					}
+				}
+			}]
+		}`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		require.Len(t, result.Responses["A"].Frames, 1)
+		frame := result.Responses["A"].Frames[0]
+		require.Len(t, frame.Fields, 3)
+		assert.Equal(t, "host", frame.Fields[0].Name)
+		assert.Equal(t, "status", frame.Fields[1].Name)
+		assert.Equal(t, "Average", frame.Fields[2].Name)
+		require.Equal(t, 3, frame.Rows())
+		assert.Equal(t, "a", *frame.Fields[0].At(1).(*string))
+		assert.EqualValues(t, 500, *frame.Fields[1].At(1).(*float64))
+		assert.EqualValues(t, 30, *frame.Fields[2].At(1).(*float64))
+		assert.Equal(t, "b", *frame.Fields[0].At(2).(*string))
+	})
+
+	t.Run("Geotile grid with geo metrics in a table", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [
+					{ "type": "count", "id": "1" },
+					{ "type": "geo_centroid", "field": "location", "id": "3" },
+					{ "type": "geo_bounds", "field": "location", "id": "4" }
+				],
+				"bucketAggs": [{ "type": "geotile_grid", "field": "location", "id": "2" }]
+			}`,
+		}}
+		response := `{
+			"responses": [{
+				"aggregations": {
+					"2": {
+						"buckets": [{
+							"key": "1/1/0",
+							"doc_count": 2,
+							"3": { "location": { "lat": 52.5, "lon": 13.4 }, "count": 2 },
+							"4": { "bounds": { "top_left": { "lat": 52.6, "lon": 13.3 }, "bottom_right": { "lat": 52.4, "lon": 13.5 } } }
+						}]
+					}
+				}
+			}]
+		}`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		require.Len(t, result.Responses["A"].Frames, 1)
+		frame := result.Responses["A"].Frames[0]
+		names := make([]string, 0, len(frame.Fields))
+		for _, f := range frame.Fields {
+			names = append(names, f.Name)
+		}
+		assert.Equal(t, []string{
+			"location", "latitude", "longitude", "Count",
+			"Geo Centroid latitude", "Geo Centroid longitude",
+			"Geo Bounds top", "Geo Bounds left", "Geo Bounds bottom", "Geo Bounds right",
+		}, names)
+		assert.Equal(t, "1/1/0", *frame.Fields[0].At(0).(*string))
+		assert.InDelta(t, 66.51, *frame.Fields[1].At(0).(*float64), 0.01)
+		assert.InDelta(t, 90, *frame.Fields[2].At(0).(*float64), 0.001)
+		assert.EqualValues(t, 52.5, *frame.Fields[4].At(0).(*float64))
+		assert.EqualValues(t, 13.4, *frame.Fields[5].At(0).(*float64))
+		assert.EqualValues(t, 52.6, *frame.Fields[6].At(0).(*float64))
+		assert.EqualValues(t, 13.5, *frame.Fields[9].At(0).(*float64))
+	})
+
+	t.Run("Geo centroid in time series", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "geo_centroid", "field": "location", "id": "1" }],
+				"bucketAggs": [{ "type": "date_histogram", "field": "@timestamp", "id": "2" }]
+			}`,
+		}}
+		response := `{
+			"responses": [{
+				"aggregations": {
+					"2": {
+						"buckets": [
+							{ "key": 1000, "doc_count": 1, "1": { "location": { "lat": 10, "lon": 20 }, "count": 1 } },
+							{ "key": 2000, "doc_count": 0, "1": { "count": 0 } }
+						]
+					}
+				}
+			}]
+		}`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		frames := result.Responses["A"].Frames
+		require.Len(t, frames, 2)
+		assert.Equal(t, "Geo Centroid latitude", frames[0].Fields[1].Config.DisplayNameFromDS)
+		assert.EqualValues(t, 10, *frames[0].Fields[1].At(0).(*float64))
+		assert.Nil(t, frames[0].Fields[1].At(1))
+		assert.Equal(t, "Geo Centroid longitude", frames[1].Fields[1].Config.DisplayNameFromDS)
+		assert.EqualValues(t, 20, *frames[1].Fields[1].At(0).(*float64))
+	})
+
+	t.Run("Auto date histogram with the interval it chose", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "count", "id": "1" }, { "type": "avg", "field": "cpu", "id": "3" }],
+				"bucketAggs": [{ "type": "auto_date_histogram", "field": "@timestamp", "id": "2" }]
+			}`,
+		}}
+		response := `{
+			"responses": [{
+				"aggregations": {
+					"2": {
+						"buckets": [
+							{ "key": 1800000, "doc_count": 2, "3": { "value": 0.5 } },
+							{ "key": 3600000, "doc_count": 4, "3": { "value": 0.25 } }
+						],
+						"interval": "30m"
+					}
+				}
+			}]
+		}`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		frames := result.Responses["A"].Frames
+		require.Len(t, frames, 2)
+		for _, frame := range frames {
+			assert.Equal(t, data.FrameTypeTimeSeriesMulti, frame.Meta.Type)
+			assert.Equal(t, map[string]interface{}{"interval": "30m"}, frame.Meta.Custom)
+			assert.EqualValues(t, 30*60*1000, frame.Fields[0].Config.Interval)
+			assert.Equal(t, 2, frame.Rows())
+		}
+		assert.Equal(t, "Count", frames[0].Fields[1].Config.DisplayNameFromDS)
+		assert.EqualValues(t, 4, *frames[0].Fields[1].At(1).(*float64))
+		assert.Equal(t, "Average cpu", frames[1].Fields[1].Config.DisplayNameFromDS)
+	})
+
+	t.Run("Auto date histogram with a calendar interval", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "count", "id": "1" }],
+				"bucketAggs": [{ "type": "auto_date_histogram", "field": "@timestamp", "id": "2" }]
+			}`,
+		}}
+		response := `{
+			"responses": [{
+				"aggregations": {
+					"2": { "buckets": [{ "key": 1000, "doc_count": 2 }], "interval": "1M" }
+				}
+			}]
+		}`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		frames := result.Responses["A"].Frames
+		require.Len(t, frames, 1)
+		assert.Equal(t, map[string]interface{}{"interval": "1M"}, frames[0].Meta.Custom)
+		if frames[0].Fields[0].Config != nil {
+			assert.Zero(t, frames[0].Fields[0].Config.Interval)
+		}
+	})
+
+	t.Run("Stats, percentile ranks and single value metrics in time series", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [
+					{ "type": "stats", "field": "latency", "id": "1" },
+					{ "type": "percentile_ranks", "field": "latency", "id": "2", "settings": { "values": ["300"] } },
+					{ "type": "median_absolute_deviation", "field": "latency", "id": "3" },
+					{ "type": "weighted_avg", "field": "grade", "id": "4", "settings": { "weight": "credits" } },
+					{ "type": "value_count", "field": "user", "id": "5" }
+				],
+				"bucketAggs": [{ "type": "date_histogram", "field": "@timestamp", "id": "6" }]
+			}`,
+		}}
+		response := `{
+			"responses": [{
+				"aggregations": {
+					"6": {
+						"buckets": [{
+							"key": 1000,
+							"doc_count": 4,
+							"1": { "count": 4, "min": 100, "max": 400, "avg": 250, "sum": 1000 },
+							"2": { "values": { "300.0": 75 } },
+							"3": { "value": 12.5 },
+							"4": { "value": 3.2 },
+							"5": { "value": 3 }
+						}]
+					}
+				}
+			}]
+		}`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		frames := result.Responses["A"].Frames
+		require.Len(t, frames, 9)
+		values := make(map[string]float64)
+		for _, frame := range frames {
+			values[frame.Fields[1].Config.DisplayNameFromDS] = *frame.Fields[1].At(0).(*float64)
+		}
+		assert.Equal(t, map[string]float64{
+			"Count latency":                     4,
+			"Min latency":                       100,
+			"Max latency":                       400,
+			"Average latency":                   250,
+			"Sum latency":                       1000,
+			"Percentile Rank 300.0 latency":     75,
+			"Median Absolute Deviation latency": 12.5,
+			"Weighted Average grade":            3.2,
+			"Value Count user":                  3,
+		}, values)
+	})
+
+	t.Run("Stats and percentile ranks in a table", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [
+					{ "type": "stats", "field": "latency", "id": "1" },
+					{ "type": "percentile_ranks", "field": "latency", "id": "2", "settings": { "values": ["100", "300"] } }
+				],
+				"bucketAggs": [{ "type": "terms", "field": "host", "id": "3" }]
+			}`,
+		}}
+		response := `{
+			"responses": [{
+				"aggregations": {
+					"3": {
+						"buckets": [{
+							"key": "a",
+							"doc_count": 4,
+							"1": { "count": 4, "min": 100, "max": 400, "avg": 250, "sum": 1000 },
+							"2": { "values": { "100.0": 25, "300.0": 75 } }
+						}]
+					}
+				}
+			}]
+		}`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		require.Len(t, result.Responses["A"].Frames, 1)
+		frame := result.Responses["A"].Frames[0]
+		names := make([]string, 0, len(frame.Fields))
+		for _, f := range frame.Fields {
+			names = append(names, f.Name)
+		}
+		assert.Equal(t, []string{
+			"host", "Stats Count", "Stats Min", "Stats Max", "Stats Average", "Stats Sum",
+			"Percentile Rank 100.0 latency", "Percentile Rank 300.0 latency",
+		}, names)
+		assert.EqualValues(t, 250, *frame.Fields[4].At(0).(*float64))
+		assert.EqualValues(t, 75, *frame.Fields[7].At(0).(*float64))
+	})
+
+	t.Run("Nested aggregations look the same as flat ones", func(t *testing.T) {
+		flat := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "count", "id": "1" }, { "type": "avg", "field": "attributes.latency", "id": "4" }],
+				"bucketAggs": [
+					{ "type": "terms", "field": "attributes.name", "id": "3" },
+					{ "type": "date_histogram", "field": "@timestamp", "id": "5" }
+				]
+			}`,
+		}}
+		nested := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "count", "id": "1" }, { "type": "avg", "field": "attributes.latency", "id": "4" }],
+				"bucketAggs": [
+					{ "type": "nested", "field": "attributes", "id": "2" },
+					{ "type": "terms", "field": "attributes.name", "id": "3" },
+					{ "type": "date_histogram", "field": "@timestamp", "id": "5" }
+				]
+			}`,
+		}}
+		histogram := `{ "buckets": [{ "4": { "value": 10 }, "doc_count": 1, "key": 1000 }, { "4": { "value": 20 }, "doc_count": 3, "key": 2000 }] }`
+		terms := `{ "buckets": [{ "5": ` + histogram + `, "doc_count": 4, "key": "checkout" }] }`
+		flatResponse := `{ "responses": [{ "aggregations": { "3": ` + terms + ` } }] }`
+		nestedResponse := `{ "responses": [{ "aggregations": { "2": { "doc_count": 4, "3": ` + terms + ` } } }] }`
+
+		rp, err := newResponseParserForTest(flat, flatResponse, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		expected, err := rp.parseResponse()
+		require.NoError(t, err)
+		rp, err = newResponseParserForTest(nested, nestedResponse, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		require.Len(t, result.Responses["A"].Frames, 2)
+		assert.Equal(t, "checkout Count", result.Responses["A"].Frames[0].Fields[1].Config.DisplayNameFromDS)
+		assert.Equal(t, expected.Responses["A"].Frames, result.Responses["A"].Frames)
+	})
+
+	t.Run("Reverse nested aggregation in a table", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "count", "id": "1" }],
+				"bucketAggs": [
+					{ "type": "nested", "field": "attributes", "id": "2" },
+					{ "type": "terms", "field": "attributes.name", "id": "3" },
+					{ "type": "reverse_nested", "id": "4" },
+					{ "type": "terms", "field": "service", "id": "5" }
+				]
+			}`,
+		}}
+		response := `{
+			"responses": [{
+				"aggregations": {
+					"2": {
+						"doc_count": 9,
+						"3": {
+							"buckets": [{
+								"key": "checkout",
+								"doc_count": 9,
+								"4": { "doc_count": 5, "5": { "buckets": [{ "key": "api", "doc_count": 3 }, { "key": "web", "doc_count": 2 }] } }
+							}]
+						}
+					}
+				}
+			}]
+		}`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		require.Len(t, result.Responses["A"].Frames, 1)
+		frame := result.Responses["A"].Frames[0]
+		require.Len(t, frame.Fields, 3)
+		assert.Equal(t, "attributes.name", frame.Fields[0].Name)
+		assert.Equal(t, "checkout", *frame.Fields[0].At(1).(*string))
+		assert.Equal(t, "service", frame.Fields[1].Name)
+		assert.Equal(t, "web", *frame.Fields[1].At(1).(*string))
+		assert.Equal(t, "Count", frame.Fields[2].Name)
+		assert.EqualValues(t, 2, *frame.Fields[2].At(1).(*float64))
+	})
+
+	t.Run("Nested aggregation as the last bucket aggregation", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"metrics": [{ "type": "count", "id": "1" }, { "type": "max", "field": "attributes.latency", "id": "3" }],
+				"bucketAggs": [{ "type": "nested", "field": "attributes", "id": "2" }]
+			}`,
+		}}
+		response := `{ "responses": [{ "aggregations": { "2": { "doc_count": 7, "3": { "value": 42 } } } }] }`
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		require.Len(t, result.Responses["A"].Frames, 1)
+		frame := result.Responses["A"].Frames[0]
+		require.Len(t, frame.Fields, 3)
+		assert.Equal(t, "attributes", *frame.Fields[0].At(0).(*string))
+		assert.EqualValues(t, 7, *frame.Fields[1].At(0).(*float64))
+		assert.EqualValues(t, 42, *frame.Fields[2].At(0).(*float64))
+	})
 }
 
 func TestProcessLogsResponse_creates_correct_data_frame_fields(t *testing.T) {
@@ -1599,7 +2432,7 @@ func TestProcessLogsResponse_creates_correct_data_frame_fields(t *testing.T) {
 				utils.Pointer(float64(1)),
 				utils.Pointer(float64(2)),
 			}).SetConfig(&data.FieldConfig{Filterable: utils.Pointer(true)}),
-	).SetMeta(&data.FrameMeta{PreferredVisualization: "logs"})
+	).SetMeta(&data.FrameMeta{PreferredVisualization: "logs", Stats: []data.QueryStat{queryStat("Took", "ms", 0)}})
 	if diff := cmp.Diff(expectedFrame, result.Responses["A"].Frames[0], data.FrameTestCompareOptions()...); diff != "" {
 		t.Errorf("Result mismatch (-want +got):\n%s", diff)
 	}
@@ -1647,13 +2480,70 @@ func TestProcessLogsResponse_empty_response(t *testing.T) {
 	require.NotNil(t, queryRes)
 	require.Len(t, queryRes.Frames, 1)
 
-	expectedFrame := data.NewFrame("").SetMeta(&data.FrameMeta{PreferredVisualization: "logs"})
+	expectedFrame := data.NewFrame("").SetMeta(&data.FrameMeta{PreferredVisualization: "logs", Stats: []data.QueryStat{queryStat("Took", "ms", 0)}})
 	data.FrameTestCompareOptions()
 	if diff := cmp.Diff(expectedFrame, result.Responses["A"].Frames[0], data.FrameTestCompareOptions()...); diff != "" {
 		t.Errorf("Result mismatch (-want +got):\n%s", diff)
 	}
 }
 
+func TestProcessLogsResponse_highlights(t *testing.T) {
+	targets := []tsdbQuery{{
+		refId: "A",
+		body: `{
+			"timeField": "@timestamp",
+			"metrics": [{ "type": "logs", "id": "1" }],
+			"query": "error OR timeout"
+		}`,
+	}}
+
+	response := `
+		{
+			"responses": [
+				{
+					"hits": {
+						"total": { "value": 2, "relation": "eq" },
+						"hits": [
+							{
+								"_id": "1",
+								"_source": { "@timestamp": "2019-06-24T09:51:19.765Z", "message": "an error and a timeout" },
+								"highlight": { "message": ["an @HIGHLIGHT@error@/HIGHLIGHT@ and a @HIGHLIGHT@timeout@/HIGHLIGHT@"] }
+							},
+							{
+								"_id": "2",
+								"_source": { "@timestamp": "2019-06-24T09:52:19.765Z", "message": "an error" },
+								"highlight": { "message": ["an @HIGHLIGHT@error@/HIGHLIGHT@"] }
+							},
+							{
+								"_id": "3",
+								"_source": { "@timestamp": "2019-06-24T09:53:19.765Z", "message": "all good" }
+							}
+						]
+					},
+					"status": 200
+				}
+			]
+		}`
+
+	rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp", LogMessageField: "message"}, nil)
+	require.NoError(t, err)
+	result, err := rp.parseResponse()
+	require.NoError(t, err)
+
+	require.Len(t, result.Responses["A"].Frames, 1)
+	frame := result.Responses["A"].Frames[0]
+
+	custom, ok := frame.Meta.Custom.(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, []string{"error", "timeout"}, custom["searchWords"])
+	assert.Equal(t, 2, custom["total"])
+
+	highlightField, _ := frame.FieldByName("highlight")
+	require.NotNil(t, highlightField)
+	assert.JSONEq(t, `{"message":["an @HIGHLIGHT@error@/HIGHLIGHT@"]}`, string(*highlightField.At(1).(*json.RawMessage)))
+	assert.JSONEq(t, `null`, string(*highlightField.At(2).(*json.RawMessage)))
+}
+
 func TestProcessLogsResponse_log_query_with_nested_fields(t *testing.T) {
 	// Log query with nested fields
 	targets := []tsdbQuery{{
@@ -1823,7 +2713,11 @@ func TestProcessLogsResponse_log_query_with_nested_fields(t *testing.T) {
 				nil, // Correctly detects type even if first value is null
 				utils.Pointer("def"),
 			}).SetConfig(&data.FieldConfig{Filterable: utils.Pointer(true)}),
-	).SetMeta(&data.FrameMeta{PreferredVisualization: "logs", Custom: map[string]interface{}{"total": 109}})
+	).SetMeta(&data.FrameMeta{PreferredVisualization: "logs", Custom: map[string]interface{}{
+		"total": 109,
+		// sort values locate the documents for log context queries
+		"sort": []interface{}{[]interface{}{float64(1675869055830), float64(4)}, []interface{}{float64(1675869054835), float64(7)}},
+	}, Stats: []data.QueryStat{queryStat("Took", "ms", 0), queryStat("Hits total", "", 109)}, Notices: []data.Notice{{Severity: data.NoticeSeverityWarning, Text: "Showing 2 of 109 matching documents"}}})
 	if diff := cmp.Diff(expectedFrame, result.Responses["A"].Frames[0], data.FrameTestCompareOptions()...); diff != "" {
 		t.Errorf("Result mismatch (-want +got):\n%s", diff)
 	}
@@ -3839,3 +4733,119 @@ func TestProcessServiceMapResponse(t *testing.T) {
 	assert.Equal(t, "frontend", nodesFrame.Fields[0].At(0))
 	assert.Equal(t, "redis", nodesFrame.Fields[0].At(1))
 }
+
+func TestProcessAnnotationsResponse(t *testing.T) {
+	t.Run("builds annotation events from hits", func(t *testing.T) {
+		targets := []tsdbQuery{{
+			refId: "A",
+			body: `{
+				"query": "tags:deploy",
+				"luceneQueryType": "Annotations",
+				"annotation": { "timeEndField": "endTime", "textField": "message", "tagsField": "event.tags" }
+			}`,
+		}}
+
+		response := `
+		{
+			"responses": [
+				{
+				"hits": {
+					"total": {"value": 3, "relation": "eq"},
+					"hits": [
+					{
+						"_id": "1",
+						"_source": { "message": "deployed v1", "endTime": 1526406700000, "event": { "tags": ["deploy", "prod"] } },
+						"fields": { "@timestamp": ["2018-05-15T17:50:00.000Z"] }
+					},
+					{
+						"_id": "2",
+						"_source": { "@timestamp": "2018-05-15T17:51:00Z", "message": "deployed v2", "event": { "tags": "deploy" } }
+					},
+					{
+						"_id": "3",
+						"_source": { "message": "no time" }
+					}
+					]
+				}
+				}
+			]
+		}`
+
+		rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+		require.NoError(t, err)
+		result, err := rp.parseResponse()
+		require.NoError(t, err)
+
+		frames := result.Responses["A"].Frames
+		require.Len(t, frames, 1)
+		frame := frames[0]
+		assert.Equal(t, data.DataTopicAnnotations, frame.Meta.DataTopic)
+		require.Len(t, frame.Fields, 4)
+		require.Equal(t, 2, frame.Rows())
+
+		assert.Equal(t, "time", frame.Fields[0].Name)
+		assert.Equal(t, time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC), frame.Fields[0].At(0))
+		assert.Equal(t, time.Date(2018, 5, 15, 17, 51, 0, 0, time.UTC), frame.Fields[0].At(1))
+
+		assert.Equal(t, "timeEnd", frame.Fields[1].Name)
+		assert.Equal(t, time.UnixMilli(1526406700000).UTC(), *frame.Fields[1].At(0).(*time.Time))
+		assert.Nil(t, frame.Fields[1].At(1))
+
+		assert.Equal(t, "text", frame.Fields[2].Name)
+		assert.Equal(t, "deployed v1", frame.Fields[2].At(0))
+		assert.Equal(t, "deployed v2", frame.Fields[2].At(1))
+
+		assert.Equal(t, "tags", frame.Fields[3].Name)
+		assert.Equal(t, "deploy,prod", frame.Fields[3].At(0))
+		assert.Equal(t, "deploy", frame.Fields[3].At(1))
+	})
+}
+
+func Test_annotationTime(t *testing.T) {
+	tests := map[string]time.Time{
+		"2018-05-15T17:50:00.123Z":   time.Date(2018, 5, 15, 17, 50, 0, 123000000, time.UTC),
+		"2018-05-15T19:50:00+02:00":  time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC),
+		"2018-05-15T17:50:00":        time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC),
+		"2018-05-15 17:50:00":        time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC),
+		"2018-05-15 17:50:00.123456": time.Date(2018, 5, 15, 17, 50, 0, 123456000, time.UTC),
+		"2018-05-15":                 time.Date(2018, 5, 15, 0, 0, 0, 0, time.UTC),
+		"1526406600000":              time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC),
+	}
+	for value, expected := range tests {
+		actual, ok := annotationTime(value)
+		require.True(t, ok, value)
+		assert.True(t, expected.Equal(actual), "%s: %s", value, actual)
+	}
+
+	_, ok := annotationTime("yesterday")
+	assert.False(t, ok)
+}
+
+func Test_parseResponse_error_of_a_query_keeps_the_other_queries(t *testing.T) {
+	body := `{
+		"timeField": "@timestamp",
+		"metrics": [{ "type": "count", "id": "1" }],
+		"bucketAggs": [{ "type": "date_histogram", "field": "@timestamp", "id": "2" }]
+	}`
+	targets := []tsdbQuery{{refId: "A", body: body}, {refId: "B", body: body}, {refId: "C", body: body}}
+	response := `{
+		"responses": [
+			{ "aggregations": { "2": { "buckets": [{ "key": 1000, "doc_count": 1 }] } } },
+			{ "aggregations": { "2": { "buckets": [{ "key": "not a time", "doc_count": 1 }] } } },
+			{ "aggregations": { "2": { "buckets": [{ "key": 1000, "doc_count": 3 }] } } }
+		]
+	}`
+
+	rp, err := newResponseParserForTest(targets, response, nil, client.ConfiguredFields{TimeField: "@timestamp"}, nil)
+	require.NoError(t, err)
+	result, err := rp.parseResponse()
+	require.NoError(t, err)
+
+	require.Len(t, result.Responses, 3)
+	assert.NoError(t, result.Responses["A"].Error)
+	assert.Len(t, result.Responses["A"].Frames, 1)
+	assert.Error(t, result.Responses["B"].Error)
+	assert.Equal(t, backend.ErrorSourcePlugin, result.Responses["B"].ErrorSource)
+	assert.NoError(t, result.Responses["C"].Error)
+	assert.Len(t, result.Responses["C"].Frames, 1)
+}
@@ -98,7 +98,7 @@ func Test_size5_five_shards_raises_interval(t *testing.T) {
 
 func TestNumberOfShards_FallbackAndCache(t *testing.T) {
 	newHandler := func(c client.Client) *luceneHandler {
-		return newLuceneHandler(c, nil, &backend.DataSourceInstanceSettings{})
+		return newLuceneHandler(c, &backend.DataSourceInstanceSettings{}, newConcurrencyLimiter(defaultMaxConcurrentQueries))
 	}
 
 	t.Run("client error falls back to 1 and is not cached", func(t *testing.T) {
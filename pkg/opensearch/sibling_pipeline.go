@@ -0,0 +1,234 @@
+package opensearch
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+	"github.com/grafana/opensearch-datasource/pkg/utils"
+)
+
+const (
+	bucketSelectorType    = "bucket_selector"
+	bucketSortType        = "bucket_sort"
+	statsBucketType       = "stats_bucket"
+	percentilesBucketType = "percentiles_bucket"
+)
+
+// siblingPipelineAggType are the pipeline aggregations computing a single value from
+// all buckets of the innermost bucket aggregation. They are siblings of that
+// aggregation in the request and the response.
+var siblingPipelineAggType = map[string]string{
+	"avg_bucket":          "avg_bucket",
+	"max_bucket":          "max_bucket",
+	"min_bucket":          "min_bucket",
+	"sum_bucket":          "sum_bucket",
+	statsBucketType:       statsBucketType,
+	percentilesBucketType: percentilesBucketType,
+}
+
+func isSiblingPipelineAgg(metricType string) bool {
+	_, ok := siblingPipelineAggType[metricType]
+	return ok
+}
+
+// hasBucketValues reports whether a metric has a value in the buckets of the
+// innermost bucket aggregation. Sibling pipelines are next to the buckets, and
+// bucket_selector and bucket_sort only filter and sort them.
+func hasBucketValues(metricType string) bool {
+	return !isSiblingPipelineAgg(metricType) && metricType != bucketSelectorType && metricType != bucketSortType
+}
+
+// metricBucketPath returns the path of the value of the metric with metricID in a
+// bucket, or false if the query has no such metric or it has no value in the buckets
+func metricBucketPath(metricID string, metrics []*MetricAgg) (string, bool) {
+	for _, m := range metrics {
+		if m.ID == metricID {
+			if !hasBucketValues(m.Type) {
+				return "", false
+			}
+			if m.Type == countType {
+				return "_count", true
+			}
+			return metricID, true
+		}
+	}
+	return "", false
+}
+
+// addSiblingPipelineAgg adds a sibling pipeline of the innermost bucket aggregation,
+// with the builder that aggregation was added with
+func addSiblingPipelineAgg(aggBuilder client.AggBuilder, m *MetricAgg, bucketAgg *BucketAgg, metrics []*MetricAgg) {
+	path, ok := metricBucketPath(getPipelineAggField(m), metrics)
+	if !ok {
+		return
+	}
+	aggBuilder.Pipeline(m.ID, m.Type, bucketAgg.ID+">"+path, func(a *client.PipelineAggregation) {
+		a.Settings = m.Settings.MustMap()
+	})
+}
+
+// addBucketSortAgg sorts the buckets of the innermost bucket aggregation by the
+// metric in the field of m, if any, and keeps the "size" buckets after "from"
+func addBucketSortAgg(aggBuilder client.AggBuilder, m *MetricAgg, metrics []*MetricAgg) {
+	aggBuilder.Pipeline(m.ID, m.Type, nil, func(a *client.PipelineAggregation) {
+		for _, setting := range []string{"size", "from"} {
+			if v, err := castToInt(m.Settings.Get(setting)); err == nil {
+				a.Settings[setting] = v
+			}
+		}
+		if path, ok := metricBucketPath(getPipelineAggField(m), metrics); ok {
+			a.Settings["sort"] = []map[string]interface{}{{path: map[string]interface{}{"order": m.Settings.Get("order").MustString(descending)}}}
+		}
+	})
+}
+
+// processSiblingPipelines returns a single value frame for every value of the sibling
+// pipelines of the query. They are next to the innermost bucket aggregation, so they
+// are found in the response by its ID, rather than by depth, as aggs and target must
+// be those of the query before multi terms or composite aggregations are expanded.
+func (rp *responseParser) processSiblingPipelines(aggs map[string]interface{}, target *Query, props map[string]string) data.Frames {
+	frames := data.Frames{}
+	if len(target.BucketAggs) == 0 {
+		return frames
+	}
+	if _, ok := aggs[target.BucketAggs[len(target.BucketAggs)-1].ID]; ok {
+		for _, metric := range target.Metrics {
+			if metric.Hide || !isSiblingPipelineAgg(metric.Type) {
+				continue
+			}
+			if v, ok := aggs[metric.ID]; ok {
+				frames = append(frames, rp.siblingPipelineFrames(utils.NewJsonFromAny(v), metric, target, props)...)
+			}
+		}
+		return frames
+	}
+
+	aggIDs := make([]string, 0, len(aggs))
+	for k := range aggs {
+		aggIDs = append(aggIDs, k)
+	}
+	sort.Strings(aggIDs)
+	for _, aggID := range aggIDs {
+		aggDef, _ := findAgg(target, aggID)
+		if aggDef == nil {
+			continue
+		}
+		esAgg := utils.NewJsonFromAny(aggs[aggID])
+		if isSingleBucketAgg(aggDef.Type) {
+			frames = append(frames, rp.processSiblingPipelines(esAgg.MustMap(), target, props)...)
+			continue
+		}
+		for _, b := range esAgg.Get("buckets").MustArray() {
+			bucket := utils.NewJsonFromAny(b)
+			newProps := make(map[string]string, len(props)+1)
+			for k, v := range props {
+				newProps[k] = v
+			}
+			if aggDef.Type == multiTermsType {
+				// keyed by the values of all its fields, a label per field
+				values := bucket.Get("key").MustArray()
+				for i, field := range multiTermsFields(aggDef) {
+					if i < len(values) {
+						if key, ok := bucketKeyLabel(utils.NewJsonFromAny(values[i])); ok {
+							newProps[field] = key
+						}
+					}
+				}
+			} else if key, ok := bucketKeyLabel(bucket.Get("key")); ok {
+				newProps[aggDef.Field] = key
+			}
+			if key, err := bucket.Get("key_as_string").String(); err == nil && aggDef.Type != multiTermsType {
+				newProps[aggDef.Field] = key
+			}
+			frames = append(frames, rp.processSiblingPipelines(bucket.MustMap(), target, newProps)...)
+		}
+		buckets := esAgg.Get("buckets").MustMap()
+		bucketKeys := make([]string, 0, len(buckets))
+		for k := range buckets {
+			bucketKeys = append(bucketKeys, k)
+		}
+		sort.Strings(bucketKeys)
+		for _, bucketKey := range bucketKeys {
+			newProps := make(map[string]string, len(props)+1)
+			for k, v := range props {
+				newProps[k] = v
+			}
+			newProps["filter"] = bucketKey
+			frames = append(frames, rp.processSiblingPipelines(utils.NewJsonFromAny(buckets[bucketKey]).MustMap(), target, newProps)...)
+		}
+	}
+	return frames
+}
+
+// bucketKeyLabel returns the label of a bucket key, which is a string or a number
+func bucketKeyLabel(key *simplejson.Json) (string, bool) {
+	if s, err := key.String(); err == nil {
+		return s, true
+	}
+	if n, err := key.Int64(); err == nil {
+		return strconv.FormatInt(n, 10), true
+	}
+	return "", false
+}
+
+// siblingPipelineFrames returns a frame for every value of a sibling pipeline
+func (rp *responseParser) siblingPipelineFrames(value *simplejson.Json, metric *MetricAgg, target *Query, props map[string]string) data.Frames {
+	name := rp.getMetricName(metric.Type)
+	for _, m := range target.Metrics {
+		if m.ID == getPipelineAggField(metric) {
+			name += " " + describeMetric(m.Type, m.Field)
+		}
+	}
+
+	type namedValue struct {
+		name  string
+		value *float64
+	}
+	values := make([]namedValue, 0)
+	switch metric.Type {
+	case statsBucketType:
+		for _, stat := range []string{"count", "min", "max", "avg", "sum"} {
+			values = append(values, namedValue{name + " " + extendedStats[stat], castToFloat(value.Get(stat))})
+		}
+	case percentilesBucketType:
+		percentiles := value.Get("values").MustMap()
+		keys := make([]string, 0, len(percentiles))
+		for k := range percentiles {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			values = append(values, namedValue{name + " p" + k, castToFloat(value.GetPath("values", k))})
+		}
+	default:
+		values = append(values, namedValue{name, castToFloat(value.Get("value"))})
+	}
+
+	propKeys := make([]string, 0, len(props))
+	for k := range props {
+		propKeys = append(propKeys, k)
+	}
+	sort.Strings(propKeys)
+	prefix := make([]string, 0, len(props))
+	for _, k := range propKeys {
+		prefix = append(prefix, props[k])
+	}
+
+	frames := make(data.Frames, 0, len(values))
+	for _, v := range values {
+		labels := make(data.Labels, len(props))
+		for k, p := range props {
+			labels[k] = p
+		}
+		field := data.NewField("Value", labels, []*float64{v.value})
+		field.Config = &data.FieldConfig{DisplayNameFromDS: strings.TrimSpace(strings.Join(append(prefix, v.name), " "))}
+		frame := data.NewFrame("", field)
+		frame.Meta = &data.FrameMeta{Type: data.FrameTypeNumericMulti}
+		frames = append(frames, frame)
+	}
+	return frames
+}
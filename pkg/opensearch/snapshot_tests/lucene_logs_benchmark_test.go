@@ -0,0 +1,95 @@
+package snapshot_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch"
+	"github.com/stretchr/testify/require"
+)
+
+// benchmarkHits is the number of documents of the benchmarked responses, the most
+// a logs query returns without paginating
+const benchmarkHits = 10000
+
+// msearchRoundTripper returns body for _msearch requests and an empty object for
+// any other request, like the lookups of the mapping or shards of an index
+type msearchRoundTripper struct {
+	body []byte
+}
+
+func (rt *msearchRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := []byte(`{}`)
+	if strings.HasSuffix(req.URL.Path, "_msearch") {
+		body = rt.body
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+	}, nil
+}
+
+// largeLogsResponse returns the logs response of the snapshot tests with its hits
+// repeated until there are benchmarkHits of them
+func largeLogsResponse(b *testing.B) []byte {
+	b.Helper()
+	responseFromOpenSearch, err := os.ReadFile("testdata/lucene_logs.response_from_opensearch.json")
+	require.NoError(b, err)
+
+	var msr map[string]interface{}
+	require.NoError(b, json.Unmarshal(responseFromOpenSearch, &msr))
+	res := msr["responses"].([]interface{})[0].(map[string]interface{})
+	hits := res["hits"].(map[string]interface{})
+	sample := hits["hits"].([]interface{})
+
+	repeated := make([]interface{}, benchmarkHits)
+	for i := range repeated {
+		hit := make(map[string]interface{})
+		for k, v := range sample[i%len(sample)].(map[string]interface{}) {
+			hit[k] = v
+		}
+		hit["_id"] = fmt.Sprintf("hit-%d", i)
+		repeated[i] = hit
+	}
+	hits["hits"] = repeated
+
+	body, err := json.Marshal(msr)
+	require.NoError(b, err)
+	return body
+}
+
+// BenchmarkLogsQueryData measures a logs query of a large response, from decoding it
+// to the data frame
+func BenchmarkLogsQueryData(b *testing.B) {
+	body := largeLogsResponse(b)
+	queries, err := setUpDataQueriesFromFileWithFixedTimeRange(b, "testdata/lucene_logs.query_input.json")
+	require.NoError(b, err)
+	openSearchDatasource := opensearch.OpenSearchDatasource{
+		HttpClient: &http.Client{Transport: &msearchRoundTripper{body: body}},
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result, err := openSearchDatasource.QueryData(context.Background(), &backend.QueryDataRequest{
+			PluginContext: backend.PluginContext{DataSourceInstanceSettings: newTestDsSettings()},
+			Queries:       queries,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if res := result.Responses["A"]; res.Error != nil {
+			b.Fatal(res.Error)
+		}
+	}
+}
@@ -61,8 +61,8 @@ func Test_metric_max_group_by_terms_request(t *testing.T) {
 // bucket count, so the date_histogram interval must be raised to keep the
 // request under OpenSearch's search.max_buckets limit. The request is identical
 // to Test_metric_percentiles_group_by_terms_orderby_percentile except the terms
-// "size" is 1000 (instead of 10) and the date_histogram "interval" is raised to
-// "5s" (instead of "100ms").
+// "size" is 1000 (instead of 10) and the date_histogram "fixed_interval" is raised
+// to "5000ms" (instead of "100ms").
 func Test_metric_percentiles_group_by_terms_large_size_raises_interval(t *testing.T) {
 	queries, err := setUpDataQueriesFromFileWithFixedTimeRange(t, "testdata/lucene_metric_percentiles_group_by_terms_large_size.query_input.json")
 	require.NoError(t, err)
@@ -100,7 +100,7 @@ func Test_metric_percentiles_group_by_terms_large_size_raises_interval(t *testin
 
 	// assert request's header and query
 	expectedRequest := `{"ignore_unavailable":true,"index":"","search_type":"query_then_fetch"}
-{"aggs":{"3":{"aggs":{"1":{"percentiles":{"field":"AvgTicketPrice"}},"2":{"aggs":{"1":{"percentiles":{"field":"AvgTicketPrice","percents":["50"]}}},"date_histogram":{"field":"timestamp","interval":"5s","min_doc_count":0,"extended_bounds":{"min":1668422437218,"max":1668422625668},"format":"epoch_millis"}}},"terms":{"field":"dayOfWeek","size":1000,"order":{"1[50.0]":"desc"},"min_doc_count":1}}},"query":{"bool":{"filter":[{"range":{"timestamp":{"format":"epoch_millis","gte":1668422437218,"lte":1668422625668}}},{"query_string":{"analyze_wildcard":true,"query":"*"}}]}},"size":0}
+{"aggs":{"3":{"aggs":{"1":{"percentiles":{"field":"AvgTicketPrice"}},"2":{"aggs":{"1":{"percentiles":{"field":"AvgTicketPrice","percents":["50"]}}},"date_histogram":{"field":"timestamp","fixed_interval":"5000ms","min_doc_count":0,"extended_bounds":{"min":1668422437218,"max":1668422625668},"format":"epoch_millis"}}},"terms":{"field":"dayOfWeek","size":1000,"order":{"1[50.0]":"desc"},"min_doc_count":1}}},"query":{"bool":{"filter":[{"range":{"timestamp":{"format":"epoch_millis","gte":1668422437218,"lte":1668422625668}}},{"query_string":{"analyze_wildcard":true,"query":"*"}}]}},"size":0}
 `
 	assert.Equal(t, expectedRequest, string(interceptedRequest))
 }
@@ -290,7 +290,7 @@ func Test_metric_sum_group_by_date_histogram_request(t *testing.T) {
 
 	// assert request's header and query
 	expectedRequest := `{"ignore_unavailable":true,"index":"","search_type":"query_then_fetch"}
-{"aggs":{"2":{"aggs":{"1":{"sum":{"field":"DistanceKilometers"}}},"date_histogram":{"field":"timestamp","interval":"100ms","min_doc_count":0,"extended_bounds":{"min":1668422437218,"max":1668422625668},"format":"epoch_millis"}}},"query":{"bool":{"filter":[{"range":{"timestamp":{"format":"epoch_millis","gte":1668422437218,"lte":1668422625668}}},{"query_string":{"analyze_wildcard":true,"query":"*"}}]}},"size":0}
+{"aggs":{"2":{"aggs":{"1":{"sum":{"field":"DistanceKilometers"}}},"date_histogram":{"field":"timestamp","fixed_interval":"100ms","min_doc_count":0,"extended_bounds":{"min":1668422437218,"max":1668422625668},"format":"epoch_millis"}}},"query":{"bool":{"filter":[{"range":{"timestamp":{"format":"epoch_millis","gte":1668422437218,"lte":1668422625668}}},{"query_string":{"analyze_wildcard":true,"query":"*"}}]}},"size":0}
 `
 	assert.Equal(t, expectedRequest, string(interceptedRequest))
 }
@@ -355,7 +355,7 @@ func Test_metric_average_derivative_group_by_date_histogram_request(t *testing.T
 
 	// assert request's header and query
 	expectedRequest := `{"ignore_unavailable":true,"index":"","search_type":"query_then_fetch"}
-{"aggs":{"2":{"aggs":{"1":{"avg":{"field":"AvgTicketPrice"}},"3":{"derivative":{"buckets_path":"1"}}},"date_histogram":{"field":"timestamp","interval":"1d","min_doc_count":0,"extended_bounds":{"min":1668422437218,"max":1668422625668},"format":"epoch_millis"}}},"query":{"bool":{"filter":[{"range":{"timestamp":{"format":"epoch_millis","gte":1668422437218,"lte":1668422625668}}},{"query_string":{"analyze_wildcard":true,"query":"*"}}]}},"size":0}
+{"aggs":{"2":{"aggs":{"1":{"avg":{"field":"AvgTicketPrice"}},"3":{"derivative":{"buckets_path":"1"}}},"date_histogram":{"field":"timestamp","calendar_interval":"1d","min_doc_count":0,"extended_bounds":{"min":1668422437218,"max":1668422625668},"format":"epoch_millis"}}},"query":{"bool":{"filter":[{"range":{"timestamp":{"format":"epoch_millis","gte":1668422437218,"lte":1668422625668}}},{"query_string":{"analyze_wildcard":true,"query":"*"}}]}},"size":0}
 `
 	assert.Equal(t, expectedRequest, string(interceptedRequest))
 }
@@ -420,7 +420,7 @@ func Test_metric_percentiles_group_by_terms_orderby_percentile(t *testing.T) {
 
 	// assert request's header and query
 	expectedRequest := `{"ignore_unavailable":true,"index":"","search_type":"query_then_fetch"}
-{"aggs":{"3":{"aggs":{"1":{"percentiles":{"field":"AvgTicketPrice"}},"2":{"aggs":{"1":{"percentiles":{"field":"AvgTicketPrice","percents":["50"]}}},"date_histogram":{"field":"timestamp","interval":"100ms","min_doc_count":0,"extended_bounds":{"min":1668422437218,"max":1668422625668},"format":"epoch_millis"}}},"terms":{"field":"dayOfWeek","size":10,"order":{"1[50.0]":"desc"},"min_doc_count":1}}},"query":{"bool":{"filter":[{"range":{"timestamp":{"format":"epoch_millis","gte":1668422437218,"lte":1668422625668}}},{"query_string":{"analyze_wildcard":true,"query":"*"}}]}},"size":0}
+{"aggs":{"3":{"aggs":{"1":{"percentiles":{"field":"AvgTicketPrice"}},"2":{"aggs":{"1":{"percentiles":{"field":"AvgTicketPrice","percents":["50"]}}},"date_histogram":{"field":"timestamp","fixed_interval":"100ms","min_doc_count":0,"extended_bounds":{"min":1668422437218,"max":1668422625668},"format":"epoch_millis"}}},"terms":{"field":"dayOfWeek","size":10,"order":{"1[50.0]":"desc"},"min_doc_count":1}}},"query":{"bool":{"filter":[{"range":{"timestamp":{"format":"epoch_millis","gte":1668422437218,"lte":1668422625668}}},{"query_string":{"analyze_wildcard":true,"query":"*"}}]}},"size":0}
 `
 	assert.Equal(t, expectedRequest, string(interceptedRequest))
 }
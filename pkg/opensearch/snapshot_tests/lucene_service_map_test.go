@@ -19,8 +19,9 @@ func Test_service_map_prefetch_request(t *testing.T) {
 	var interceptedRequests [][]byte
 	openSearchDatasource := opensearch.OpenSearchDatasource{
 		HttpClient: &http.Client{
-			// we don't assert the response in this test
-			Transport: &queryDataTestRoundTripper{body: []byte(`{"responses":[]}`), statusCode: 200, requestCallback: func(req *http.Request) error {
+			// we don't assert the response in this test, but the prefetch needs one to
+			// go on with the trace list request
+			Transport: &queryDataTestRoundTripper{body: []byte(`{"responses":[{"aggregations":{"service_name":{"buckets":[]}}}]}`), statusCode: 200, requestCallback: func(req *http.Request) error {
 				request, err := io.ReadAll(req.Body)
 				if err != nil {
 					return err
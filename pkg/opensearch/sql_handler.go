@@ -0,0 +1,77 @@
+package opensearch
+
+import (
+	"context"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+)
+
+type sqlHandler struct {
+	client   client.Client
+	limiter  concurrencyLimiter
+	builders map[string]*client.SQLRequestBuilder
+	queries  map[string]*Query
+}
+
+func newSQLHandler(openSearchClient client.Client, limiter concurrencyLimiter) *sqlHandler {
+	return &sqlHandler{
+		client:   openSearchClient,
+		limiter:  limiter,
+		builders: make(map[string]*client.SQLRequestBuilder),
+		queries:  make(map[string]*Query),
+	}
+}
+
+func (h *sqlHandler) processQuery(q *Query) error {
+	from := q.TimeRange.From.UTC().Format("2006-01-02 15:04:05")
+	to := q.TimeRange.To.UTC().Format("2006-01-02 15:04:05")
+
+	timeField := h.client.GetConfiguredFields().TimeField
+	if q.annotation != nil {
+		timeField = q.annotation.timeField(timeField)
+	}
+
+	builder := h.client.SQL()
+	builder.AddSQLQueryString(timeField, to, from, q.RawQuery)
+	h.builders[q.RefID] = builder
+	h.queries[q.RefID] = q
+	return nil
+}
+
+func (h *sqlHandler) executeQueries(ctx context.Context) (*backend.QueryDataResponse, error) {
+	refIDs := make([]string, 0, len(h.builders))
+	for refID := range h.builders {
+		refIDs = append(refIDs, refID)
+	}
+	results := executeConcurrently(ctx, h.limiter, refIDs, h.executeQuery)
+	return collectResults(results), nil
+}
+
+func (h *sqlHandler) executeQuery(ctx context.Context, refID string) (backend.DataResponse, error) {
+	req, err := h.builders[refID].Build()
+	if err != nil {
+		return backend.DataResponse{}, backend.PluginError(err)
+	}
+	res, err := h.client.ExecuteSQLQuery(ctx, req)
+	if err != nil {
+		if backend.IsDownstreamHTTPError(err) {
+			err = backend.DownstreamError(err)
+		}
+		return backend.DataResponse{}, err
+	}
+	if res.Status >= 400 {
+		return backend.DataResponse{}, jdbcStatusError("ExecuteSQLQuery", res)
+	}
+
+	// SQL responses use the same JDBC format as PPL responses
+	query := h.queries[refID]
+	rp := newPPLResponseParser(res)
+	rp.annotation = query.annotation
+	queryRes, err := rp.parseResponse(h.client.GetConfiguredFields(), query.Format)
+	if err != nil {
+		return backend.DataResponse{}, err
+	}
+	addQueryMeta(queryRes.Frames, req.Query, pplResponseStats(res))
+	return *queryRes, nil
+}
@@ -0,0 +1,210 @@
+package opensearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+	"github.com/grafana/opensearch-datasource/pkg/tsdb"
+)
+
+// tailPathPrefix prefixes the paths of live tailing streams, which are followed by the query's RefID
+const tailPathPrefix = "tail/"
+
+// tailPollInterval is the time between two searches for new documents of a tailed logs query
+var tailPollInterval = time.Second
+
+var _ backend.StreamHandler = (*OpenSearchDatasource)(nil)
+
+// SubscribeStream allows subscribing to a live tail of a Lucene logs query. The
+// query is sent as the subscription's data.
+func (ds *OpenSearchDatasource) SubscribeStream(_ context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	if !strings.HasPrefix(req.Path, tailPathPrefix) {
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+	if _, err := parseTailQuery(req.Path, req.Data); err != nil {
+		return nil, err
+	}
+	return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusOK}, nil
+}
+
+// PublishStream rejects publications, tailing streams are only written by the datasource
+func (ds *OpenSearchDatasource) PublishStream(context.Context, *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
+	return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+}
+
+// RunStream tails a logs query: it polls for documents newer than the last one
+// sent and sends them as log frames, until ctx is done.
+func (ds *OpenSearchDatasource) RunStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	q, err := parseTailQuery(req.Path, req.Data)
+	if err != nil {
+		return err
+	}
+	osClient, err := client.NewClient(ctx, req.PluginContext.DataSourceInstanceSettings, ds.HttpClient)
+	if err != nil {
+		return err
+	}
+
+	// the mapping is looked up once, so the columns of the frames of a stream don't
+	// change between polls
+	start := time.Now()
+	index := osClient.SearchIndex(q.Index, backend.TimeRange{From: start, To: start})
+	mapping := lookupFieldMapping(ctx, osClient, req.PluginContext.DataSourceInstanceSettings, index)
+
+	tail := newLogsTail(osClient, q, start, mapping)
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		frame, err := tail.poll(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// a failed poll is retried with the next one, the stream only ends with ctx
+			backend.Logger.Warn("Failed to poll tailed logs query", "path", req.Path, "error", err)
+			continue
+		}
+		if frame == nil {
+			continue
+		}
+		if err := sender.SendFrame(frame, data.IncludeAll); err != nil {
+			return err
+		}
+	}
+}
+
+// parseTailQuery parses the query of a tailing stream, which has to be a Lucene logs query
+func parseTailQuery(path string, queryJSON []byte) (*Query, error) {
+	refID := strings.TrimPrefix(path, tailPathPrefix)
+	queries, err := parseQuery(backend.DataQuery{RefID: refID, JSON: queryJSON})
+	if err != nil {
+		return nil, backend.DownstreamError(err)
+	}
+	q := queries[len(queries)-1]
+	if q.QueryType != Lucene || len(q.Metrics) == 0 || q.Metrics[0].Type != logsType {
+		return nil, backend.DownstreamError(errors.New("only Lucene logs queries can be tailed"))
+	}
+	return q, nil
+}
+
+// logsTail searches for the documents of a logs query in the order they were
+// written, continuing after the last document it returned. Documents are only
+// sorted by the time field, since sorting by _id needs fielddata which many clusters
+// don't allow, so a document written after a poll with the same time field value
+// as the last document returned is not returned.
+type logsTail struct {
+	client client.Client
+	query  *Query
+	// mapping types the columns of every frame of the tail
+	mapping fieldMapping
+	// start is the time the tail started, the first documents returned are newer
+	start time.Time
+	// searchAfter holds the sort values of the last document returned, nil until
+	// a document is returned
+	searchAfter []interface{}
+}
+
+func newLogsTail(c client.Client, q *Query, start time.Time, mapping fieldMapping) *logsTail {
+	return &logsTail{
+		client:  c,
+		query:   q,
+		mapping: mapping,
+		start:   start,
+	}
+}
+
+// poll returns a log frame of the documents written since the last poll, in the
+// shape of a logs query response, or nil when there are none
+func (t *logsTail) poll(ctx context.Context) (*data.Frame, error) {
+	from, err := t.lastTimestamp()
+	if err != nil {
+		return nil, err
+	}
+	to := time.Now()
+	if to.UnixMilli() < from {
+		to = time.UnixMilli(from)
+	}
+
+	timeField := t.client.GetConfiguredFields().TimeField
+	ms := t.client.MultiSearch()
+	b := ms.Search(tsdb.Interval{}, backend.TimeRange{From: time.UnixMilli(from), To: to})
+	if t.query.Index != "" {
+		b.SetIndex(t.query.Index)
+	}
+	b.Size(documentsSize(t.query.Metrics[0]))
+	b.Sort(ascending, timeField, "boolean")
+	b.SetCustomProps(timeField, logsType)
+	filters := b.Query().Bool().Filter()
+	if t.searchAfter == nil {
+		// without the sort values of a document to continue after, the documents
+		// are those after the start of the tail
+		filters.AddRangeBoundFilter(timeField, "gt", client.DateFormatEpochMS, from)
+		filters.AddRangeBoundFilter(timeField, "lte", client.DateFormatEpochMS, to.UnixMilli())
+	} else {
+		filters.AddDateRangeFilter(timeField, client.DateFormatEpochMS, to.UnixMilli(), from)
+	}
+	if t.query.RawQuery != "" {
+		filters.AddQueryStringFilter(t.query.RawQuery, true)
+	}
+
+	req, err := ms.Build()
+	if err != nil {
+		return nil, err
+	}
+	req.Requests[0].SearchAfter = t.searchAfter
+
+	res, err := t.client.ExecuteMultisearch(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Responses) == 0 {
+		return nil, errors.New("multisearch response is empty")
+	}
+	searchRes := res.Responses[0]
+	if searchRes.Error != nil {
+		return nil, getErrorFromOpenSearchResponse(searchRes)
+	}
+	if searchRes.Hits == nil || len(searchRes.Hits.Hits) == 0 {
+		return nil, nil
+	}
+
+	hits := searchRes.Hits.Hits
+	if sortValues, ok := hits[len(hits)-1]["sort"].([]interface{}); ok && len(sortValues) == 1 {
+		t.searchAfter = sortValues
+	}
+
+	queryRes := processLogsResponse(searchRes, t.client.GetConfiguredFields(), t.mapping, backend.DataResponse{})
+	if queryRes.Error != nil {
+		return nil, queryRes.Error
+	}
+	frame := queryRes.Frames[0]
+	frame.RefID = t.query.RefID
+	return frame, nil
+}
+
+// lastTimestamp returns the time field value of the last document returned, or the
+// start of the tail before the first document, in milliseconds
+func (t *logsTail) lastTimestamp() (int64, error) {
+	if t.searchAfter == nil {
+		return t.start.UnixMilli(), nil
+	}
+	switch v := t.searchAfter[0].(type) {
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	default:
+		return 0, fmt.Errorf("unexpected sort value %v of the time field", v)
+	}
+}
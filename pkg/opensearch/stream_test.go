@@ -0,0 +1,193 @@
+package opensearch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tailLogsQuery = `{ "query": "level:error", "metrics": [{ "id": "1", "type": "logs" }] }`
+
+func Test_SubscribeStream(t *testing.T) {
+	ds := &OpenSearchDatasource{}
+
+	t.Run("accepts a Lucene logs query", func(t *testing.T) {
+		res, err := ds.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{Path: "tail/A", Data: []byte(tailLogsQuery)})
+		require.NoError(t, err)
+		assert.Equal(t, backend.SubscribeStreamStatusOK, res.Status)
+	})
+
+	t.Run("rejects other queries", func(t *testing.T) {
+		_, err := ds.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{
+			Path: "tail/A",
+			Data: []byte(`{ "metrics": [{ "id": "1", "type": "count" }], "bucketAggs": [{ "id": "2", "type": "date_histogram" }] }`),
+		})
+		assert.EqualError(t, err, "only Lucene logs queries can be tailed")
+		assert.True(t, backend.IsDownstreamError(err))
+	})
+
+	t.Run("does not know other paths", func(t *testing.T) {
+		res, err := ds.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{Path: "metrics/A", Data: []byte(tailLogsQuery)})
+		require.NoError(t, err)
+		assert.Equal(t, backend.SubscribeStreamStatusNotFound, res.Status)
+	})
+}
+
+func Test_logsTail_poll(t *testing.T) {
+	q, err := parseTailQuery("tail/A", []byte(tailLogsQuery))
+	require.NoError(t, err)
+	start := time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC)
+
+	c := newFakeClient(client.OpenSearch, "2.11.0")
+	c.multiSearchResponses = []*client.MultiSearchResponse{
+		{Responses: []*client.SearchResponse{{Hits: &client.SearchResponseHits{Hits: []map[string]interface{}{
+			{"_id": "a", "_source": map[string]interface{}{"@timestamp": "2018-05-15T17:50:01Z", "message": "first"}, "sort": []interface{}{float64(1526406601000)}},
+			{"_id": "b", "_source": map[string]interface{}{"@timestamp": "2018-05-15T17:50:02Z", "message": "second"}, "sort": []interface{}{float64(1526406602000)}},
+		}}}}},
+		{Responses: []*client.SearchResponse{{Hits: &client.SearchResponseHits{Hits: []map[string]interface{}{}}}}},
+		{Responses: []*client.SearchResponse{{Hits: &client.SearchResponseHits{Hits: []map[string]interface{}{}}}}},
+	}
+	tail := newLogsTail(c, q, start, nil)
+
+	frame, err := tail.poll(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, frame)
+	assert.Equal(t, "A", frame.RefID)
+	assert.Equal(t, 2, frame.Rows())
+	assert.Equal(t, data.VisTypeLogs, string(frame.Meta.PreferredVisualization))
+
+	// the first poll returns the documents after the start, sorted by time only
+	require.Len(t, c.multisearchRequests, 1)
+	first := c.multisearchRequests[0].Requests[0]
+	assert.Nil(t, first.SearchAfter)
+	assert.Equal(t, []map[string]map[string]string{
+		{"@timestamp": {"order": "asc", "unmapped_type": "boolean"}},
+	}, first.Sort)
+	require.Len(t, first.Query.Bool.Filters, 3)
+	assert.Equal(t, &client.RangeBoundFilter{Key: "@timestamp", Operator: "gt", Value: start.UnixMilli(), Format: client.DateFormatEpochMS}, first.Query.Bool.Filters[0])
+	assert.Equal(t, "lte", first.Query.Bool.Filters[1].(*client.RangeBoundFilter).Operator)
+	assert.Equal(t, "level:error", first.Query.Bool.Filters[2].(*client.QueryStringFilter).Query)
+
+	// the next poll continues after the last document
+	frame, err = tail.poll(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, frame)
+	require.Len(t, c.multisearchRequests, 2)
+	second := c.multisearchRequests[1].Requests[0]
+	assert.Equal(t, []interface{}{float64(1526406602000)}, second.SearchAfter)
+	assert.Equal(t, time.UnixMilli(1526406602000), second.TimeRange.From)
+	rangeFilter := second.Query.Bool.Filters[0].(*client.RangeFilter)
+	assert.Equal(t, int64(1526406602000), rangeFilter.Gte)
+
+	// a poll without documents keeps the position of the tail
+	_, err = tail.poll(context.Background())
+	require.NoError(t, err)
+	require.Len(t, c.multisearchRequests, 3)
+	assert.Equal(t, []interface{}{float64(1526406602000)}, c.multisearchRequests[2].Requests[0].SearchAfter)
+}
+
+func Test_logsTail_poll_types_columns_by_the_mapping(t *testing.T) {
+	q, err := parseTailQuery("tail/A", []byte(tailLogsQuery))
+	require.NoError(t, err)
+
+	c := newFakeClient(client.OpenSearch, "2.11.0")
+	page := func(status interface{}) *client.MultiSearchResponse {
+		return &client.MultiSearchResponse{Responses: []*client.SearchResponse{{Hits: &client.SearchResponseHits{Hits: []map[string]interface{}{
+			{"_id": "a", "_source": map[string]interface{}{"@timestamp": "2018-05-15T17:50:01Z", "status": status}, "sort": []interface{}{float64(1526406601000)}},
+		}}}}}
+	}
+	c.multiSearchResponses = []*client.MultiSearchResponse{page("500"), page(float64(404))}
+	tail := newLogsTail(c, q, time.Date(2018, 5, 15, 17, 50, 0, 0, time.UTC), fieldMapping{"status": fieldKindNumber})
+
+	// the column has the same type whatever the values of a poll are
+	for _, expected := range []float64{500, 404} {
+		frame, err := tail.poll(context.Background())
+		require.NoError(t, err)
+		field, _ := frame.FieldByName("status")
+		require.NotNil(t, field)
+		assert.Equal(t, data.FieldTypeNullableFloat64, field.Type())
+		assert.Equal(t, expected, *field.At(0).(*float64))
+	}
+}
+
+// fakeStreamPacketSender records the packets sent to a stream
+type fakeStreamPacketSender struct {
+	mu      sync.Mutex
+	packets []*backend.StreamPacket
+}
+
+func (s *fakeStreamPacketSender) Send(p *backend.StreamPacket) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.packets = append(s.packets, p)
+	return nil
+}
+
+func (s *fakeStreamPacketSender) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.packets)
+}
+
+func Test_RunStream(t *testing.T) {
+	tailPollInterval = time.Millisecond
+	t.Cleanup(func() { tailPollInterval = time.Second })
+
+	var polls, mappingLookups int
+	var mu sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/_field_caps") {
+			mappingLookups++
+			_, err := rw.Write([]byte(`{"fields": {"message": {"text": {"type": "text"}}}}`))
+			require.NoError(t, err)
+			return
+		}
+		polls++
+		// only the first poll finds a new document
+		body := `{"responses": [{"hits": {"hits": []}}]}`
+		if polls == 1 {
+			body = `{"responses": [{"hits": {"hits": [{"_id": "a", "_source": {"message": "new"}, "sort": [1526406601000]}]}}]}`
+		}
+		_, err := rw.Write([]byte(body))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(ts.Close)
+
+	ds := &OpenSearchDatasource{HttpClient: &http.Client{}}
+	packets := &fakeStreamPacketSender{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- ds.RunStream(ctx, &backend.RunStreamRequest{
+			PluginContext: backend.PluginContext{DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+				URL:      ts.URL,
+				JSONData: []byte(`{"version": "2.11.0", "timeField": "@timestamp", "database": "logs"}`),
+			}},
+			Path: "tail/A",
+			Data: []byte(tailLogsQuery),
+		}, backend.NewStreamSender(packets))
+	}()
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return polls > 2
+	}, time.Second, time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+	assert.Equal(t, 1, packets.count())
+	// the mapping is looked up once for all polls
+	assert.Equal(t, 1, mappingLookups)
+}
@@ -0,0 +1,147 @@
+package opensearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/opensearch-datasource/pkg/opensearch/client"
+)
+
+// topMetricsSortSuffix is appended to the ID of a top metrics metric to name the
+// aggregation terms are ordered by when they are ordered by the metric
+const topMetricsSortSuffix = "_sort"
+
+// topMetricsSettings returns the fields a top metrics metric returns the values of,
+// and the field and order its top document is sorted by. The documents are sorted by
+// the time field, latest first, by default.
+func topMetricsSettings(m *MetricAgg, defaultTimeField string) (fields []string, orderBy, order string) {
+	fields = m.Settings.Get("metrics").MustStringArray()
+	if len(fields) == 0 && m.Field != "" {
+		fields = []string{m.Field}
+	}
+	orderBy = m.Settings.Get("orderBy").MustString(defaultTimeField)
+	if orderBy == "" {
+		orderBy = defaultTimeField
+	}
+	order = m.Settings.Get("order").MustString(descending)
+	return fields, orderBy, order
+}
+
+// addTopMetricsAgg requests the top document of every bucket with a top_hits
+// aggregation, which OpenSearch supports unlike top_metrics. It returns the values
+// of any field, not only numeric ones.
+func addTopMetricsAgg(aggBuilder client.AggBuilder, m *MetricAgg, defaultTimeField string) {
+	fields, orderBy, order := topMetricsSettings(m, defaultTimeField)
+	aggBuilder.TopHits(m.ID, func(a *client.TopHitsAggregation) {
+		a.Sort = []map[string]interface{}{{orderBy: map[string]interface{}{"order": order, "unmapped_type": "boolean"}}}
+		a.Source = &client.TopHitsSource{Includes: fields}
+	})
+}
+
+// addTopMetricsOrderAgg adds the aggregation terms are ordered by when they are
+// ordered by a top metrics metric, and returns its name. It is the value the top
+// document is sorted by, so the terms are ordered by their top document.
+func addTopMetricsOrderAgg(aggBuilder client.AggBuilder, m *MetricAgg, defaultTimeField string) string {
+	_, orderBy, order := topMetricsSettings(m, defaultTimeField)
+	metricType := "max"
+	if order == ascending {
+		metricType = "min"
+	}
+	key := m.ID + topMetricsSortSuffix
+	aggBuilder.Metric(key, metricType, orderBy, nil)
+	return key
+}
+
+// topMetricValue returns the value of field in the top document of a bucket, or nil
+// if the bucket has no document or the document has no value
+func topMetricValue(bucket *simplejson.Json, metricID, field string) interface{} {
+	hits := bucket.GetPath(metricID, "hits", "hits").MustArray()
+	if len(hits) == 0 {
+		return nil
+	}
+	hit, _ := hits[0].(map[string]interface{})
+	source, _ := hit["_source"].(map[string]interface{})
+	value := flatten(source, maxFlattenDepth)[field]
+	switch v := value.(type) {
+	case nil, float64, string:
+		return v
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+}
+
+// newTopMetricsFrame returns a time series frame of the values of a top metrics
+// field. The values are numbers if they all are, strings otherwise.
+func newTopMetricsFrame(timeData []*time.Time, labels map[string]string, values []interface{}) *data.Frame {
+	frame := data.NewFrame("",
+		data.NewField(data.TimeSeriesTimeFieldName, nil, timeData),
+		topMetricsField(data.TimeSeriesValueFieldName, labels, values))
+	frame.Meta = &data.FrameMeta{
+		Type: data.FrameTypeTimeSeriesMulti,
+	}
+	return frame
+}
+
+func topMetricsField(name string, labels data.Labels, values []interface{}) *data.Field {
+	numeric := true
+	for _, v := range values {
+		if _, ok := v.(string); ok {
+			numeric = false
+			break
+		}
+	}
+	if numeric {
+		floats := make([]*float64, len(values))
+		for i, v := range values {
+			if f, ok := v.(float64); ok {
+				floats[i] = &f
+			}
+		}
+		return data.NewField(name, labels, floats)
+	}
+	strs := make([]*string, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case string:
+			strs[i] = &v
+		case float64:
+			s := strconv.FormatFloat(v, 'f', -1, 64)
+			strs[i] = &s
+		}
+	}
+	return data.NewField(name, labels, strs)
+}
+
+// addTopMetricsValue appends the value of a top metrics field to its column of a
+// table. A numeric column becomes a string column once it gets a string value.
+func addTopMetricsValue(fields []*data.Field, name string, value interface{}) []*data.Field {
+	for i, f := range fields {
+		if f.Name != name {
+			continue
+		}
+		values := make([]interface{}, f.Len(), f.Len()+1)
+		for j := range values {
+			values[j], _ = f.ConcreteAt(j)
+		}
+		column := topMetricsField(name, f.Labels, append(values, value))
+		column.Config = f.Config
+		fields[i] = column
+		return fields
+	}
+	return append(fields, topMetricsField(name, nil, []interface{}{value}))
+}
@@ -14,7 +14,7 @@ import {
   toUtc,
 } from '@grafana/data';
 import _ from 'lodash';
-import { enhanceDataFrame, OpenSearchDatasource } from './opensearchDatasource';
+import { enhanceDataFrame, OpenSearchDatasource, resolveTimeZone } from './opensearchDatasource';
 import { DataSourceWithBackend } from '@grafana/runtime';
 import { Flavor, OpenSearchOptions, OpenSearchQuery, QueryType } from './types';
 import { DateHistogram, Filters } from './components/QueryEditor/BucketAggregationsEditor/aggregations';
@@ -984,6 +984,42 @@ describe('OpenSearchDatasource', function (this: any) {
     });
   });
 
+  describe('time zone', () => {
+    it('sends the dashboard time zone with every query', async () => {
+      createDatasource({
+        url: OPENSEARCH_MOCK_URL,
+        jsonData: { database: '[asd-]YYYY.MM.DD', interval: 'Daily', version: '1.0.0' } as OpenSearchOptions,
+      } as DataSourceInstanceSettings<OpenSearchOptions>);
+      mockedSuperQuery.mockImplementation((_: DataQueryRequest<OpenSearchQuery>) => of({ data: [] }));
+      const request: DataQueryRequest<OpenSearchQuery> = {
+        requestId: '',
+        interval: '',
+        intervalMs: 1,
+        scopedVars: {},
+        timezone: 'Europe/Berlin',
+        app: CoreApp.Dashboard,
+        startTime: 0,
+        range: createTimeRange(toUtc([2015, 4, 30, 10]), toUtc([2015, 5, 1, 10])),
+        targets: [{ refId: 'A', metrics: [{ type: 'count', id: '1' }], queryType: QueryType.Lucene }],
+      };
+
+      await lastValueFrom(ctx.ds.query(request));
+
+      expect(mockedSuperQuery).toHaveBeenCalledWith(
+        expect.objectContaining({ targets: [expect.objectContaining({ refId: 'A', timezone: 'Europe/Berlin' })] })
+      );
+    });
+
+    it('resolves the browser time zone', () => {
+      const browserTimeZone = Intl.DateTimeFormat().resolvedOptions().timeZone;
+      expect(resolveTimeZone('browser')).toBe(browserTimeZone);
+      expect(resolveTimeZone('')).toBe(browserTimeZone);
+      expect(resolveTimeZone(undefined)).toBe(browserTimeZone);
+      expect(resolveTimeZone('utc')).toBe('utc');
+      expect(resolveTimeZone('America/New_York')).toBe('America/New_York');
+    });
+  });
+
   describe('Data links', () => {
     it('should add links to dataframe for logs queries', async () => {
       createDatasource({
@@ -689,7 +689,10 @@ export class OpenSearchDatasource
   }
 
   query(request: DataQueryRequest<OpenSearchQuery>): Observable<DataQueryResponse> {
-    return super.query(request).pipe(
+    // the backend can't resolve the browser time zone, so the queries carry the zone itself
+    const timezone = resolveTimeZone(request.timezone);
+    const targets = request.targets.map((target) => ({ ...target, timezone }));
+    return super.query({ ...request, targets }).pipe(
       tap({
         next: (response) => {
           trackQuery(response, request.targets, request.app);
@@ -1019,3 +1022,14 @@ export function enhanceDataFrame(dataFrame: DataFrame, dataLinks: DataLinkConfig
     field.config.links = [...(field.config.links || []), link];
   }
 }
+
+/**
+ * Returns the IANA time zone of a dashboard time zone, resolving the browser time zone,
+ * which is also the default, to the zone of the browser.
+ */
+export function resolveTimeZone(timezone: string | undefined): string {
+  if (!timezone || timezone === 'browser') {
+    return Intl.DateTimeFormat().resolvedOptions().timeZone;
+  }
+  return timezone;
+}
@@ -85,6 +85,8 @@ export interface OpenSearchQuery extends DataQuery {
   serviceMap?: boolean;
   tracesSize?: string;
   index?: string;
+  // timezone is the IANA time zone of the dashboard, which date histogram buckets are aligned to
+  timezone?: string;
 }
 
 export interface OpenSearchAnnotationQuery {